@@ -0,0 +1,112 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	cfg "sigs.k8s.io/controller-runtime/pkg/config/v1alpha1"
+)
+
+// +kubebuilder:object:root=true
+
+// MetalStackProviderConfig is the configuration file of the manager.
+// Flags given on the command line take precedence over it.
+type MetalStackProviderConfig struct {
+	metav1.TypeMeta `json:",inline"`
+
+	// ControllerManagerConfigurationSpec configures the manager, e.g. its leader election, sync period and probes.
+	// The concurrency of the controllers is configured by `controller.groupKindConcurrency`,
+	// e.g. `MetalStackMachine.infrastructure.cluster.x-k8s.io: 5`.
+	cfg.ControllerManagerConfigurationSpec `json:",inline"`
+
+	// WatchNamespaces restricts the controllers to these namespaces, all namespaces if empty.
+	// It takes precedence over `cacheNamespace`.
+	// +optional
+	WatchNamespaces []string `json:"watchNamespaces,omitempty"`
+
+	// WatchFilterValue restricts the reconciled objects to those labeled with `cluster.x-k8s.io/watch-filter` and this value.
+	// +optional
+	WatchFilterValue string `json:"watchFilterValue,omitempty"`
+
+	// MetalAPI configures the client of metal-API.
+	// +optional
+	MetalAPI MetalAPIConfig `json:"metalAPI,omitempty"`
+}
+
+// MetalAPIConfig configures the client of metal-API.
+type MetalAPIConfig struct {
+	// URL of metal-API. Defaults to the environment variable METALCTL_URL.
+	// +optional
+	URL string `json:"url,omitempty"`
+
+	// URLFile is the file with the URL of metal-API, e.g. mounted from the Secret with the credentials.
+	// It takes precedence over the URL.
+	// +optional
+	URLFile string `json:"urlFile,omitempty"`
+
+	// HMACFile is the file with the HMAC key for metal-API. Defaults to the environment variable METALCTL_HMAC.
+	// +optional
+	HMACFile string `json:"hmacFile,omitempty"`
+
+	// TokenFile is the file with the bearer token for metal-API, e.g. a project-scoped token mounted from a Secret.
+	// It's exclusive with the HMAC key.
+	// +optional
+	TokenFile string `json:"tokenFile,omitempty"`
+
+	// CredentialsReloadInterval is the interval the credentials are read again, so that rotated ones are used without a restart.
+	// Must be positive. Defaults to 1m.
+	// +optional
+	CredentialsReloadInterval *metav1.Duration `json:"credentialsReloadInterval,omitempty"`
+
+	// Timeout of the requests to metal-API. Defaults to 30s.
+	// +optional
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+
+	// HealthCheckInterval is the time the result of the readiness check of metal-API is cached. Must be positive. Defaults to 30s.
+	// +optional
+	HealthCheckInterval *metav1.Duration `json:"healthCheckInterval,omitempty"`
+
+	// QPS is the number of requests per second to metal-API, unlimited if not positive. Defaults to 10.
+	// +optional
+	QPS *float64 `json:"qps,omitempty"`
+
+	// Burst is the number of requests to metal-API which may exceed the QPS at once, at least 1. Defaults to 20.
+	// +optional
+	Burst *int `json:"burst,omitempty"`
+
+	// BreakerFailures is the number of consecutive failed requests which stop the requests to metal-API,
+	// disabled if not positive. Defaults to 5.
+	// +optional
+	BreakerFailures *int `json:"breakerFailures,omitempty"`
+
+	// BreakerOpenDuration is the time the requests to metal-API are stopped until a single request probes it again.
+	// Defaults to 30s.
+	// +optional
+	BreakerOpenDuration *metav1.Duration `json:"breakerOpenDuration,omitempty"`
+
+	// CacheTTL is the time lookups of metal-API are cached, disabled if not positive. Defaults to 10s.
+	// +optional
+	CacheTTL *metav1.Duration `json:"cacheTTL,omitempty"`
+
+	// CacheBulkList lists the machines of a cluster by a single request to fill the cache.
+	// +optional
+	CacheBulkList *bool `json:"cacheBulkList,omitempty"`
+}
+
+func init() {
+	SchemeBuilder.Register(&MetalStackProviderConfig{})
+}
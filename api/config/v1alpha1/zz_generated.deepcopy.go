@@ -0,0 +1,117 @@
+// +build !ignore_autogenerated
+
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Code generated by controller-gen. DO NOT EDIT.
+
+package v1alpha1
+
+import (
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	runtime "k8s.io/apimachinery/pkg/runtime"
+)
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MetalAPIConfig) DeepCopyInto(out *MetalAPIConfig) {
+	*out = *in
+	if in.CredentialsReloadInterval != nil {
+		in, out := &in.CredentialsReloadInterval, &out.CredentialsReloadInterval
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.Timeout != nil {
+		in, out := &in.Timeout, &out.Timeout
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.HealthCheckInterval != nil {
+		in, out := &in.HealthCheckInterval, &out.HealthCheckInterval
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.QPS != nil {
+		in, out := &in.QPS, &out.QPS
+		*out = new(float64)
+		**out = **in
+	}
+	if in.Burst != nil {
+		in, out := &in.Burst, &out.Burst
+		*out = new(int)
+		**out = **in
+	}
+	if in.BreakerFailures != nil {
+		in, out := &in.BreakerFailures, &out.BreakerFailures
+		*out = new(int)
+		**out = **in
+	}
+	if in.BreakerOpenDuration != nil {
+		in, out := &in.BreakerOpenDuration, &out.BreakerOpenDuration
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.CacheTTL != nil {
+		in, out := &in.CacheTTL, &out.CacheTTL
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.CacheBulkList != nil {
+		in, out := &in.CacheBulkList, &out.CacheBulkList
+		*out = new(bool)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MetalAPIConfig.
+func (in *MetalAPIConfig) DeepCopy() *MetalAPIConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(MetalAPIConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MetalStackProviderConfig) DeepCopyInto(out *MetalStackProviderConfig) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ControllerManagerConfigurationSpec.DeepCopyInto(&out.ControllerManagerConfigurationSpec)
+	if in.WatchNamespaces != nil {
+		in, out := &in.WatchNamespaces, &out.WatchNamespaces
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	in.MetalAPI.DeepCopyInto(&out.MetalAPI)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MetalStackProviderConfig.
+func (in *MetalStackProviderConfig) DeepCopy() *MetalStackProviderConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(MetalStackProviderConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *MetalStackProviderConfig) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
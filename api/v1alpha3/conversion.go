@@ -2,6 +2,7 @@ package v1alpha3
 
 import (
 	"github.com/metal-stack/cluster-api-provider-metalstack/api/v1alpha4"
+	apiconversion "k8s.io/apimachinery/pkg/conversion"
 	"sigs.k8s.io/controller-runtime/pkg/conversion"
 )
 
@@ -84,3 +85,33 @@ func (dst *MetalStackMachineTemplateList) ConvertFrom(srcRaw conversion.Hub) err
 	src := srcRaw.(*v1alpha4.MetalStackMachineTemplateList)
 	return Convert_v1alpha4_MetalStackMachineTemplateList_To_v1alpha3_MetalStackMachineTemplateList(src, dst, nil)
 }
+
+// Convert_v1alpha4_MetalStackMachineStatus_To_v1alpha3_MetalStackMachineStatus drops the conditions, the remediation and the host candidates which don't exist in v1alpha3.
+func Convert_v1alpha4_MetalStackMachineStatus_To_v1alpha3_MetalStackMachineStatus(in *v1alpha4.MetalStackMachineStatus, out *MetalStackMachineStatus, s apiconversion.Scope) error {
+	return autoConvert_v1alpha4_MetalStackMachineStatus_To_v1alpha3_MetalStackMachineStatus(in, out, s)
+}
+
+// Convert_v1alpha4_MetalStackMachineSpec_To_v1alpha3_MetalStackMachineSpec drops the remediation and the host selector which don't exist in v1alpha3.
+func Convert_v1alpha4_MetalStackMachineSpec_To_v1alpha3_MetalStackMachineSpec(in *v1alpha4.MetalStackMachineSpec, out *MetalStackMachineSpec, s apiconversion.Scope) error {
+	return autoConvert_v1alpha4_MetalStackMachineSpec_To_v1alpha3_MetalStackMachineSpec(in, out, s)
+}
+
+// Convert_v1alpha4_MetalStackClusterStatus_To_v1alpha3_MetalStackClusterStatus drops the capacity, the conditions, the firewall update and the egress IPs which don't exist in v1alpha3.
+func Convert_v1alpha4_MetalStackClusterStatus_To_v1alpha3_MetalStackClusterStatus(in *v1alpha4.MetalStackClusterStatus, out *MetalStackClusterStatus, s apiconversion.Scope) error {
+	return autoConvert_v1alpha4_MetalStackClusterStatus_To_v1alpha3_MetalStackClusterStatus(in, out, s)
+}
+
+// Convert_v1alpha4_MetalStackClusterSpec_To_v1alpha3_MetalStackClusterSpec drops the firewall opt-out and replicas which don't exist in v1alpha3.
+func Convert_v1alpha4_MetalStackClusterSpec_To_v1alpha3_MetalStackClusterSpec(in *v1alpha4.MetalStackClusterSpec, out *MetalStackClusterSpec, s apiconversion.Scope) error {
+	return autoConvert_v1alpha4_MetalStackClusterSpec_To_v1alpha3_MetalStackClusterSpec(in, out, s)
+}
+
+// Convert_v1alpha4_MetalStackFirewallStatus_To_v1alpha3_MetalStackFirewallStatus drops the machine status, the conditions, the credentials expiry and the firewall-controller status which don't exist in v1alpha3.
+func Convert_v1alpha4_MetalStackFirewallStatus_To_v1alpha3_MetalStackFirewallStatus(in *v1alpha4.MetalStackFirewallStatus, out *MetalStackFirewallStatus, s apiconversion.Scope) error {
+	return autoConvert_v1alpha4_MetalStackFirewallStatus_To_v1alpha3_MetalStackFirewallStatus(in, out, s)
+}
+
+// Convert_v1alpha4_MetalStackFirewallSpec_To_v1alpha3_MetalStackFirewallSpec drops the egress IPs and the ignition settings which don't exist in v1alpha3.
+func Convert_v1alpha4_MetalStackFirewallSpec_To_v1alpha3_MetalStackFirewallSpec(in *v1alpha4.MetalStackFirewallSpec, out *MetalStackFirewallSpec, s apiconversion.Scope) error {
+	return autoConvert_v1alpha4_MetalStackFirewallSpec_To_v1alpha3_MetalStackFirewallSpec(in, out, s)
+}
@@ -63,21 +63,11 @@ func RegisterConversions(s *runtime.Scheme) error {
 	}); err != nil {
 		return err
 	}
-	if err := s.AddGeneratedConversionFunc((*v1alpha4.MetalStackClusterSpec)(nil), (*MetalStackClusterSpec)(nil), func(a, b interface{}, scope conversion.Scope) error {
-		return Convert_v1alpha4_MetalStackClusterSpec_To_v1alpha3_MetalStackClusterSpec(a.(*v1alpha4.MetalStackClusterSpec), b.(*MetalStackClusterSpec), scope)
-	}); err != nil {
-		return err
-	}
 	if err := s.AddGeneratedConversionFunc((*MetalStackClusterStatus)(nil), (*v1alpha4.MetalStackClusterStatus)(nil), func(a, b interface{}, scope conversion.Scope) error {
 		return Convert_v1alpha3_MetalStackClusterStatus_To_v1alpha4_MetalStackClusterStatus(a.(*MetalStackClusterStatus), b.(*v1alpha4.MetalStackClusterStatus), scope)
 	}); err != nil {
 		return err
 	}
-	if err := s.AddGeneratedConversionFunc((*v1alpha4.MetalStackClusterStatus)(nil), (*MetalStackClusterStatus)(nil), func(a, b interface{}, scope conversion.Scope) error {
-		return Convert_v1alpha4_MetalStackClusterStatus_To_v1alpha3_MetalStackClusterStatus(a.(*v1alpha4.MetalStackClusterStatus), b.(*MetalStackClusterStatus), scope)
-	}); err != nil {
-		return err
-	}
 	if err := s.AddGeneratedConversionFunc((*MetalStackFirewall)(nil), (*v1alpha4.MetalStackFirewall)(nil), func(a, b interface{}, scope conversion.Scope) error {
 		return Convert_v1alpha3_MetalStackFirewall_To_v1alpha4_MetalStackFirewall(a.(*MetalStackFirewall), b.(*v1alpha4.MetalStackFirewall), scope)
 	}); err != nil {
@@ -103,21 +93,11 @@ func RegisterConversions(s *runtime.Scheme) error {
 	}); err != nil {
 		return err
 	}
-	if err := s.AddGeneratedConversionFunc((*v1alpha4.MetalStackFirewallSpec)(nil), (*MetalStackFirewallSpec)(nil), func(a, b interface{}, scope conversion.Scope) error {
-		return Convert_v1alpha4_MetalStackFirewallSpec_To_v1alpha3_MetalStackFirewallSpec(a.(*v1alpha4.MetalStackFirewallSpec), b.(*MetalStackFirewallSpec), scope)
-	}); err != nil {
-		return err
-	}
 	if err := s.AddGeneratedConversionFunc((*MetalStackFirewallStatus)(nil), (*v1alpha4.MetalStackFirewallStatus)(nil), func(a, b interface{}, scope conversion.Scope) error {
 		return Convert_v1alpha3_MetalStackFirewallStatus_To_v1alpha4_MetalStackFirewallStatus(a.(*MetalStackFirewallStatus), b.(*v1alpha4.MetalStackFirewallStatus), scope)
 	}); err != nil {
 		return err
 	}
-	if err := s.AddGeneratedConversionFunc((*v1alpha4.MetalStackFirewallStatus)(nil), (*MetalStackFirewallStatus)(nil), func(a, b interface{}, scope conversion.Scope) error {
-		return Convert_v1alpha4_MetalStackFirewallStatus_To_v1alpha3_MetalStackFirewallStatus(a.(*v1alpha4.MetalStackFirewallStatus), b.(*MetalStackFirewallStatus), scope)
-	}); err != nil {
-		return err
-	}
 	if err := s.AddGeneratedConversionFunc((*MetalStackMachine)(nil), (*v1alpha4.MetalStackMachine)(nil), func(a, b interface{}, scope conversion.Scope) error {
 		return Convert_v1alpha3_MetalStackMachine_To_v1alpha4_MetalStackMachine(a.(*MetalStackMachine), b.(*v1alpha4.MetalStackMachine), scope)
 	}); err != nil {
@@ -143,21 +123,11 @@ func RegisterConversions(s *runtime.Scheme) error {
 	}); err != nil {
 		return err
 	}
-	if err := s.AddGeneratedConversionFunc((*v1alpha4.MetalStackMachineSpec)(nil), (*MetalStackMachineSpec)(nil), func(a, b interface{}, scope conversion.Scope) error {
-		return Convert_v1alpha4_MetalStackMachineSpec_To_v1alpha3_MetalStackMachineSpec(a.(*v1alpha4.MetalStackMachineSpec), b.(*MetalStackMachineSpec), scope)
-	}); err != nil {
-		return err
-	}
 	if err := s.AddGeneratedConversionFunc((*MetalStackMachineStatus)(nil), (*v1alpha4.MetalStackMachineStatus)(nil), func(a, b interface{}, scope conversion.Scope) error {
 		return Convert_v1alpha3_MetalStackMachineStatus_To_v1alpha4_MetalStackMachineStatus(a.(*MetalStackMachineStatus), b.(*v1alpha4.MetalStackMachineStatus), scope)
 	}); err != nil {
 		return err
 	}
-	if err := s.AddGeneratedConversionFunc((*v1alpha4.MetalStackMachineStatus)(nil), (*MetalStackMachineStatus)(nil), func(a, b interface{}, scope conversion.Scope) error {
-		return Convert_v1alpha4_MetalStackMachineStatus_To_v1alpha3_MetalStackMachineStatus(a.(*v1alpha4.MetalStackMachineStatus), b.(*MetalStackMachineStatus), scope)
-	}); err != nil {
-		return err
-	}
 	if err := s.AddGeneratedConversionFunc((*MetalStackMachineTemplate)(nil), (*v1alpha4.MetalStackMachineTemplate)(nil), func(a, b interface{}, scope conversion.Scope) error {
 		return Convert_v1alpha3_MetalStackMachineTemplate_To_v1alpha4_MetalStackMachineTemplate(a.(*MetalStackMachineTemplate), b.(*v1alpha4.MetalStackMachineTemplate), scope)
 	}); err != nil {
@@ -198,6 +168,36 @@ func RegisterConversions(s *runtime.Scheme) error {
 	}); err != nil {
 		return err
 	}
+	if err := s.AddConversionFunc((*v1alpha4.MetalStackClusterSpec)(nil), (*MetalStackClusterSpec)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_v1alpha4_MetalStackClusterSpec_To_v1alpha3_MetalStackClusterSpec(a.(*v1alpha4.MetalStackClusterSpec), b.(*MetalStackClusterSpec), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddConversionFunc((*v1alpha4.MetalStackClusterStatus)(nil), (*MetalStackClusterStatus)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_v1alpha4_MetalStackClusterStatus_To_v1alpha3_MetalStackClusterStatus(a.(*v1alpha4.MetalStackClusterStatus), b.(*MetalStackClusterStatus), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddConversionFunc((*v1alpha4.MetalStackFirewallSpec)(nil), (*MetalStackFirewallSpec)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_v1alpha4_MetalStackFirewallSpec_To_v1alpha3_MetalStackFirewallSpec(a.(*v1alpha4.MetalStackFirewallSpec), b.(*MetalStackFirewallSpec), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddConversionFunc((*v1alpha4.MetalStackFirewallStatus)(nil), (*MetalStackFirewallStatus)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_v1alpha4_MetalStackFirewallStatus_To_v1alpha3_MetalStackFirewallStatus(a.(*v1alpha4.MetalStackFirewallStatus), b.(*MetalStackFirewallStatus), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddConversionFunc((*v1alpha4.MetalStackMachineSpec)(nil), (*MetalStackMachineSpec)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_v1alpha4_MetalStackMachineSpec_To_v1alpha3_MetalStackMachineSpec(a.(*v1alpha4.MetalStackMachineSpec), b.(*MetalStackMachineSpec), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddConversionFunc((*v1alpha4.MetalStackMachineStatus)(nil), (*MetalStackMachineStatus)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_v1alpha4_MetalStackMachineStatus_To_v1alpha3_MetalStackMachineStatus(a.(*v1alpha4.MetalStackMachineStatus), b.(*MetalStackMachineStatus), scope)
+	}); err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -305,14 +305,11 @@ func autoConvert_v1alpha4_MetalStackClusterSpec_To_v1alpha3_MetalStackClusterSpe
 	if err := Convert_v1alpha4_MetalStackFirewallSpec_To_v1alpha3_MetalStackFirewallSpec(&in.FirewallSpec, &out.FirewallSpec, s); err != nil {
 		return err
 	}
+	// WARNING: in.FirewallReplicas requires manual conversion: does not exist in peer-type
+	// WARNING: in.DisableFirewall requires manual conversion: does not exist in peer-type
 	return nil
 }
 
-// Convert_v1alpha4_MetalStackClusterSpec_To_v1alpha3_MetalStackClusterSpec is an autogenerated conversion function.
-func Convert_v1alpha4_MetalStackClusterSpec_To_v1alpha3_MetalStackClusterSpec(in *v1alpha4.MetalStackClusterSpec, out *MetalStackClusterSpec, s conversion.Scope) error {
-	return autoConvert_v1alpha4_MetalStackClusterSpec_To_v1alpha3_MetalStackClusterSpec(in, out, s)
-}
-
 func autoConvert_v1alpha3_MetalStackClusterStatus_To_v1alpha4_MetalStackClusterStatus(in *MetalStackClusterStatus, out *v1alpha4.MetalStackClusterStatus, s conversion.Scope) error {
 	out.Ready = in.Ready
 	out.ControlPlaneIPAllocated = in.ControlPlaneIPAllocated
@@ -331,14 +328,14 @@ func autoConvert_v1alpha4_MetalStackClusterStatus_To_v1alpha3_MetalStackClusterS
 	out.ControlPlaneIPAllocated = in.ControlPlaneIPAllocated
 	out.FailureReason = (*errors.ClusterStatusError)(unsafe.Pointer(in.FailureReason))
 	out.FailureMessage = (*string)(unsafe.Pointer(in.FailureMessage))
+	// WARNING: in.Capacity requires manual conversion: does not exist in peer-type
+	// WARNING: in.Conditions requires manual conversion: does not exist in peer-type
+	// WARNING: in.Firewalls requires manual conversion: does not exist in peer-type
+	// WARNING: in.FirewallUpdate requires manual conversion: does not exist in peer-type
+	// WARNING: in.EgressIPs requires manual conversion: does not exist in peer-type
 	return nil
 }
 
-// Convert_v1alpha4_MetalStackClusterStatus_To_v1alpha3_MetalStackClusterStatus is an autogenerated conversion function.
-func Convert_v1alpha4_MetalStackClusterStatus_To_v1alpha3_MetalStackClusterStatus(in *v1alpha4.MetalStackClusterStatus, out *MetalStackClusterStatus, s conversion.Scope) error {
-	return autoConvert_v1alpha4_MetalStackClusterStatus_To_v1alpha3_MetalStackClusterStatus(in, out, s)
-}
-
 func autoConvert_v1alpha3_MetalStackFirewall_To_v1alpha4_MetalStackFirewall(in *MetalStackFirewall, out *v1alpha4.MetalStackFirewall, s conversion.Scope) error {
 	out.ObjectMeta = in.ObjectMeta
 	if err := Convert_v1alpha3_MetalStackFirewallSpec_To_v1alpha4_MetalStackFirewallSpec(&in.Spec, &out.Spec, s); err != nil {
@@ -373,7 +370,17 @@ func Convert_v1alpha4_MetalStackFirewall_To_v1alpha3_MetalStackFirewall(in *v1al
 
 func autoConvert_v1alpha3_MetalStackFirewallList_To_v1alpha4_MetalStackFirewallList(in *MetalStackFirewallList, out *v1alpha4.MetalStackFirewallList, s conversion.Scope) error {
 	out.ListMeta = in.ListMeta
-	out.Items = *(*[]v1alpha4.MetalStackFirewall)(unsafe.Pointer(&in.Items))
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]v1alpha4.MetalStackFirewall, len(*in))
+		for i := range *in {
+			if err := Convert_v1alpha3_MetalStackFirewall_To_v1alpha4_MetalStackFirewall(&(*in)[i], &(*out)[i], s); err != nil {
+				return err
+			}
+		}
+	} else {
+		out.Items = nil
+	}
 	return nil
 }
 
@@ -384,7 +391,17 @@ func Convert_v1alpha3_MetalStackFirewallList_To_v1alpha4_MetalStackFirewallList(
 
 func autoConvert_v1alpha4_MetalStackFirewallList_To_v1alpha3_MetalStackFirewallList(in *v1alpha4.MetalStackFirewallList, out *MetalStackFirewallList, s conversion.Scope) error {
 	out.ListMeta = in.ListMeta
-	out.Items = *(*[]MetalStackFirewall)(unsafe.Pointer(&in.Items))
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]MetalStackFirewall, len(*in))
+		for i := range *in {
+			if err := Convert_v1alpha4_MetalStackFirewall_To_v1alpha3_MetalStackFirewall(&(*in)[i], &(*out)[i], s); err != nil {
+				return err
+			}
+		}
+	} else {
+		out.Items = nil
+	}
 	return nil
 }
 
@@ -411,14 +428,16 @@ func autoConvert_v1alpha4_MetalStackFirewallSpec_To_v1alpha3_MetalStackFirewallS
 	out.MachineType = in.MachineType
 	out.ProviderID = (*string)(unsafe.Pointer(in.ProviderID))
 	out.SSHKeys = *(*[]string)(unsafe.Pointer(&in.SSHKeys))
+	// WARNING: in.EgressIPs requires manual conversion: does not exist in peer-type
+	// WARNING: in.FirewallController requires manual conversion: does not exist in peer-type
+	// WARNING: in.Files requires manual conversion: does not exist in peer-type
+	// WARNING: in.SystemdUnits requires manual conversion: does not exist in peer-type
+	// WARNING: in.DNSServers requires manual conversion: does not exist in peer-type
+	// WARNING: in.NTPServers requires manual conversion: does not exist in peer-type
+	// WARNING: in.Syslog requires manual conversion: does not exist in peer-type
 	return nil
 }
 
-// Convert_v1alpha4_MetalStackFirewallSpec_To_v1alpha3_MetalStackFirewallSpec is an autogenerated conversion function.
-func Convert_v1alpha4_MetalStackFirewallSpec_To_v1alpha3_MetalStackFirewallSpec(in *v1alpha4.MetalStackFirewallSpec, out *MetalStackFirewallSpec, s conversion.Scope) error {
-	return autoConvert_v1alpha4_MetalStackFirewallSpec_To_v1alpha3_MetalStackFirewallSpec(in, out, s)
-}
-
 func autoConvert_v1alpha3_MetalStackFirewallStatus_To_v1alpha4_MetalStackFirewallStatus(in *MetalStackFirewallStatus, out *v1alpha4.MetalStackFirewallStatus, s conversion.Scope) error {
 	out.Ready = in.Ready
 	return nil
@@ -431,14 +450,17 @@ func Convert_v1alpha3_MetalStackFirewallStatus_To_v1alpha4_MetalStackFirewallSta
 
 func autoConvert_v1alpha4_MetalStackFirewallStatus_To_v1alpha3_MetalStackFirewallStatus(in *v1alpha4.MetalStackFirewallStatus, out *MetalStackFirewallStatus, s conversion.Scope) error {
 	out.Ready = in.Ready
+	// WARNING: in.Addresses requires manual conversion: does not exist in peer-type
+	// WARNING: in.Liveliness requires manual conversion: does not exist in peer-type
+	// WARNING: in.AllocatedAt requires manual conversion: does not exist in peer-type
+	// WARNING: in.Image requires manual conversion: does not exist in peer-type
+	// WARNING: in.Conditions requires manual conversion: does not exist in peer-type
+	// WARNING: in.CredentialsExpireAt requires manual conversion: does not exist in peer-type
+	// WARNING: in.ControllerVersion requires manual conversion: does not exist in peer-type
+	// WARNING: in.ControllerHeartbeat requires manual conversion: does not exist in peer-type
 	return nil
 }
 
-// Convert_v1alpha4_MetalStackFirewallStatus_To_v1alpha3_MetalStackFirewallStatus is an autogenerated conversion function.
-func Convert_v1alpha4_MetalStackFirewallStatus_To_v1alpha3_MetalStackFirewallStatus(in *v1alpha4.MetalStackFirewallStatus, out *MetalStackFirewallStatus, s conversion.Scope) error {
-	return autoConvert_v1alpha4_MetalStackFirewallStatus_To_v1alpha3_MetalStackFirewallStatus(in, out, s)
-}
-
 func autoConvert_v1alpha3_MetalStackMachine_To_v1alpha4_MetalStackMachine(in *MetalStackMachine, out *v1alpha4.MetalStackMachine, s conversion.Scope) error {
 	out.ObjectMeta = in.ObjectMeta
 	if err := Convert_v1alpha3_MetalStackMachineSpec_To_v1alpha4_MetalStackMachineSpec(&in.Spec, &out.Spec, s); err != nil {
@@ -473,7 +495,17 @@ func Convert_v1alpha4_MetalStackMachine_To_v1alpha3_MetalStackMachine(in *v1alph
 
 func autoConvert_v1alpha3_MetalStackMachineList_To_v1alpha4_MetalStackMachineList(in *MetalStackMachineList, out *v1alpha4.MetalStackMachineList, s conversion.Scope) error {
 	out.ListMeta = in.ListMeta
-	out.Items = *(*[]v1alpha4.MetalStackMachine)(unsafe.Pointer(&in.Items))
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]v1alpha4.MetalStackMachine, len(*in))
+		for i := range *in {
+			if err := Convert_v1alpha3_MetalStackMachine_To_v1alpha4_MetalStackMachine(&(*in)[i], &(*out)[i], s); err != nil {
+				return err
+			}
+		}
+	} else {
+		out.Items = nil
+	}
 	return nil
 }
 
@@ -484,7 +516,17 @@ func Convert_v1alpha3_MetalStackMachineList_To_v1alpha4_MetalStackMachineList(in
 
 func autoConvert_v1alpha4_MetalStackMachineList_To_v1alpha3_MetalStackMachineList(in *v1alpha4.MetalStackMachineList, out *MetalStackMachineList, s conversion.Scope) error {
 	out.ListMeta = in.ListMeta
-	out.Items = *(*[]MetalStackMachine)(unsafe.Pointer(&in.Items))
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]MetalStackMachine, len(*in))
+		for i := range *in {
+			if err := Convert_v1alpha4_MetalStackMachine_To_v1alpha3_MetalStackMachine(&(*in)[i], &(*out)[i], s); err != nil {
+				return err
+			}
+		}
+	} else {
+		out.Items = nil
+	}
 	return nil
 }
 
@@ -513,14 +555,11 @@ func autoConvert_v1alpha4_MetalStackMachineSpec_To_v1alpha3_MetalStackMachineSpe
 	out.ProviderID = (*string)(unsafe.Pointer(in.ProviderID))
 	out.SSHKeys = *(*[]string)(unsafe.Pointer(&in.SSHKeys))
 	out.Tags = *(*[]string)(unsafe.Pointer(&in.Tags))
+	// WARNING: in.Remediation requires manual conversion: does not exist in peer-type
+	// WARNING: in.HostSelector requires manual conversion: does not exist in peer-type
 	return nil
 }
 
-// Convert_v1alpha4_MetalStackMachineSpec_To_v1alpha3_MetalStackMachineSpec is an autogenerated conversion function.
-func Convert_v1alpha4_MetalStackMachineSpec_To_v1alpha3_MetalStackMachineSpec(in *v1alpha4.MetalStackMachineSpec, out *MetalStackMachineSpec, s conversion.Scope) error {
-	return autoConvert_v1alpha4_MetalStackMachineSpec_To_v1alpha3_MetalStackMachineSpec(in, out, s)
-}
-
 func autoConvert_v1alpha3_MetalStackMachineStatus_To_v1alpha4_MetalStackMachineStatus(in *MetalStackMachineStatus, out *v1alpha4.MetalStackMachineStatus, s conversion.Scope) error {
 	out.Addresses = *(*[]v1.NodeAddress)(unsafe.Pointer(&in.Addresses))
 	out.ErrorReason = (*errors.MachineStatusError)(unsafe.Pointer(in.ErrorReason))
@@ -547,14 +586,12 @@ func autoConvert_v1alpha4_MetalStackMachineStatus_To_v1alpha3_MetalStackMachineS
 	out.InstanceStatus = (*MetalStackResourceStatus)(unsafe.Pointer(in.InstanceStatus))
 	out.LLDP = in.LLDP
 	out.Ready = in.Ready
+	// WARNING: in.Conditions requires manual conversion: does not exist in peer-type
+	// WARNING: in.Remediation requires manual conversion: does not exist in peer-type
+	// WARNING: in.HostCandidates requires manual conversion: does not exist in peer-type
 	return nil
 }
 
-// Convert_v1alpha4_MetalStackMachineStatus_To_v1alpha3_MetalStackMachineStatus is an autogenerated conversion function.
-func Convert_v1alpha4_MetalStackMachineStatus_To_v1alpha3_MetalStackMachineStatus(in *v1alpha4.MetalStackMachineStatus, out *MetalStackMachineStatus, s conversion.Scope) error {
-	return autoConvert_v1alpha4_MetalStackMachineStatus_To_v1alpha3_MetalStackMachineStatus(in, out, s)
-}
-
 func autoConvert_v1alpha3_MetalStackMachineTemplate_To_v1alpha4_MetalStackMachineTemplate(in *MetalStackMachineTemplate, out *v1alpha4.MetalStackMachineTemplate, s conversion.Scope) error {
 	out.ObjectMeta = in.ObjectMeta
 	if err := Convert_v1alpha3_MetalStackMachineTemplateSpec_To_v1alpha4_MetalStackMachineTemplateSpec(&in.Spec, &out.Spec, s); err != nil {
@@ -583,7 +620,17 @@ func Convert_v1alpha4_MetalStackMachineTemplate_To_v1alpha3_MetalStackMachineTem
 
 func autoConvert_v1alpha3_MetalStackMachineTemplateList_To_v1alpha4_MetalStackMachineTemplateList(in *MetalStackMachineTemplateList, out *v1alpha4.MetalStackMachineTemplateList, s conversion.Scope) error {
 	out.ListMeta = in.ListMeta
-	out.Items = *(*[]v1alpha4.MetalStackMachineTemplate)(unsafe.Pointer(&in.Items))
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]v1alpha4.MetalStackMachineTemplate, len(*in))
+		for i := range *in {
+			if err := Convert_v1alpha3_MetalStackMachineTemplate_To_v1alpha4_MetalStackMachineTemplate(&(*in)[i], &(*out)[i], s); err != nil {
+				return err
+			}
+		}
+	} else {
+		out.Items = nil
+	}
 	return nil
 }
 
@@ -594,7 +641,17 @@ func Convert_v1alpha3_MetalStackMachineTemplateList_To_v1alpha4_MetalStackMachin
 
 func autoConvert_v1alpha4_MetalStackMachineTemplateList_To_v1alpha3_MetalStackMachineTemplateList(in *v1alpha4.MetalStackMachineTemplateList, out *MetalStackMachineTemplateList, s conversion.Scope) error {
 	out.ListMeta = in.ListMeta
-	out.Items = *(*[]MetalStackMachineTemplate)(unsafe.Pointer(&in.Items))
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]MetalStackMachineTemplate, len(*in))
+		for i := range *in {
+			if err := Convert_v1alpha4_MetalStackMachineTemplate_To_v1alpha3_MetalStackMachineTemplate(&(*in)[i], &(*out)[i], s); err != nil {
+				return err
+			}
+		}
+	} else {
+		out.Items = nil
+	}
 	return nil
 }
 
@@ -0,0 +1,88 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha4
+
+import (
+	"sigs.k8s.io/cluster-api/api/v1alpha4"
+)
+
+// Conditions and condition Reasons for the MetalStackCluster object
+
+const (
+	// FirewallReadyCondition reports on the readiness of the firewall of the cluster.
+	FirewallReadyCondition v1alpha4.ConditionType = "FirewallReady"
+
+	// FirewallProvisioningReason (Severity=Info) documents a cluster waiting for its firewall to be ready.
+	FirewallProvisioningReason = "FirewallProvisioning"
+	// FirewallCreationFailedReason (Severity=Warning) documents that the MetalStackFirewall of the cluster couldn't be created.
+	FirewallCreationFailedReason = "FirewallCreationFailed"
+	// EgressIPFailedReason (Severity=Warning) documents that an egress IP of the firewalls couldn't be allocated or verified.
+	EgressIPFailedReason = "EgressIPFailed"
+)
+
+// Conditions and condition Reasons for the MetalStackFirewall object
+
+const (
+	// FirewallAllocatedCondition reports whether the allocation of the firewall machine succeeded.
+	// The health of the firewall machine is reported by the MachineHealthyCondition.
+	FirewallAllocatedCondition v1alpha4.ConditionType = "Allocated"
+
+	// FirewallAllocatingReason (Severity=Info) documents a firewall whose machine is being allocated.
+	FirewallAllocatingReason = "Allocating"
+
+	// FirewallControllerReadyCondition reports whether the firewall-controller of the firewall reports to the workload cluster.
+	FirewallControllerReadyCondition v1alpha4.ConditionType = "FirewallControllerReady"
+
+	// FirewallControllerNotDeployedReason (Severity=Info) documents a firewall provisioned without firewall-controller.
+	FirewallControllerNotDeployedReason = "FirewallControllerNotDeployed"
+	// FirewallControllerStatusUnknownReason (Severity=Warning) documents that the status of the firewall-controller couldn't be read.
+	FirewallControllerStatusUnknownReason = "FirewallControllerStatusUnknown"
+	// FirewallControllerNotReportedReason (Severity=Warning) documents a firewall-controller which didn't report since the firewall was created.
+	FirewallControllerNotReportedReason = "FirewallControllerNotReported"
+	// FirewallControllerHeartbeatMissedReason (Severity=Warning) documents a firewall-controller whose last heartbeat is outdated.
+	FirewallControllerHeartbeatMissedReason = "FirewallControllerHeartbeatMissed"
+)
+
+// Conditions and condition Reasons for the MetalStackMachine object
+
+const (
+	// MachineHealthyCondition reports on the health of the metal-stack machine as seen by `metal-API`.
+	MachineHealthyCondition v1alpha4.ConditionType = "MachineHealthy"
+
+	// MachineHealthCheckFailedReason (Severity=Warning) documents that the machine couldn't be read from `metal-API`.
+	MachineHealthCheckFailedReason = "MachineHealthCheckFailed"
+	// MachineLivelinessUnknownReason (Severity=Warning) documents a machine whose liveliness isn't known to `metal-API`.
+	MachineLivelinessUnknownReason = "MachineLivelinessUnknown"
+	// MachineDeadReason (Severity=Error) documents a machine reported as dead by `metal-API`.
+	MachineDeadReason = "MachineDead"
+	// MachineCrashedReason (Severity=Error) documents a machine whose last provisioning event is a crash.
+	MachineCrashedReason = "MachineCrashed"
+	// MachineReleasedReason (Severity=Error) documents a machine which isn't allocated anymore.
+	MachineReleasedReason = "MachineReleased"
+	// MachineRemediatingReason (Severity=Warning) documents a machine which is being soft remediated.
+	MachineRemediatingReason = "MachineRemediating"
+)
+
+const (
+	// MachineCapacityAvailableCondition reports whether the partition has a free machine of the size to allocate.
+	MachineCapacityAvailableCondition v1alpha4.ConditionType = "CapacityAvailable"
+
+	// InsufficientCapacityReason (Severity=Warning) documents a machine waiting for a free machine of its size in the partition.
+	InsufficientCapacityReason = "InsufficientCapacity"
+	// CapacityCheckFailedReason (Severity=Warning) documents that the capacity of the partition couldn't be read from `metal-API`.
+	CapacityCheckFailedReason = "CapacityCheckFailed"
+)
@@ -31,6 +31,10 @@ import (
 
 const (
 	MetalStackClusterFinalizer = "metalstackcluster.infrastructure.cluster.x-k8s.io"
+
+	// ClusterIDAnnotation keeps the ID the metal-stack resources of the cluster are tagged with.
+	// It's the UID of the MetalStackCluster it was set on first, so the tag survives `clusterctl move`.
+	ClusterIDAnnotation = "metalstackcluster.infrastructure.cluster.x-k8s.io/cluster-id"
 )
 
 // MetalStackClusterSpec defines the desired state of MetalStackCluster
@@ -56,6 +60,17 @@ type MetalStackClusterSpec struct {
 
 	// FirewallSpec is spec for MetalStackFirewall resource
 	FirewallSpec MetalStackFirewallSpec `json:"firewallSpec,omitempty"`
+
+	// FirewallReplicas is the number of firewalls of the cluster, each in another rack.
+	// The cluster is ready once a majority of them is ready. Defaults to 1.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	FirewallReplicas *int32 `json:"firewallReplicas,omitempty"`
+
+	// DisableFirewall opts out of the firewall for setups without one.
+	// The cluster gets ready without waiting for a firewall.
+	// +optional
+	DisableFirewall bool `json:"disableFirewall,omitempty"`
 }
 
 // MetalStackClusterStatus defines the observed state of MetalStackCluster
@@ -79,6 +94,89 @@ type MetalStackClusterStatus struct {
 	// Meant to be a more descriptive value than failureReason
 	// +optional
 	FailureMessage *string `json:"failureMessage,omitempty"`
+
+	// Capacity is the capacity of the machine sizes in the partition of the cluster.
+	// +optional
+	Capacity []SizeCapacity `json:"capacity,omitempty"`
+
+	// Conditions defines current service state of the MetalStackCluster.
+	// +optional
+	Conditions v1alpha4.Conditions `json:"conditions,omitempty"`
+
+	// Firewalls are the names of the MetalStackFirewalls which route the traffic of the cluster, indexed by replica.
+	// A missing name defaults to the name of the cluster for the first replica
+	// and to the name of the cluster suffixed by the replica for the others.
+	// +optional
+	Firewalls []string `json:"firewalls,omitempty"`
+
+	// FirewallUpdate tracks the rolling update of a firewall, if one is in progress.
+	// +optional
+	FirewallUpdate *FirewallUpdate `json:"firewallUpdate,omitempty"`
+
+	// EgressIPs are the static egress IPs of the firewalls.
+	// +optional
+	EgressIPs []EgressIPStatus `json:"egressIPs,omitempty"`
+}
+
+// EgressIPStatus is a static egress IP of the firewalls of the cluster.
+type EgressIPStatus struct {
+	// Name is the name of the egress IP in the firewall spec.
+	Name string `json:"name"`
+
+	// IP is the address of the egress IP.
+	IP string `json:"ip"`
+
+	// Allocated is true if the IP was allocated by the controller, which releases it when the cluster is deleted.
+	// +optional
+	Allocated bool `json:"allocated,omitempty"`
+}
+
+// GetEgressIP returns the address of the egress IP with the name, if it's allocated.
+func (st *MetalStackClusterStatus) GetEgressIP(name string) (string, bool) {
+	for _, egressIP := range st.EgressIPs {
+		if egressIP.Name == name {
+			return egressIP.IP, true
+		}
+	}
+	return "", false
+}
+
+// FirewallUpdatePhase is the phase of a rolling update of the firewall.
+type FirewallUpdatePhase string
+
+const (
+	// FirewallUpdateProvisioning waits for the new firewall to be ready.
+	FirewallUpdateProvisioning FirewallUpdatePhase = "Provisioning"
+	// FirewallUpdateDeleting waits for the old firewall to be deleted, after the traffic moved to the new one.
+	FirewallUpdateDeleting FirewallUpdatePhase = "Deleting"
+)
+
+// FirewallUpdate is a rolling update of a firewall of a cluster.
+type FirewallUpdate struct {
+	// Phase is the phase of the update.
+	Phase FirewallUpdatePhase `json:"phase"`
+
+	// Replica is the replica of the firewall which is updated.
+	// +optional
+	Replica int32 `json:"replica,omitempty"`
+
+	// Firewall is the name of the MetalStackFirewall replacing the current one.
+	Firewall string `json:"firewall"`
+
+	// StartTime is the time the update started.
+	StartTime metav1.Time `json:"startTime"`
+}
+
+// SizeCapacity is the capacity of a machine size in a partition.
+type SizeCapacity struct {
+	// Size is the ID of the machine size
+	Size string `json:"size"`
+
+	// Free is the number of machines which can be allocated
+	Free int32 `json:"free"`
+
+	// Total is the number of machines of the size
+	Total int32 `json:"total"`
 }
 
 // +kubebuilder:subresource:status
@@ -96,15 +194,67 @@ type MetalStackCluster struct {
 
 func (*MetalStackCluster) Hub() {}
 
-func (cluster *MetalStackCluster) GetFirewallNamespacedName() types.NamespacedName {
+// GetFirewallReplicas returns the number of firewalls of the cluster.
+func (cluster *MetalStackCluster) GetFirewallReplicas() int32 {
+	if cluster.Spec.FirewallReplicas == nil {
+		return 1
+	}
+	return *cluster.Spec.FirewallReplicas
+}
+
+// GetFirewallNamespacedName returns the name of the MetalStackFirewall of the replica which routes the traffic of the cluster.
+func (cluster *MetalStackCluster) GetFirewallNamespacedName(replica int32) types.NamespacedName {
+	name := cluster.Name
+	if replica > 0 {
+		name = fmt.Sprintf("%s-%d", cluster.Name, replica)
+	}
+	if int(replica) < len(cluster.Status.Firewalls) && cluster.Status.Firewalls[replica] != "" {
+		name = cluster.Status.Firewalls[replica]
+	}
+
 	return types.NamespacedName{
 		Namespace: cluster.Namespace,
-		Name:      cluster.Name,
+		Name:      name,
 	}
 }
 
+// SetFirewallName sets the name of the MetalStackFirewall of the replica.
+func (cluster *MetalStackCluster) SetFirewallName(replica int32, name string) {
+	for int(replica) >= len(cluster.Status.Firewalls) {
+		cluster.Status.Firewalls = append(cluster.Status.Firewalls, "")
+	}
+	cluster.Status.Firewalls[replica] = name
+}
+
+// GetClusterID returns the ID the metal-stack resources of the cluster are tagged with.
+func (cluster *MetalStackCluster) GetClusterID() string {
+	if id := cluster.Annotations[ClusterIDAnnotation]; id != "" {
+		return id
+	}
+	return string(cluster.UID)
+}
+
+// SetClusterID pins the ID of the cluster, so that it doesn't change when the MetalStackCluster is recreated.
+func (cluster *MetalStackCluster) SetClusterID() {
+	if cluster.Annotations[ClusterIDAnnotation] != "" {
+		return
+	}
+	if cluster.Annotations == nil {
+		cluster.Annotations = make(map[string]string)
+	}
+	cluster.Annotations[ClusterIDAnnotation] = string(cluster.UID)
+}
+
 func (cluster *MetalStackCluster) GetClusterIDTag() string {
-	return fmt.Sprintf("%s=%s", tag.ClusterID, cluster.UID)
+	return fmt.Sprintf("%s=%s", tag.ClusterID, cluster.GetClusterID())
+}
+
+func (cluster *MetalStackCluster) GetConditions() v1alpha4.Conditions {
+	return cluster.Status.Conditions
+}
+
+func (cluster *MetalStackCluster) SetConditions(conditions v1alpha4.Conditions) {
+	cluster.Status.Conditions = conditions
 }
 
 // +kubebuilder:object:root=true
@@ -17,8 +17,12 @@ limitations under the License.
 package v1alpha4
 
 import (
+	"strconv"
+
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/utils/pointer"
+	"sigs.k8s.io/cluster-api/api/v1alpha4"
 	"sigs.k8s.io/cluster-api/controllers/noderefutil"
 )
 
@@ -27,6 +31,18 @@ import (
 
 const MetalStackFirewallFinalizer = "metalstackfirewall.infrastructure.cluster.x-k8s.io"
 
+// FirewallReplicaLabel is the label of a MetalStackFirewall with the replica it belongs to.
+// A firewall without the label belongs to the first replica.
+const FirewallReplicaLabel = "metalstackfirewall.infrastructure.cluster.x-k8s.io/replica"
+
+// FirewallCredentialsExpireAtAnnotation keeps the expiry of the firewall-controller credentials the firewall was provisioned with,
+// so that it's recovered when the MetalStackFirewall is recreated by `clusterctl move`.
+const FirewallCredentialsExpireAtAnnotation = "metalstackfirewall.infrastructure.cluster.x-k8s.io/credentials-expire-at"
+
+// FirewallImportedAnnotation marks a firewall which was imported from a cluster built without Cluster API.
+// It was provisioned without firewall-controller credentials, so it isn't replaced once they are issued.
+const FirewallImportedAnnotation = "metalstackfirewall.infrastructure.cluster.x-k8s.io/imported"
+
 // MetalStackFirewallSpec defines the desired state of MetalStackFirewall
 type MetalStackFirewallSpec struct {
 	// OS image
@@ -42,6 +58,130 @@ type MetalStackFirewallSpec struct {
 	// public SSH keys for machine
 	// +optional
 	SSHKeys []string `json:"sshKeys,omitempty"`
+
+	// EgressIPs are static IPs of the public network the egress traffic of the cluster leaves through.
+	// They're attached to every firewall of the cluster on creation.
+	// +optional
+	EgressIPs []EgressIP `json:"egressIPs,omitempty"`
+
+	// FirewallController selects the firewall-controller binary to install.
+	// The binary shipped with the image is used if it's not set.
+	// +optional
+	FirewallController *FirewallControllerSpec `json:"firewallController,omitempty"`
+
+	// Files are additional files written to the firewall, with contents from Secrets or ConfigMaps in the namespace of the firewall.
+	// +optional
+	Files []FirewallFile `json:"files,omitempty"`
+
+	// SystemdUnits are additional systemd units of the firewall, or drop-ins of its existing units.
+	// +optional
+	SystemdUnits []FirewallSystemdUnit `json:"systemdUnits,omitempty"`
+
+	// DNSServers are the DNS servers the firewall resolves names with.
+	// +optional
+	DNSServers []string `json:"dnsServers,omitempty"`
+
+	// NTPServers are the NTP servers the firewall synchronizes its clock with.
+	// +optional
+	NTPServers []string `json:"ntpServers,omitempty"`
+
+	// Syslog forwards the logs of the firewall to a remote syslog server.
+	// +optional
+	Syslog *FirewallSyslog `json:"syslog,omitempty"`
+}
+
+// EgressIP is a static IP of the public network.
+type EgressIP struct {
+	// Name identifies the egress IP. An IP allocated by the controller is named after the cluster and the name.
+	Name string `json:"name"`
+
+	// IP is an existing static IP of the project in the public network.
+	// The controller allocates a static IP if it's not set.
+	// +optional
+	IP string `json:"ip,omitempty"`
+}
+
+// FirewallControllerSpec selects the firewall-controller binary which is downloaded on provisioning.
+type FirewallControllerSpec struct {
+	// Version is the release of firewall-controller to download from GitHub, e.g. v1.0.10.
+	// +optional
+	Version string `json:"version,omitempty"`
+
+	// URL to download the firewall-controller binary from. It takes precedence over Version.
+	// +optional
+	URL string `json:"url,omitempty"`
+
+	// SHA512 is the hex encoded SHA512 checksum of the binary, verified after the download.
+	// It's required, since the binary runs with the credentials of the cluster.
+	// +kubebuilder:validation:Pattern=`^[0-9a-f]{128}$`
+	SHA512 string `json:"sha512"`
+}
+
+// FirewallFile is a file written to the firewall on provisioning.
+type FirewallFile struct {
+	// Path is the absolute path of the file.
+	Path string `json:"path"`
+
+	// Mode is the permission of the file. Defaults to 0644.
+	// +optional
+	Mode *int32 `json:"mode,omitempty"`
+
+	// ContentFrom is the source of the contents of the file.
+	ContentFrom FirewallFileSource `json:"contentFrom"`
+}
+
+// FirewallFileSource references the key of a Secret or a ConfigMap. Exactly one of them must be set.
+type FirewallFileSource struct {
+	// Secret references a key of a Secret.
+	// +optional
+	Secret *corev1.SecretKeySelector `json:"secret,omitempty"`
+
+	// ConfigMap references a key of a ConfigMap.
+	// +optional
+	ConfigMap *corev1.ConfigMapKeySelector `json:"configMap,omitempty"`
+}
+
+// FirewallSystemdUnit is a systemd unit of the firewall.
+type FirewallSystemdUnit struct {
+	// Name of the unit, e.g. node-exporter.service.
+	Name string `json:"name"`
+
+	// Enabled enables the unit. Defaults to true if the unit has contents.
+	// +optional
+	Enabled *bool `json:"enabled,omitempty"`
+
+	// Contents of the unit. An existing unit of the image is kept if it's empty.
+	// +optional
+	Contents string `json:"contents,omitempty"`
+
+	// Dropins are drop-ins of the unit.
+	// +optional
+	Dropins []FirewallSystemdDropin `json:"dropins,omitempty"`
+}
+
+// FirewallSystemdDropin is a drop-in of a systemd unit.
+type FirewallSystemdDropin struct {
+	// Name of the drop-in, e.g. proxy.conf.
+	Name string `json:"name"`
+
+	// Contents of the drop-in.
+	Contents string `json:"contents"`
+}
+
+// FirewallSyslog is a remote syslog server.
+type FirewallSyslog struct {
+	// Server is the hostname or IP of the syslog server.
+	Server string `json:"server"`
+
+	// Port of the syslog server. Defaults to 514.
+	// +optional
+	Port *int32 `json:"port,omitempty"`
+
+	// Protocol is the transport protocol of the syslog server.
+	// +kubebuilder:validation:Enum=udp;tcp
+	// +kubebuilder:default=udp
+	// +optional
+	Protocol string `json:"protocol,omitempty"`
 }
 
 func (s *MetalStackFirewallSpec) ParsedProviderID() (string, error) {
@@ -60,13 +200,78 @@ func (s *MetalStackFirewallSpec) SetProviderID(ID string) {
 	s.ProviderID = pointer.StringPtr("metalstack://" + ID)
 }
 
+// GetReplica returns the replica the firewall belongs to.
+func (f *MetalStackFirewall) GetReplica() int32 {
+	replica, err := strconv.ParseInt(f.Labels[FirewallReplicaLabel], 10, 32)
+	if err != nil {
+		return 0
+	}
+	return int32(replica)
+}
+
 // MetalStackFirewallStatus defines the observed state of MetalStackFirewall
 type MetalStackFirewallStatus struct {
 	Ready bool `json:"ready,omitempty"`
+
+	// Addresses are the IPs of the firewall per network.
+	// +optional
+	Addresses []FirewallAddresses `json:"addresses,omitempty"`
+
+	// Liveliness is the liveliness of the firewall machine as reported by metal-API.
+	// +optional
+	Liveliness string `json:"liveliness,omitempty"`
+
+	// AllocatedAt is the time the firewall machine was allocated.
+	// +optional
+	AllocatedAt *metav1.Time `json:"allocatedAt,omitempty"`
+
+	// Image is the ID of the image the firewall machine was provisioned with.
+	// +optional
+	Image string `json:"image,omitempty"`
+
+	// Conditions defines current service state of the MetalStackFirewall.
+	// +optional
+	Conditions v1alpha4.Conditions `json:"conditions,omitempty"`
+
+	// CredentialsExpireAt is the expiry of the firewall-controller credentials the firewall was provisioned with.
+	// It's not set if the firewall was provisioned without firewall-controller.
+	// +optional
+	CredentialsExpireAt *metav1.Time `json:"credentialsExpireAt,omitempty"`
+
+	// ControllerVersion is the version of the firewall-controller running on the firewall.
+	// +optional
+	ControllerVersion string `json:"controllerVersion,omitempty"`
+
+	// ControllerHeartbeat is the last time the firewall-controller reported to the workload cluster.
+	// +optional
+	ControllerHeartbeat *metav1.Time `json:"controllerHeartbeat,omitempty"`
 }
 
+// FirewallAddresses are the IPs of a firewall in a network.
+type FirewallAddresses struct {
+	// NetworkID is the ID of the network in metal-stack.
+	NetworkID string `json:"networkID"`
+
+	// NetworkType is the type of the network, e.g. privateprimaryunshared or external.
+	// +optional
+	NetworkType string `json:"networkType,omitempty"`
+
+	// IPs are the addresses of the firewall in the network.
+	// +optional
+	IPs []string `json:"ips,omitempty"`
+}
+
+// +kubebuilder:subresource:status
 // +kubebuilder:object:root=true
 // +kubebuilder:storageversion
+// +kubebuilder:printcolumn:name="Cluster",type="string",JSONPath=".metadata.labels.cluster\\.x-k8s\\.io/cluster-name",description="Cluster to which this MetalStackFirewall belongs"
+// +kubebuilder:printcolumn:name="Ready",type="string",JSONPath=".status.ready",description="Firewall ready status"
+// +kubebuilder:printcolumn:name="Liveliness",type="string",JSONPath=".status.liveliness",description="Liveliness of the firewall machine"
+// +kubebuilder:printcolumn:name="Image",type="string",JSONPath=".status.image",description="Image of the firewall machine"
+// +kubebuilder:printcolumn:name="Controller",type="string",JSONPath=".status.controllerVersion",description="Version of the firewall-controller"
+// +kubebuilder:printcolumn:name="Heartbeat",type="date",JSONPath=".status.controllerHeartbeat",description="Last heartbeat of the firewall-controller"
+// +kubebuilder:printcolumn:name="InstanceID",type="string",JSONPath=".spec.providerID",description="MetalStack instance ID",priority=1
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
 
 // MetalStackFirewall is the Schema for the metalstackfirewalls API
 type MetalStackFirewall struct {
@@ -79,6 +284,14 @@ type MetalStackFirewall struct {
 
 func (*MetalStackFirewall) Hub() {}
 
+func (f *MetalStackFirewall) GetConditions() v1alpha4.Conditions {
+	return f.Status.Conditions
+}
+
+func (f *MetalStackFirewall) SetConditions(conditions v1alpha4.Conditions) {
+	f.Status.Conditions = conditions
+}
+
 // +kubebuilder:object:root=true
 
 // MetalStackFirewallList contains a list of MetalStackFirewall
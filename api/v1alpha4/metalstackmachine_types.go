@@ -20,8 +20,10 @@ import (
 	"errors"
 
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/utils/pointer"
+	"sigs.k8s.io/cluster-api/api/v1alpha4"
 	"sigs.k8s.io/cluster-api/controllers/noderefutil"
 	clustererr "sigs.k8s.io/cluster-api/errors"
 )
@@ -31,6 +33,44 @@ import (
 
 const (
 	MetalStackMachineFinalizer = "metalstackmachine.infrastructure.cluster.x-k8s.io"
+
+	// RemediationAnnotation requests a soft remediation of the MetalStackMachine.
+	// The value is the RemediationAction to apply.
+	RemediationAnnotation = "metalstackmachine.infrastructure.cluster.x-k8s.io/remediation"
+
+	// DefaultRemediationRetryLimit is the retry limit if none is specified.
+	DefaultRemediationRetryLimit = 3
+)
+
+// RemediationAction is the action applied to the hardware of an unhealthy machine.
+// +kubebuilder:validation:Enum=PowerReset;PowerCycle;Reinstall
+type RemediationAction string
+
+const (
+	// RemediationActionPowerReset resets the power of the machine through `metal-API`.
+	RemediationActionPowerReset = RemediationAction("PowerReset")
+	// RemediationActionPowerCycle powers the machine off and on again through its BMC.
+	RemediationActionPowerCycle = RemediationAction("PowerCycle")
+	// RemediationActionReinstall reinstalls the OS image on the same machine.
+	RemediationActionReinstall = RemediationAction("Reinstall")
+)
+
+// IsValid checks if the action is a known remediation action.
+func (a RemediationAction) IsValid() bool {
+	switch a {
+	case RemediationActionPowerReset, RemediationActionPowerCycle, RemediationActionReinstall:
+		return true
+	}
+	return false
+}
+
+// RemediationResult is the result of a soft remediation.
+type RemediationResult string
+
+const (
+	RemediationResultSucceeded          = RemediationResult("Succeeded")
+	RemediationResultFailed             = RemediationResult("Failed")
+	RemediationResultRetryLimitExceeded = RemediationResult("RetryLimitExceeded")
 )
 
 var ProviderIDNotSet = errors.New("ProviderID is not set")
@@ -57,6 +97,78 @@ type MetalStackMachineSpec struct {
 	// Set of tags to add to Metal Stack machine
 	// +optional
 	Tags []string `json:"tags,omitempty"`
+
+	// Remediation configures the soft remediation of the machine before it's replaced.
+	// +optional
+	Remediation *MetalStackMachineRemediation `json:"remediation,omitempty"`
+
+	// HostSelector restricts the machines of the size which may be allocated.
+	// It's ignored if the ProviderID is set.
+	// +optional
+	HostSelector *HostSelector `json:"hostSelector,omitempty"`
+}
+
+// HostSelector matches Metal Stack machines by their tags, rack and hardware.
+type HostSelector struct {
+	// Tags which the machine must have
+	// +optional
+	Tags []string `json:"tags,omitempty"`
+
+	// Racks of which the machine must be placed in one
+	// +optional
+	Racks []string `json:"racks,omitempty"`
+
+	// Hardware attributes which the machine must have
+	// +optional
+	Hardware *HardwareSelector `json:"hardware,omitempty"`
+}
+
+// HardwareSelector matches Metal Stack machines by their hardware attributes.
+type HardwareSelector struct {
+	// Number of CPU cores
+	// +optional
+	CPUCores *int64 `json:"cpuCores,omitempty"`
+
+	// Size of the memory
+	// +optional
+	Memory *resource.Quantity `json:"memory,omitempty"`
+
+	// Manufacturer of the product as reported by the FRU
+	// +optional
+	ProductManufacturer *string `json:"productManufacturer,omitempty"`
+
+	// Part number of the product as reported by the FRU
+	// +optional
+	ProductPartNumber *string `json:"productPartNumber,omitempty"`
+}
+
+// MetalStackMachineRemediation configures the soft remediation of a MetalStackMachine.
+type MetalStackMachineRemediation struct {
+	// Action is applied automatically to a dead or crashed machine before it's marked as failed.
+	// +optional
+	Action RemediationAction `json:"action,omitempty"`
+
+	// RetryLimit is the maximum number of soft remediations until the machine stayed healthy for an hour
+	// after the last one. 0 disables soft remediation. Defaults to 3.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	RetryLimit *int32 `json:"retryLimit,omitempty"`
+}
+
+// GetRetryLimit returns the retry limit of soft remediations.
+func (r *MetalStackMachineRemediation) GetRetryLimit() int32 {
+	if r == nil || r.RetryLimit == nil {
+		return DefaultRemediationRetryLimit
+	}
+	return *r.RetryLimit
+}
+
+// GetAction returns the action applied automatically to an unhealthy machine, if any.
+func (r *MetalStackMachineRemediation) GetAction() RemediationAction {
+	if r == nil {
+		return ""
+	}
+	return r.Action
 }
 
 func (spec *MetalStackMachineSpec) ParsedProviderID() (string, error) {
@@ -127,6 +239,39 @@ type MetalStackMachineStatus struct {
 	// Ready is true when the provider resource is ready.
 	// +optional
 	Ready bool `json:"ready"`
+
+	// Conditions defines current service state of the MetalStackMachine.
+	// +optional
+	Conditions v1alpha4.Conditions `json:"conditions,omitempty"`
+
+	// Remediation records the soft remediations of the machine.
+	// +optional
+	Remediation *RemediationStatus `json:"remediation,omitempty"`
+
+	// HostCandidates are the free machines which matched the HostSelector when the machine was allocated.
+	// +optional
+	HostCandidates []string `json:"hostCandidates,omitempty"`
+}
+
+// RemediationStatus records the soft remediations of a MetalStackMachine.
+type RemediationStatus struct {
+	// Action is the last applied remediation action.
+	Action RemediationAction `json:"action"`
+
+	// RetryCount is the number of remediations since the machine stayed healthy for an hour after the last one.
+	RetryCount int32 `json:"retryCount"`
+
+	// LastRemediated is the time of the last remediation.
+	// +optional
+	LastRemediated *metav1.Time `json:"lastRemediated,omitempty"`
+
+	// Result is the result of the last remediation.
+	// +optional
+	Result RemediationResult `json:"result,omitempty"`
+
+	// Message describes the result of the last remediation.
+	// +optional
+	Message string `json:"message,omitempty"`
 }
 
 func (st *MetalStackMachineStatus) Failed() bool {
@@ -138,6 +283,11 @@ func (st *MetalStackMachineStatus) SetFailure(msg string, err clustererr.Machine
 	st.FailureReason = &err
 }
 
+func (st *MetalStackMachineStatus) ClearFailure() {
+	st.FailureMessage = nil
+	st.FailureReason = nil
+}
+
 // +kubebuilder:subresource:status
 // +kubebuilder:object:root=true
 // +kubebuilder:resource:path=metalstackmachines,scope=Namespaced,categories=cluster-api
@@ -159,6 +309,20 @@ type MetalStackMachine struct {
 
 func (*MetalStackMachine) Hub() {}
 
+// RemediationRequested returns the remediation action requested by the RemediationAnnotation.
+func (m *MetalStackMachine) RemediationRequested() (RemediationAction, bool) {
+	action, ok := m.Annotations[RemediationAnnotation]
+	return RemediationAction(action), ok
+}
+
+func (m *MetalStackMachine) GetConditions() v1alpha4.Conditions {
+	return m.Status.Conditions
+}
+
+func (m *MetalStackMachine) SetConditions(conditions v1alpha4.Conditions) {
+	m.Status.Conditions = conditions
+}
+
 // +kubebuilder:object:root=true
 
 // MetalStackMachineList contains a list of MetalStackMachine
@@ -23,9 +23,262 @@ package v1alpha4
 import (
 	"k8s.io/api/core/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
+	apiv1alpha4 "sigs.k8s.io/cluster-api/api/v1alpha4"
 	"sigs.k8s.io/cluster-api/errors"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EgressIP) DeepCopyInto(out *EgressIP) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EgressIP.
+func (in *EgressIP) DeepCopy() *EgressIP {
+	if in == nil {
+		return nil
+	}
+	out := new(EgressIP)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EgressIPStatus) DeepCopyInto(out *EgressIPStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EgressIPStatus.
+func (in *EgressIPStatus) DeepCopy() *EgressIPStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(EgressIPStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *FirewallAddresses) DeepCopyInto(out *FirewallAddresses) {
+	*out = *in
+	if in.IPs != nil {
+		in, out := &in.IPs, &out.IPs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FirewallAddresses.
+func (in *FirewallAddresses) DeepCopy() *FirewallAddresses {
+	if in == nil {
+		return nil
+	}
+	out := new(FirewallAddresses)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *FirewallControllerSpec) DeepCopyInto(out *FirewallControllerSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FirewallControllerSpec.
+func (in *FirewallControllerSpec) DeepCopy() *FirewallControllerSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(FirewallControllerSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *FirewallFile) DeepCopyInto(out *FirewallFile) {
+	*out = *in
+	if in.Mode != nil {
+		in, out := &in.Mode, &out.Mode
+		*out = new(int32)
+		**out = **in
+	}
+	in.ContentFrom.DeepCopyInto(&out.ContentFrom)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FirewallFile.
+func (in *FirewallFile) DeepCopy() *FirewallFile {
+	if in == nil {
+		return nil
+	}
+	out := new(FirewallFile)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *FirewallFileSource) DeepCopyInto(out *FirewallFileSource) {
+	*out = *in
+	if in.Secret != nil {
+		in, out := &in.Secret, &out.Secret
+		*out = new(v1.SecretKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ConfigMap != nil {
+		in, out := &in.ConfigMap, &out.ConfigMap
+		*out = new(v1.ConfigMapKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FirewallFileSource.
+func (in *FirewallFileSource) DeepCopy() *FirewallFileSource {
+	if in == nil {
+		return nil
+	}
+	out := new(FirewallFileSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *FirewallSyslog) DeepCopyInto(out *FirewallSyslog) {
+	*out = *in
+	if in.Port != nil {
+		in, out := &in.Port, &out.Port
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FirewallSyslog.
+func (in *FirewallSyslog) DeepCopy() *FirewallSyslog {
+	if in == nil {
+		return nil
+	}
+	out := new(FirewallSyslog)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *FirewallSystemdDropin) DeepCopyInto(out *FirewallSystemdDropin) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FirewallSystemdDropin.
+func (in *FirewallSystemdDropin) DeepCopy() *FirewallSystemdDropin {
+	if in == nil {
+		return nil
+	}
+	out := new(FirewallSystemdDropin)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *FirewallSystemdUnit) DeepCopyInto(out *FirewallSystemdUnit) {
+	*out = *in
+	if in.Enabled != nil {
+		in, out := &in.Enabled, &out.Enabled
+		*out = new(bool)
+		**out = **in
+	}
+	if in.Dropins != nil {
+		in, out := &in.Dropins, &out.Dropins
+		*out = make([]FirewallSystemdDropin, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FirewallSystemdUnit.
+func (in *FirewallSystemdUnit) DeepCopy() *FirewallSystemdUnit {
+	if in == nil {
+		return nil
+	}
+	out := new(FirewallSystemdUnit)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *FirewallUpdate) DeepCopyInto(out *FirewallUpdate) {
+	*out = *in
+	in.StartTime.DeepCopyInto(&out.StartTime)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FirewallUpdate.
+func (in *FirewallUpdate) DeepCopy() *FirewallUpdate {
+	if in == nil {
+		return nil
+	}
+	out := new(FirewallUpdate)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HardwareSelector) DeepCopyInto(out *HardwareSelector) {
+	*out = *in
+	if in.CPUCores != nil {
+		in, out := &in.CPUCores, &out.CPUCores
+		*out = new(int64)
+		**out = **in
+	}
+	if in.Memory != nil {
+		in, out := &in.Memory, &out.Memory
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+	if in.ProductManufacturer != nil {
+		in, out := &in.ProductManufacturer, &out.ProductManufacturer
+		*out = new(string)
+		**out = **in
+	}
+	if in.ProductPartNumber != nil {
+		in, out := &in.ProductPartNumber, &out.ProductPartNumber
+		*out = new(string)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HardwareSelector.
+func (in *HardwareSelector) DeepCopy() *HardwareSelector {
+	if in == nil {
+		return nil
+	}
+	out := new(HardwareSelector)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HostSelector) DeepCopyInto(out *HostSelector) {
+	*out = *in
+	if in.Tags != nil {
+		in, out := &in.Tags, &out.Tags
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Racks != nil {
+		in, out := &in.Racks, &out.Racks
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Hardware != nil {
+		in, out := &in.Hardware, &out.Hardware
+		*out = new(HardwareSelector)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HostSelector.
+func (in *HostSelector) DeepCopy() *HostSelector {
+	if in == nil {
+		return nil
+	}
+	out := new(HostSelector)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *MetalStackCluster) DeepCopyInto(out *MetalStackCluster) {
 	*out = *in
@@ -95,6 +348,11 @@ func (in *MetalStackClusterSpec) DeepCopyInto(out *MetalStackClusterSpec) {
 		**out = **in
 	}
 	in.FirewallSpec.DeepCopyInto(&out.FirewallSpec)
+	if in.FirewallReplicas != nil {
+		in, out := &in.FirewallReplicas, &out.FirewallReplicas
+		*out = new(int32)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MetalStackClusterSpec.
@@ -120,6 +378,33 @@ func (in *MetalStackClusterStatus) DeepCopyInto(out *MetalStackClusterStatus) {
 		*out = new(string)
 		**out = **in
 	}
+	if in.Capacity != nil {
+		in, out := &in.Capacity, &out.Capacity
+		*out = make([]SizeCapacity, len(*in))
+		copy(*out, *in)
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make(apiv1alpha4.Conditions, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Firewalls != nil {
+		in, out := &in.Firewalls, &out.Firewalls
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.FirewallUpdate != nil {
+		in, out := &in.FirewallUpdate, &out.FirewallUpdate
+		*out = new(FirewallUpdate)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.EgressIPs != nil {
+		in, out := &in.EgressIPs, &out.EgressIPs
+		*out = make([]EgressIPStatus, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MetalStackClusterStatus.
@@ -138,7 +423,7 @@ func (in *MetalStackFirewall) DeepCopyInto(out *MetalStackFirewall) {
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
-	out.Status = in.Status
+	in.Status.DeepCopyInto(&out.Status)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MetalStackFirewall.
@@ -204,6 +489,45 @@ func (in *MetalStackFirewallSpec) DeepCopyInto(out *MetalStackFirewallSpec) {
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.EgressIPs != nil {
+		in, out := &in.EgressIPs, &out.EgressIPs
+		*out = make([]EgressIP, len(*in))
+		copy(*out, *in)
+	}
+	if in.FirewallController != nil {
+		in, out := &in.FirewallController, &out.FirewallController
+		*out = new(FirewallControllerSpec)
+		**out = **in
+	}
+	if in.Files != nil {
+		in, out := &in.Files, &out.Files
+		*out = make([]FirewallFile, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.SystemdUnits != nil {
+		in, out := &in.SystemdUnits, &out.SystemdUnits
+		*out = make([]FirewallSystemdUnit, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.DNSServers != nil {
+		in, out := &in.DNSServers, &out.DNSServers
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.NTPServers != nil {
+		in, out := &in.NTPServers, &out.NTPServers
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Syslog != nil {
+		in, out := &in.Syslog, &out.Syslog
+		*out = new(FirewallSyslog)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MetalStackFirewallSpec.
@@ -219,6 +543,32 @@ func (in *MetalStackFirewallSpec) DeepCopy() *MetalStackFirewallSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *MetalStackFirewallStatus) DeepCopyInto(out *MetalStackFirewallStatus) {
 	*out = *in
+	if in.Addresses != nil {
+		in, out := &in.Addresses, &out.Addresses
+		*out = make([]FirewallAddresses, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.AllocatedAt != nil {
+		in, out := &in.AllocatedAt, &out.AllocatedAt
+		*out = (*in).DeepCopy()
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make(apiv1alpha4.Conditions, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.CredentialsExpireAt != nil {
+		in, out := &in.CredentialsExpireAt, &out.CredentialsExpireAt
+		*out = (*in).DeepCopy()
+	}
+	if in.ControllerHeartbeat != nil {
+		in, out := &in.ControllerHeartbeat, &out.ControllerHeartbeat
+		*out = (*in).DeepCopy()
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MetalStackFirewallStatus.
@@ -290,6 +640,26 @@ func (in *MetalStackMachineList) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MetalStackMachineRemediation) DeepCopyInto(out *MetalStackMachineRemediation) {
+	*out = *in
+	if in.RetryLimit != nil {
+		in, out := &in.RetryLimit, &out.RetryLimit
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MetalStackMachineRemediation.
+func (in *MetalStackMachineRemediation) DeepCopy() *MetalStackMachineRemediation {
+	if in == nil {
+		return nil
+	}
+	out := new(MetalStackMachineRemediation)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *MetalStackMachineSpec) DeepCopyInto(out *MetalStackMachineSpec) {
 	*out = *in
@@ -308,6 +678,16 @@ func (in *MetalStackMachineSpec) DeepCopyInto(out *MetalStackMachineSpec) {
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.Remediation != nil {
+		in, out := &in.Remediation, &out.Remediation
+		*out = new(MetalStackMachineRemediation)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.HostSelector != nil {
+		in, out := &in.HostSelector, &out.HostSelector
+		*out = new(HostSelector)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MetalStackMachineSpec.
@@ -353,6 +733,23 @@ func (in *MetalStackMachineStatus) DeepCopyInto(out *MetalStackMachineStatus) {
 		*out = new(MetalStackResourceStatus)
 		**out = **in
 	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make(apiv1alpha4.Conditions, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Remediation != nil {
+		in, out := &in.Remediation, &out.Remediation
+		*out = new(RemediationStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.HostCandidates != nil {
+		in, out := &in.HostCandidates, &out.HostCandidates
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MetalStackMachineStatus.
@@ -454,3 +851,37 @@ func (in *MetalStackMachineTemplateSpec) DeepCopy() *MetalStackMachineTemplateSp
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RemediationStatus) DeepCopyInto(out *RemediationStatus) {
+	*out = *in
+	if in.LastRemediated != nil {
+		in, out := &in.LastRemediated, &out.LastRemediated
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RemediationStatus.
+func (in *RemediationStatus) DeepCopy() *RemediationStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(RemediationStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SizeCapacity) DeepCopyInto(out *SizeCapacity) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SizeCapacity.
+func (in *SizeCapacity) DeepCopy() *SizeCapacity {
+	if in == nil {
+		return nil
+	}
+	out := new(SizeCapacity)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -0,0 +1,90 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Command import prints the manifests of a cluster built on metal-stack without Cluster API,
+// so that the controllers take it over once they are applied.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	metalgo "github.com/metal-stack/metal-go"
+
+	configv1 "github.com/metal-stack/cluster-api-provider-metalstack/api/config/v1alpha1"
+	"github.com/metal-stack/cluster-api-provider-metalstack/controllers"
+	"github.com/metal-stack/cluster-api-provider-metalstack/importer"
+)
+
+func main() {
+	var opts importer.Options
+	var controlPlaneMachines string
+	var port int
+	flag.StringVar(&opts.Name, "name", "", "The name of the generated Cluster.")
+	flag.StringVar(&opts.Namespace, "namespace", "default", "The namespace of the generated objects.")
+	flag.StringVar(&opts.ProjectID, "project", "", "The project the machines of the cluster are allocated in.")
+	flag.StringVar(&opts.ClusterID, "cluster-id", "", "The value of the cluster.metal-stack.io/id tag of the machines of the cluster.")
+	flag.StringVar(&opts.PublicNetworkID, "public-network", "internet", "The network the control plane IP is allocated in.")
+	flag.StringVar(&opts.ControlPlaneHost, "control-plane-host", "", "The IP of the control plane endpoint, looked up by its name if empty.")
+	flag.IntVar(&port, "control-plane-port", 6443, "The port of the control plane endpoint.")
+	flag.StringVar(&controlPlaneMachines, "control-plane-machines", "", "The comma separated IDs or names of the machines running the control plane.")
+	flag.StringVar(&opts.KubernetesVersion, "kubernetes-version", "", "The Kubernetes version of the generated Machines.")
+	flag.StringVar(&opts.WatchFilterValue, "watch-filter", "", "The value of the watch-filter label of the generated objects, for a manager started with --watch-filter.")
+	var metalAPI configv1.MetalAPIConfig
+	flag.StringVar(&metalAPI.URL, "metal-api-url", os.Getenv("METALCTL_URL"), "The URL of metal-API. Defaults to the environment variable METALCTL_URL.")
+	flag.StringVar(&metalAPI.URLFile, "metal-api-url-file", "", "The file with the URL of metal-API, taking precedence over --metal-api-url.")
+	flag.StringVar(&metalAPI.HMACFile, "metal-api-hmac-file", "", "The file with the HMAC key for metal-API. Defaults to the key in the environment variable METALCTL_HMAC.")
+	flag.StringVar(&metalAPI.TokenFile, "metal-api-token-file", "", "The file with the bearer token for metal-API, exclusive with the HMAC key.")
+	flag.Parse()
+
+	if opts.Name == "" || opts.ProjectID == "" || opts.ClusterID == "" {
+		fmt.Fprintln(os.Stderr, "name, project and cluster-id are required")
+		flag.Usage()
+		os.Exit(2)
+	}
+	opts.ControlPlanePort = int32(port)
+	if controlPlaneMachines != "" {
+		opts.ControlPlaneMachines = strings.Split(controlPlaneMachines, ",")
+	}
+
+	if metalAPI.TokenFile != "" && metalAPI.HMACFile != "" {
+		fmt.Fprintln(os.Stderr, "metal-api-token-file and metal-api-hmac-file are exclusive")
+		os.Exit(2)
+	}
+	credentials, err := controllers.LoadMetalAPICredentials(metalAPI)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to load metal-API credentials: %s\n", err)
+		os.Exit(1)
+	}
+
+	metalClient, err := metalgo.NewDriver(credentials.URL, credentials.Token, credentials.HMAC)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to get `metal-stack/metal-go` client: %s\n", err)
+		os.Exit(1)
+	}
+
+	objects, err := importer.Import(metalClient, opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to import cluster: %s\n", err)
+		os.Exit(1)
+	}
+	if err := importer.Write(os.Stdout, objects); err != nil {
+		fmt.Fprintf(os.Stderr, "unable to write manifests: %s\n", err)
+		os.Exit(1)
+	}
+}
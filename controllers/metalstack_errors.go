@@ -0,0 +1,65 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+)
+
+// statusCoder is implemented by the error responses of `metal-API`.
+type statusCoder interface {
+	Code() int
+}
+
+// isTransientError checks if an error of `metal-API` may disappear by retrying the request.
+// Network errors, timeouts, conflicts, throttling and server errors are transient, as are the open circuit breaker
+// and the exceeded rate limit.
+// Other client errors, e.g. a bad image, an unknown size or no capacity, and errors building the request
+// or decoding the response are terminal.
+func isTransientError(err error) bool {
+	var sc statusCoder
+	if errors.As(err, &sc) {
+		switch code := sc.Code(); {
+		case code == http.StatusRequestTimeout, code == http.StatusConflict, code == http.StatusTooManyRequests:
+			return true
+		case code >= http.StatusInternalServerError:
+			return true
+		default:
+			return code < http.StatusBadRequest
+		}
+	}
+
+	if errors.Is(err, errCircuitOpen) || errors.Is(err, errRateLimited) || errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	// *url.Error of the HTTP client is a net.Error, too.
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// isAuthError checks if `metal-API` rejected the credentials of the request.
+func isAuthError(err error) bool {
+	var sc statusCoder
+	if !errors.As(err, &sc) {
+		return false
+	}
+	return sc.Code() == http.StatusUnauthorized || sc.Code() == http.StatusForbidden
+}
@@ -28,11 +28,20 @@ type MetalStackClient interface {
 	FirewallGet(machineID string) (*metalgo.FirewallGetResponse, error)
 	FirewallFind(ffr *metalgo.FirewallFindRequest) (*metalgo.FirewallListResponse, error)
 	IPAllocate(iar *metalgo.IPAllocateRequest) (*metalgo.IPDetailResponse, error)
+	IPFree(id string) (*metalgo.IPDetailResponse, error)
+	IPGet(ipaddress string) (*metalgo.IPDetailResponse, error)
+	IPFind(ifr *metalgo.IPFindRequest) (*metalgo.IPListResponse, error)
 	MachineCreate(mcr *metalgo.MachineCreateRequest) (*metalgo.MachineCreateResponse, error)
 	MachineDelete(machineID string) (*metalgo.MachineDeleteResponse, error)
 	MachineFind(mfr *metalgo.MachineFindRequest) (*metalgo.MachineListResponse, error)
 	MachineGet(id string) (*metalgo.MachineGetResponse, error)
+	MachinePowerOff(machineID string) (*metalgo.MachinePowerResponse, error)
+	MachinePowerOn(machineID string) (*metalgo.MachinePowerResponse, error)
+	MachinePowerReset(machineID string) (*metalgo.MachinePowerResponse, error)
+	MachineReinstall(machineID, imageID, description string) (*metalgo.MachineGetResponse, error)
 	NetworkAllocate(ncr *metalgo.NetworkAllocateRequest) (*metalgo.NetworkDetailResponse, error)
 	NetworkFind(nfr *metalgo.NetworkFindRequest) (*metalgo.NetworkListResponse, error)
 	NetworkFree(id string) (*metalgo.NetworkDetailResponse, error)
+	PartitionCapacity() (*metalgo.PartitionCapacityResponse, error)
+	PartitionList() (*metalgo.PartitionListResponse, error)
 }
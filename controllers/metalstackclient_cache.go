@@ -0,0 +1,425 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	metalgo "github.com/metal-stack/metal-go"
+	"github.com/metal-stack/metal-go/api/models"
+	"k8s.io/utils/pointer"
+
+	api "github.com/metal-stack/cluster-api-provider-metalstack/api/v1alpha4"
+)
+
+// Prefixes of the cache keys per cached method.
+const (
+	cacheMachineGet  = "MachineGet/"
+	cacheMachineFind = "MachineFind/"
+	cacheFirewallGet = "FirewallGet/"
+	cacheNetworkFind = "NetworkFind/"
+)
+
+// CacheOptions configures the cache of the `metal-API` client.
+type CacheOptions struct {
+	// TTL is the time a response is cached, disabled if not positive.
+	TTL time.Duration
+	// BulkList fills the cache of MachineGet with the machines found by MachineFind,
+	// so that the machines of a cluster can be listed by a single request.
+	BulkList bool
+}
+
+// cachedMetalStackClient caches the responses of the lookups which run on almost every reconcilation.
+// Mutating requests invalidate the cached responses they may change.
+// The cached responses are shared and must not be modified.
+type cachedMetalStackClient struct {
+	client MetalStackClient
+
+	opts CacheOptions
+	now  func() time.Time
+
+	// The entries are shared with the pinned clients.
+	mu      *sync.Mutex
+	entries map[string]cacheEntry
+}
+
+type cacheEntry struct {
+	value   interface{}
+	expires time.Time
+	// filter is what a machine must match to be found by a cached MachineFind.
+	filter machineFilter
+}
+
+// machineFilter describes the machines found by a MachineFind, or a machine by what it is found.
+// Empty fields match any machine.
+type machineFilter struct {
+	tags      []string
+	partition string
+	size      string
+}
+
+// filtersPlacement tells whether the find is restricted to a partition or size, e.g. the finds of free hosts.
+func (f machineFilter) filtersPlacement() bool {
+	return f.partition != "" || f.size != ""
+}
+
+// matchesPlacement tells whether the machine may be placed in the partition and size of the find.
+func (f machineFilter) matchesPlacement(machine machineFilter) bool {
+	return (f.partition == "" || machine.partition == "" || f.partition == machine.partition) &&
+		(f.size == "" || machine.size == "" || f.size == machine.size)
+}
+
+// NewCachedMetalStackClient decorates the client with a read-through cache.
+func NewCachedMetalStackClient(client MetalStackClient, opts CacheOptions) MetalStackClient {
+	if opts.TTL <= 0 {
+		return client
+	}
+
+	return &cachedMetalStackClient{
+		client:  client,
+		opts:    opts,
+		now:     time.Now,
+		mu:      &sync.Mutex{},
+		entries: make(map[string]cacheEntry),
+	}
+}
+
+// pin shares the cached responses with the pinned client.
+func (c *cachedMetalStackClient) pin() MetalStackClient {
+	pinned := *c
+	pinned.client = pinMetalStackClient(c.client)
+	return &pinned
+}
+
+// FlushMetalStackClientCache drops all cached responses of the client, e.g. when the URL of `metal-API` changed.
+// It does nothing unless the client caches.
+func FlushMetalStackClientCache(client MetalStackClient) {
+	c, ok := client.(*cachedMetalStackClient)
+	if !ok {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key := range c.entries {
+		delete(c.entries, key)
+	}
+}
+
+// CircuitOpen forwards the state of the circuit breaker of the decorated client.
+func (c *cachedMetalStackClient) CircuitOpen() (bool, time.Duration) {
+	if o, ok := c.client.(circuitOpener); ok {
+		return o.CircuitOpen()
+	}
+	return false, 0
+}
+
+func (c *cachedMetalStackClient) MachineGet(id string) (*metalgo.MachineGetResponse, error) {
+	key := cacheMachineGet + id
+	if v, ok := c.get("MachineGet", key); ok {
+		return v.(*metalgo.MachineGetResponse), nil
+	}
+
+	resp, err := c.client.MachineGet(id)
+	if err != nil {
+		return resp, err
+	}
+
+	c.set(key, resp)
+	return resp, nil
+}
+
+func (c *cachedMetalStackClient) MachineFind(mfr *metalgo.MachineFindRequest) (*metalgo.MachineListResponse, error) {
+	key, err := cacheKey(cacheMachineFind, mfr)
+	if err != nil {
+		return c.client.MachineFind(mfr)
+	}
+	if v, ok := c.get("MachineFind", key); ok {
+		return v.(*metalgo.MachineListResponse), nil
+	}
+
+	resp, err := c.client.MachineFind(mfr)
+	if err != nil {
+		return resp, err
+	}
+
+	c.setFind(key, resp, machineFilter{
+		tags:      mfr.Tags,
+		partition: pointer.StringPtrDerefOr(mfr.PartitionID, ""),
+		size:      pointer.StringPtrDerefOr(mfr.SizeID, ""),
+	})
+	if c.opts.BulkList {
+		for _, m := range resp.Machines {
+			if m != nil && m.ID != nil {
+				c.set(cacheMachineGet+*m.ID, &metalgo.MachineGetResponse{Machine: m})
+			}
+		}
+	}
+	return resp, nil
+}
+
+func (c *cachedMetalStackClient) FirewallGet(machineID string) (*metalgo.FirewallGetResponse, error) {
+	key := cacheFirewallGet + machineID
+	if v, ok := c.get("FirewallGet", key); ok {
+		return v.(*metalgo.FirewallGetResponse), nil
+	}
+
+	resp, err := c.client.FirewallGet(machineID)
+	if err != nil {
+		return resp, err
+	}
+
+	c.set(key, resp)
+	return resp, nil
+}
+
+func (c *cachedMetalStackClient) NetworkFind(nfr *metalgo.NetworkFindRequest) (*metalgo.NetworkListResponse, error) {
+	key, err := cacheKey(cacheNetworkFind, nfr)
+	if err != nil {
+		return c.client.NetworkFind(nfr)
+	}
+	if v, ok := c.get("NetworkFind", key); ok {
+		return v.(*metalgo.NetworkListResponse), nil
+	}
+
+	resp, err := c.client.NetworkFind(nfr)
+	if err != nil {
+		return resp, err
+	}
+
+	c.set(key, resp)
+	return resp, nil
+}
+
+func (c *cachedMetalStackClient) FirewallCreate(fcr *metalgo.FirewallCreateRequest) (*metalgo.FirewallCreateResponse, error) {
+	defer c.invalidateMachine(fcr.UUID, &machineFilter{tags: fcr.Tags, partition: fcr.Partition, size: fcr.Size}, true)
+	return c.client.FirewallCreate(fcr)
+}
+
+func (c *cachedMetalStackClient) MachineCreate(mcr *metalgo.MachineCreateRequest) (*metalgo.MachineCreateResponse, error) {
+	defer c.invalidateMachine(mcr.UUID, &machineFilter{tags: mcr.Tags, partition: mcr.Partition, size: mcr.Size}, true)
+	return c.client.MachineCreate(mcr)
+}
+
+func (c *cachedMetalStackClient) MachineDelete(machineID string) (*metalgo.MachineDeleteResponse, error) {
+	defer c.invalidateMachine(machineID, nil, true)
+	return c.client.MachineDelete(machineID)
+}
+
+func (c *cachedMetalStackClient) MachinePowerOff(machineID string) (*metalgo.MachinePowerResponse, error) {
+	defer c.invalidateMachine(machineID, nil, false)
+	return c.client.MachinePowerOff(machineID)
+}
+
+func (c *cachedMetalStackClient) MachinePowerOn(machineID string) (*metalgo.MachinePowerResponse, error) {
+	defer c.invalidateMachine(machineID, nil, false)
+	return c.client.MachinePowerOn(machineID)
+}
+
+func (c *cachedMetalStackClient) MachinePowerReset(machineID string) (*metalgo.MachinePowerResponse, error) {
+	defer c.invalidateMachine(machineID, nil, false)
+	return c.client.MachinePowerReset(machineID)
+}
+
+func (c *cachedMetalStackClient) MachineReinstall(machineID, imageID, description string) (*metalgo.MachineGetResponse, error) {
+	defer c.invalidateMachine(machineID, nil, false)
+	return c.client.MachineReinstall(machineID, imageID, description)
+}
+
+func (c *cachedMetalStackClient) NetworkAllocate(ncr *metalgo.NetworkAllocateRequest) (*metalgo.NetworkDetailResponse, error) {
+	defer c.invalidate(cacheNetworkFind)
+	return c.client.NetworkAllocate(ncr)
+}
+
+func (c *cachedMetalStackClient) NetworkFree(id string) (*metalgo.NetworkDetailResponse, error) {
+	defer c.invalidate(cacheNetworkFind)
+	return c.client.NetworkFree(id)
+}
+
+func (c *cachedMetalStackClient) FirewallFind(ffr *metalgo.FirewallFindRequest) (*metalgo.FirewallListResponse, error) {
+	return c.client.FirewallFind(ffr)
+}
+
+func (c *cachedMetalStackClient) IPAllocate(iar *metalgo.IPAllocateRequest) (*metalgo.IPDetailResponse, error) {
+	return c.client.IPAllocate(iar)
+}
+
+func (c *cachedMetalStackClient) IPFree(id string) (*metalgo.IPDetailResponse, error) {
+	return c.client.IPFree(id)
+}
+
+func (c *cachedMetalStackClient) IPGet(ipaddress string) (*metalgo.IPDetailResponse, error) {
+	return c.client.IPGet(ipaddress)
+}
+
+func (c *cachedMetalStackClient) IPFind(ifr *metalgo.IPFindRequest) (*metalgo.IPListResponse, error) {
+	return c.client.IPFind(ifr)
+}
+
+func (c *cachedMetalStackClient) PartitionCapacity() (*metalgo.PartitionCapacityResponse, error) {
+	return c.client.PartitionCapacity()
+}
+
+func (c *cachedMetalStackClient) PartitionList() (*metalgo.PartitionListResponse, error) {
+	return c.client.PartitionList()
+}
+
+func (c *cachedMetalStackClient) get(method, key string) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok || !c.now().Before(e.expires) {
+		delete(c.entries, key)
+		metalAPICacheMisses.WithLabelValues(method).Inc()
+		return nil, false
+	}
+
+	metalAPICacheHits.WithLabelValues(method).Inc()
+	return e.value, true
+}
+
+func (c *cachedMetalStackClient) set(key string, value interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries[key] = cacheEntry{value: value, expires: c.now().Add(c.opts.TTL)}
+}
+
+func (c *cachedMetalStackClient) setFind(key string, value interface{}, filter machineFilter) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries[key] = cacheEntry{value: value, expires: c.now().Add(c.opts.TTL), filter: filter}
+}
+
+// invalidateMachine drops the responses a mutated machine or firewall may be part of, which are its lookups
+// and the finds it may match by its tags. Without a known machine, e.g. one which isn't cached, all finds are dropped.
+// Finds without tags are always dropped. If the allocation changed, the finds of the partition and size of the machine
+// are dropped regardless of their tags, since they select free hosts, e.g. by the tags of a host selector.
+func (c *cachedMetalStackClient) invalidateMachine(id string, machine *machineFilter, allocation bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if machine == nil {
+		machine = c.cachedMachine(id)
+	}
+	if id != "" {
+		delete(c.entries, cacheMachineGet+id)
+		delete(c.entries, cacheFirewallGet+id)
+	}
+	for key, e := range c.entries {
+		if !strings.HasPrefix(key, cacheMachineFind) {
+			continue
+		}
+		if machine == nil || containsAllTags(machine.tags, e.filter.tags) ||
+			(allocation && e.filter.filtersPlacement() && e.filter.matchesPlacement(*machine)) {
+			delete(c.entries, key)
+		}
+	}
+}
+
+// cachedMachine describes a cached machine or firewall, nil if it isn't cached.
+func (c *cachedMetalStackClient) cachedMachine(id string) *machineFilter {
+	if id == "" {
+		return nil
+	}
+	if e, ok := c.entries[cacheMachineGet+id]; ok {
+		if m := e.value.(*metalgo.MachineGetResponse).Machine; m != nil {
+			return &machineFilter{tags: m.Tags, partition: partitionID(m.Partition), size: sizeID(m.Size)}
+		}
+	}
+	if e, ok := c.entries[cacheFirewallGet+id]; ok {
+		if f := e.value.(*metalgo.FirewallGetResponse).Firewall; f != nil {
+			return &machineFilter{tags: f.Tags, partition: partitionID(f.Partition), size: sizeID(f.Size)}
+		}
+	}
+	return nil
+}
+
+func partitionID(p *models.V1PartitionResponse) string {
+	if p == nil {
+		return ""
+	}
+	return pointer.StringPtrDerefOr(p.ID, "")
+}
+
+func sizeID(s *models.V1SizeResponse) string {
+	if s == nil {
+		return ""
+	}
+	return pointer.StringPtrDerefOr(s.ID, "")
+}
+
+func containsAllTags(tags, required []string) bool {
+	for _, r := range required {
+		found := false
+		for _, t := range tags {
+			if t == r {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *cachedMetalStackClient) invalidate(prefixes ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key := range c.entries {
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(key, prefix) {
+				delete(c.entries, key)
+				break
+			}
+		}
+	}
+}
+
+// cacheKey identifies a find request by its fields.
+func cacheKey(prefix string, req interface{}) (string, error) {
+	b, err := json.Marshal(req)
+	if err != nil {
+		return "", err
+	}
+	return prefix + string(b), nil
+}
+
+// prefetchClusterMachines lists all machines of the cluster by a single request,
+// so that the following lookups of single machines are served by the cache.
+// It does nothing unless the client caches with bulk listing.
+func prefetchClusterMachines(client MetalStackClient, metalCluster *api.MetalStackCluster) error {
+	c, ok := client.(*cachedMetalStackClient)
+	if !ok || !c.opts.BulkList {
+		return nil
+	}
+
+	_, err := c.MachineFind(&metalgo.MachineFindRequest{
+		AllocationProject: &metalCluster.Spec.ProjectID,
+		Tags:              []string{metalCluster.GetClusterIDTag()},
+	})
+	return err
+}
@@ -0,0 +1,217 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"time"
+
+	metalgo "github.com/metal-stack/metal-go"
+	metalmodels "github.com/metal-stack/metal-go/api/models"
+
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"k8s.io/utils/pointer"
+
+	"github.com/metal-stack/cluster-api-provider-metalstack/controllers/mocks"
+)
+
+var _ = Describe("Cached MetalStackClient", func() {
+	ctrl := gomock.NewController(GinkgoT())
+	metalClient := mocks.NewMockMetalStackClient(ctrl)
+
+	type CacheTestCase struct {
+		BulkList bool
+		// Between runs before the machine is looked up twice.
+		Between func(c *cachedMetalStackClient, now *time.Time)
+		// Gets is the number of MachineGet requests to metal-API.
+		Gets int
+	}
+
+	DescribeTable("Cache MachineGet",
+		func(tc CacheTestCase) {
+			now := time.Now()
+			c := NewCachedMetalStackClient(metalClient, CacheOptions{TTL: time.Minute, BulkList: tc.BulkList}).(*cachedMetalStackClient)
+			c.now = func() time.Time { return now }
+
+			if tc.Gets > 0 {
+				metalClient.EXPECT().MachineGet("id").Return(&metalgo.MachineGetResponse{}, nil).Times(tc.Gets)
+			}
+			hits := testutil.ToFloat64(metalAPICacheHits.WithLabelValues("MachineGet"))
+
+			if tc.Between != nil {
+				tc.Between(c, &now)
+			}
+			for i := 0; i < 2; i++ {
+				_, err := c.MachineGet("id")
+				Expect(err).NotTo(HaveOccurred())
+			}
+			if tc.Between == nil {
+				Expect(testutil.ToFloat64(metalAPICacheHits.WithLabelValues("MachineGet"))).To(Equal(hits + 1))
+			}
+		},
+		Entry("Should serve the second lookup from the cache", CacheTestCase{
+			Gets: 1,
+		}),
+		Entry("Should expire after the TTL", CacheTestCase{
+			Between: func(c *cachedMetalStackClient, now *time.Time) {
+				_, _ = c.MachineGet("id")
+				*now = now.Add(2 * time.Minute)
+			},
+			Gets: 2,
+		}),
+		Entry("Should invalidate on mutating requests", CacheTestCase{
+			Between: func(c *cachedMetalStackClient, now *time.Time) {
+				_, _ = c.MachineGet("id")
+				metalClient.EXPECT().MachineDelete("id").Return(&metalgo.MachineDeleteResponse{}, nil)
+				_, _ = c.MachineDelete("id")
+			},
+			Gets: 2,
+		}),
+		Entry("Should keep the lookups of other machines on mutating requests", CacheTestCase{
+			Between: func(c *cachedMetalStackClient, now *time.Time) {
+				metalClient.EXPECT().MachinePowerOff("other").Return(&metalgo.MachinePowerResponse{}, nil)
+				_, _ = c.MachinePowerOff("other")
+			},
+			Gets: 1,
+		}),
+		Entry("Should serve lookups from a bulk listing", CacheTestCase{
+			BulkList: true,
+			Between: func(c *cachedMetalStackClient, now *time.Time) {
+				metalClient.EXPECT().MachineFind(gomock.Any()).Return(&metalgo.MachineListResponse{
+					Machines: []*metalmodels.V1MachineResponse{{ID: pointer.StringPtr("id")}},
+				}, nil)
+				Expect(prefetchClusterMachines(c, newMetalStackCluster(nil, nil, false, false))).To(Succeed())
+			},
+		}),
+	)
+
+	type FindInvalidationTestCase struct {
+		FindTags []string
+		// FindPartition and FindSize restrict the find to a partition and size, e.g. of a host selector, if set.
+		FindPartition string
+		FindSize      string
+		Mutate        func(c *cachedMetalStackClient)
+		Finds         int
+	}
+
+	DescribeTable("Invalidate MachineFind",
+		func(tc FindInvalidationTestCase) {
+			ctrl := gomock.NewController(GinkgoT())
+			defer ctrl.Finish()
+
+			metalClient := mocks.NewMockMetalStackClient(ctrl)
+			c := NewCachedMetalStackClient(metalClient, CacheOptions{TTL: time.Minute}).(*cachedMetalStackClient)
+
+			mfr := &metalgo.MachineFindRequest{Tags: tc.FindTags}
+			if tc.FindPartition != "" {
+				mfr.PartitionID = &tc.FindPartition
+			}
+			if tc.FindSize != "" {
+				mfr.SizeID = &tc.FindSize
+			}
+			metalClient.EXPECT().MachineFind(mfr).Return(&metalgo.MachineListResponse{}, nil).Times(tc.Finds)
+			metalClient.EXPECT().MachineGet("id").Return(&metalgo.MachineGetResponse{
+				Machine: &metalmodels.V1MachineResponse{ID: pointer.StringPtr("id"), Tags: []string{"cluster-api-provider-metalstack:cluster-id=a"}},
+			}, nil).AnyTimes()
+			metalClient.EXPECT().MachineCreate(gomock.Any()).Return(&metalgo.MachineCreateResponse{}, nil).AnyTimes()
+			metalClient.EXPECT().MachineDelete(gomock.Any()).Return(&metalgo.MachineDeleteResponse{}, nil).AnyTimes()
+			metalClient.EXPECT().MachinePowerOn(gomock.Any()).Return(&metalgo.MachinePowerResponse{}, nil).AnyTimes()
+
+			_, err := c.MachineFind(mfr)
+			Expect(err).NotTo(HaveOccurred())
+			tc.Mutate(c)
+			_, err = c.MachineFind(mfr)
+			Expect(err).NotTo(HaveOccurred())
+		},
+		Entry("Should drop the finds of the cluster of a created machine", FindInvalidationTestCase{
+			FindTags: []string{"cluster-api-provider-metalstack:cluster-id=a"},
+			Mutate: func(c *cachedMetalStackClient) {
+				_, _ = c.MachineCreate(&metalgo.MachineCreateRequest{Tags: []string{"cluster-api-provider-metalstack:cluster-id=a", "machine"}})
+			},
+			Finds: 2,
+		}),
+		Entry("Should keep the finds of other clusters on a created machine", FindInvalidationTestCase{
+			FindTags: []string{"cluster-api-provider-metalstack:cluster-id=b"},
+			Mutate: func(c *cachedMetalStackClient) {
+				_, _ = c.MachineCreate(&metalgo.MachineCreateRequest{Tags: []string{"cluster-api-provider-metalstack:cluster-id=a"}})
+			},
+			Finds: 1,
+		}),
+		Entry("Should drop finds without tags on a created machine", FindInvalidationTestCase{
+			Mutate: func(c *cachedMetalStackClient) {
+				_, _ = c.MachineCreate(&metalgo.MachineCreateRequest{Tags: []string{"cluster-api-provider-metalstack:cluster-id=a"}})
+			},
+			Finds: 2,
+		}),
+		Entry("Should keep the finds of other clusters on a deleted cached machine", FindInvalidationTestCase{
+			FindTags: []string{"cluster-api-provider-metalstack:cluster-id=b"},
+			Mutate: func(c *cachedMetalStackClient) {
+				_, _ = c.MachineGet("id")
+				_, _ = c.MachineDelete("id")
+			},
+			Finds: 1,
+		}),
+		Entry("Should drop the selector finds of the partition and size of a created machine", FindInvalidationTestCase{
+			FindTags:      []string{"rack=a"},
+			FindPartition: "partition",
+			FindSize:      "size",
+			Mutate: func(c *cachedMetalStackClient) {
+				_, _ = c.MachineCreate(&metalgo.MachineCreateRequest{Partition: "partition", Size: "size", Tags: []string{"cluster-api-provider-metalstack:cluster-id=a"}})
+			},
+			Finds: 2,
+		}),
+		Entry("Should keep the selector finds of other sizes on a created machine", FindInvalidationTestCase{
+			FindTags:      []string{"rack=a"},
+			FindPartition: "partition",
+			FindSize:      "other",
+			Mutate: func(c *cachedMetalStackClient) {
+				_, _ = c.MachineCreate(&metalgo.MachineCreateRequest{Partition: "partition", Size: "size", Tags: []string{"cluster-api-provider-metalstack:cluster-id=a"}})
+			},
+			Finds: 1,
+		}),
+		Entry("Should drop the selector finds on a deleted cached machine", FindInvalidationTestCase{
+			FindTags:      []string{"rack=a"},
+			FindPartition: "partition",
+			FindSize:      "size",
+			Mutate: func(c *cachedMetalStackClient) {
+				_, _ = c.MachineGet("id")
+				_, _ = c.MachineDelete("id")
+			},
+			Finds: 2,
+		}),
+		Entry("Should keep the selector finds on a powered cached machine", FindInvalidationTestCase{
+			FindTags:      []string{"rack=a"},
+			FindPartition: "partition",
+			FindSize:      "size",
+			Mutate: func(c *cachedMetalStackClient) {
+				_, _ = c.MachineGet("id")
+				_, _ = c.MachinePowerOn("id")
+			},
+			Finds: 1,
+		}),
+		Entry("Should drop all finds on a deleted unknown machine", FindInvalidationTestCase{
+			FindTags: []string{"cluster-api-provider-metalstack:cluster-id=b"},
+			Mutate: func(c *cachedMetalStackClient) {
+				_, _ = c.MachineDelete("unknown")
+			},
+			Finds: 2,
+		}),
+	)
+})
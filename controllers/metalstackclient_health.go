@@ -0,0 +1,74 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// MetalAPIChecker checks that `metal-API` accepts the credentials of the client.
+// The result is cached, so that frequent probes don't add up to the requests to `metal-API`.
+type MetalAPIChecker struct {
+	client   MetalStackClient
+	interval time.Duration
+	now      func() time.Time
+
+	mu        sync.Mutex
+	checkedAt time.Time
+	err       error
+}
+
+// NewMetalAPIChecker returns a checker which repeats the check after the interval at the earliest.
+func NewMetalAPIChecker(client MetalStackClient, interval time.Duration) *MetalAPIChecker {
+	return &MetalAPIChecker{
+		client:   client,
+		interval: interval,
+		now:      time.Now,
+	}
+}
+
+// Check lists the partitions, which is the cheapest authenticated request to `metal-API`.
+// It's a healthz.Checker for the readiness probe of the manager.
+func (c *MetalAPIChecker) Check(_ *http.Request) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	if !c.checkedAt.IsZero() && now.Sub(c.checkedAt) < c.interval {
+		return c.err
+	}
+
+	c.checkedAt = now
+	c.err = nil
+	if _, err := c.client.PartitionList(); err != nil {
+		c.err = fmt.Errorf("metal-API is unavailable: %w", err)
+	}
+	return c.err
+}
+
+// VerifyMetalAPICredentials fails if `metal-API` rejects the credentials of the client.
+// Transient errors are left to the readiness probe.
+func VerifyMetalAPICredentials(client MetalStackClient) error {
+	_, err := client.PartitionList()
+	if isAuthError(err) {
+		return fmt.Errorf("metal-API rejected the credentials: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	metalgo "github.com/metal-stack/metal-go"
+	metalpartition "github.com/metal-stack/metal-go/api/client/partition"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+
+	"github.com/metal-stack/cluster-api-provider-metalstack/controllers/mocks"
+)
+
+var _ = Describe("metal-API health", func() {
+	ctrl := gomock.NewController(GinkgoT())
+	metalClient := mocks.NewMockMetalStackClient(ctrl)
+
+	type HealthTestCase struct {
+		// Errors are returned by the requests to metal-API in turn.
+		Errors []error
+		// Elapsed is the time between the checks.
+		Elapsed time.Duration
+		// Healthy is the expected result of each check.
+		Healthy []bool
+	}
+
+	DescribeTable("Check metal-API",
+		func(tc HealthTestCase) {
+			now := time.Now()
+			checker := NewMetalAPIChecker(metalClient, time.Minute)
+			checker.now = func() time.Time { return now }
+
+			for _, err := range tc.Errors {
+				metalClient.EXPECT().PartitionList().Return(&metalgo.PartitionListResponse{}, err)
+			}
+			for _, healthy := range tc.Healthy {
+				err := checker.Check(nil)
+				if healthy {
+					Expect(err).NotTo(HaveOccurred())
+				} else {
+					Expect(err).To(HaveOccurred())
+				}
+				now = now.Add(tc.Elapsed)
+			}
+		},
+		Entry("Should be healthy if metal-API answers", HealthTestCase{
+			Errors:  []error{nil},
+			Healthy: []bool{true},
+		}),
+		Entry("Should cache the result within the interval", HealthTestCase{
+			Errors:  []error{fmt.Errorf("timeout")},
+			Elapsed: 30 * time.Second,
+			Healthy: []bool{false, false},
+		}),
+		Entry("Should check again after the interval", HealthTestCase{
+			Errors:  []error{fmt.Errorf("timeout"), nil},
+			Elapsed: 2 * time.Minute,
+			Healthy: []bool{false, true},
+		}),
+	)
+
+	DescribeTable("Verify credentials",
+		func(err error, valid bool) {
+			metalClient.EXPECT().PartitionList().Return(&metalgo.PartitionListResponse{}, err)
+			if valid {
+				Expect(VerifyMetalAPICredentials(metalClient)).To(Succeed())
+			} else {
+				Expect(VerifyMetalAPICredentials(metalClient)).NotTo(Succeed())
+			}
+		},
+		Entry("Should accept valid credentials", nil, true),
+		Entry("Should reject unauthorized credentials", metalpartition.NewListPartitionsDefault(http.StatusUnauthorized), false),
+		Entry("Should reject forbidden credentials", metalpartition.NewListPartitionsDefault(http.StatusForbidden), false),
+		Entry("Should leave transient errors to the readiness probe", fmt.Errorf("timeout"), true),
+	)
+})
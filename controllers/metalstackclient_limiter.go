@@ -0,0 +1,379 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	metalgo "github.com/metal-stack/metal-go"
+	"golang.org/x/time/rate"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+// errCircuitOpen is returned instead of calling `metal-API` while the circuit breaker is open.
+var errCircuitOpen = errors.New("circuit breaker for metal-API is open")
+
+// errRateLimited is returned instead of calling `metal-API` if the rate limiter would delay the request for too long.
+var errRateLimited = errors.New("rate limit of metal-API exceeded")
+
+// maxRateLimitWait bounds the delay of a request by the rate limiter, since the requests can't be cancelled by a context.
+const maxRateLimitWait = 10 * time.Second
+
+// LimiterOptions configures the rate limiter and the circuit breaker of the `metal-API` client.
+type LimiterOptions struct {
+	// QPS is the number of requests per second, unlimited if not positive.
+	QPS float64
+	// Burst is the number of requests which may exceed the QPS at once, at least 1.
+	Burst int
+	// FailureThreshold is the number of consecutive transient errors which open the circuit breaker, disabled if not positive.
+	FailureThreshold int
+	// OpenDuration is the time the circuit breaker stays open until a single request probes `metal-API` again.
+	OpenDuration time.Duration
+}
+
+// limitedMetalStackClient throttles the requests to `metal-API` by a token bucket
+// and stops them by a circuit breaker while `metal-API` fails.
+type limitedMetalStackClient struct {
+	client  MetalStackClient
+	limiter *rate.Limiter
+	maxWait time.Duration
+	breaker *circuitBreaker
+}
+
+// NewLimitedMetalStackClient decorates the client with a rate limiter and a circuit breaker shared by all reconcilers.
+func NewLimitedMetalStackClient(client MetalStackClient, opts LimiterOptions) MetalStackClient {
+	limit := rate.Inf
+	if opts.QPS > 0 {
+		limit = rate.Limit(opts.QPS)
+	}
+	// A limiter without burst never allows a request.
+	burst := opts.Burst
+	if burst < 1 {
+		burst = 1
+	}
+
+	return &limitedMetalStackClient{
+		client:  client,
+		limiter: rate.NewLimiter(limit, burst),
+		maxWait: maxRateLimitWait,
+		breaker: newCircuitBreaker(opts.FailureThreshold, opts.OpenDuration),
+	}
+}
+
+// pin shares the rate limiter and the circuit breaker with the pinned client.
+func (c *limitedMetalStackClient) pin() MetalStackClient {
+	pinned := *c
+	pinned.client = pinMetalStackClient(c.client)
+	return &pinned
+}
+
+// CircuitOpen returns whether requests are stopped and the time until `metal-API` is probed again.
+func (c *limitedMetalStackClient) CircuitOpen() (bool, time.Duration) {
+	return c.breaker.open()
+}
+
+func (c *limitedMetalStackClient) acquire() error {
+	if !c.breaker.allow() {
+		return errCircuitOpen
+	}
+	r := c.limiter.Reserve()
+	if !r.OK() || r.Delay() > c.maxWait {
+		r.Cancel()
+		c.breaker.skip()
+		return errRateLimited
+	}
+	time.Sleep(r.Delay())
+	return nil
+}
+
+func (c *limitedMetalStackClient) release(err *error) {
+	c.breaker.done(*err)
+}
+
+// circuitOpener is implemented by clients which stop the requests to `metal-API` during outages.
+type circuitOpener interface {
+	CircuitOpen() (bool, time.Duration)
+}
+
+// requeueWhileCircuitOpen returns a delayed requeue if the client doesn't call `metal-API` at the moment.
+func requeueWhileCircuitOpen(client MetalStackClient) (ctrl.Result, bool) {
+	c, ok := client.(circuitOpener)
+	if !ok {
+		return ctrl.Result{}, false
+	}
+
+	open, retryAfter := c.CircuitOpen()
+	if !open {
+		return ctrl.Result{}, false
+	}
+	return ctrl.Result{RequeueAfter: retryAfter}, true
+}
+
+// circuitBreaker opens after consecutive transient errors and lets a single request probe `metal-API` after the open duration.
+type circuitBreaker struct {
+	threshold    int
+	openDuration time.Duration
+	now          func() time.Time
+
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	probing   bool
+}
+
+func newCircuitBreaker(threshold int, openDuration time.Duration) *circuitBreaker {
+	return &circuitBreaker{
+		threshold:    threshold,
+		openDuration: openDuration,
+		now:          time.Now,
+	}
+}
+
+// allow checks if a request may be sent, which is a probe if the open duration has passed.
+func (b *circuitBreaker) allow() bool {
+	if b.threshold <= 0 {
+		return true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.failures < b.threshold {
+		return true
+	}
+	if b.probing || b.now().Before(b.openUntil) {
+		return false
+	}
+
+	b.probing = true
+	return true
+}
+
+// done records the result of an allowed request. Only transient errors count as failures.
+func (b *circuitBreaker) done(err error) {
+	if b.threshold <= 0 {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+	if err == nil || !isTransientError(err) {
+		b.failures = 0
+		metalAPICircuitOpen.Set(0)
+		return
+	}
+
+	b.failures++
+	if b.failures >= b.threshold {
+		b.openUntil = b.now().Add(b.openDuration)
+		metalAPICircuitOpen.Set(1)
+	}
+}
+
+// skip records an allowed request which wasn't sent, keeping the failures counted so far.
+func (b *circuitBreaker) skip() {
+	if b.threshold <= 0 {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+}
+
+// open returns whether the breaker stops requests and the time until the next probe.
+func (b *circuitBreaker) open() (bool, time.Duration) {
+	if b.threshold <= 0 {
+		return false, 0
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.failures < b.threshold {
+		return false, 0
+	}
+	if d := b.openUntil.Sub(b.now()); d > 0 {
+		return true, d
+	}
+	return b.probing, b.openDuration
+}
+
+func (c *limitedMetalStackClient) FirewallCreate(fcr *metalgo.FirewallCreateRequest) (_ *metalgo.FirewallCreateResponse, err error) {
+	if err := c.acquire(); err != nil {
+		return nil, err
+	}
+	defer c.release(&err)
+	return c.client.FirewallCreate(fcr)
+}
+
+func (c *limitedMetalStackClient) FirewallGet(machineID string) (_ *metalgo.FirewallGetResponse, err error) {
+	if err := c.acquire(); err != nil {
+		return nil, err
+	}
+	defer c.release(&err)
+	return c.client.FirewallGet(machineID)
+}
+
+func (c *limitedMetalStackClient) FirewallFind(ffr *metalgo.FirewallFindRequest) (_ *metalgo.FirewallListResponse, err error) {
+	if err := c.acquire(); err != nil {
+		return nil, err
+	}
+	defer c.release(&err)
+	return c.client.FirewallFind(ffr)
+}
+
+func (c *limitedMetalStackClient) IPAllocate(iar *metalgo.IPAllocateRequest) (_ *metalgo.IPDetailResponse, err error) {
+	if err := c.acquire(); err != nil {
+		return nil, err
+	}
+	defer c.release(&err)
+	return c.client.IPAllocate(iar)
+}
+
+func (c *limitedMetalStackClient) IPFree(id string) (_ *metalgo.IPDetailResponse, err error) {
+	if err := c.acquire(); err != nil {
+		return nil, err
+	}
+	defer c.release(&err)
+	return c.client.IPFree(id)
+}
+
+func (c *limitedMetalStackClient) IPGet(ipaddress string) (_ *metalgo.IPDetailResponse, err error) {
+	if err := c.acquire(); err != nil {
+		return nil, err
+	}
+	defer c.release(&err)
+	return c.client.IPGet(ipaddress)
+}
+
+func (c *limitedMetalStackClient) IPFind(ifr *metalgo.IPFindRequest) (_ *metalgo.IPListResponse, err error) {
+	if err := c.acquire(); err != nil {
+		return nil, err
+	}
+	defer c.release(&err)
+	return c.client.IPFind(ifr)
+}
+
+func (c *limitedMetalStackClient) MachineCreate(mcr *metalgo.MachineCreateRequest) (_ *metalgo.MachineCreateResponse, err error) {
+	if err := c.acquire(); err != nil {
+		return nil, err
+	}
+	defer c.release(&err)
+	return c.client.MachineCreate(mcr)
+}
+
+func (c *limitedMetalStackClient) MachineDelete(machineID string) (_ *metalgo.MachineDeleteResponse, err error) {
+	if err := c.acquire(); err != nil {
+		return nil, err
+	}
+	defer c.release(&err)
+	return c.client.MachineDelete(machineID)
+}
+
+func (c *limitedMetalStackClient) MachineFind(mfr *metalgo.MachineFindRequest) (_ *metalgo.MachineListResponse, err error) {
+	if err := c.acquire(); err != nil {
+		return nil, err
+	}
+	defer c.release(&err)
+	return c.client.MachineFind(mfr)
+}
+
+func (c *limitedMetalStackClient) MachineGet(id string) (_ *metalgo.MachineGetResponse, err error) {
+	if err := c.acquire(); err != nil {
+		return nil, err
+	}
+	defer c.release(&err)
+	return c.client.MachineGet(id)
+}
+
+func (c *limitedMetalStackClient) MachinePowerOff(machineID string) (_ *metalgo.MachinePowerResponse, err error) {
+	if err := c.acquire(); err != nil {
+		return nil, err
+	}
+	defer c.release(&err)
+	return c.client.MachinePowerOff(machineID)
+}
+
+func (c *limitedMetalStackClient) MachinePowerOn(machineID string) (_ *metalgo.MachinePowerResponse, err error) {
+	if err := c.acquire(); err != nil {
+		return nil, err
+	}
+	defer c.release(&err)
+	return c.client.MachinePowerOn(machineID)
+}
+
+func (c *limitedMetalStackClient) MachinePowerReset(machineID string) (_ *metalgo.MachinePowerResponse, err error) {
+	if err := c.acquire(); err != nil {
+		return nil, err
+	}
+	defer c.release(&err)
+	return c.client.MachinePowerReset(machineID)
+}
+
+func (c *limitedMetalStackClient) MachineReinstall(machineID, imageID, description string) (_ *metalgo.MachineGetResponse, err error) {
+	if err := c.acquire(); err != nil {
+		return nil, err
+	}
+	defer c.release(&err)
+	return c.client.MachineReinstall(machineID, imageID, description)
+}
+
+func (c *limitedMetalStackClient) NetworkAllocate(ncr *metalgo.NetworkAllocateRequest) (_ *metalgo.NetworkDetailResponse, err error) {
+	if err := c.acquire(); err != nil {
+		return nil, err
+	}
+	defer c.release(&err)
+	return c.client.NetworkAllocate(ncr)
+}
+
+func (c *limitedMetalStackClient) NetworkFind(nfr *metalgo.NetworkFindRequest) (_ *metalgo.NetworkListResponse, err error) {
+	if err := c.acquire(); err != nil {
+		return nil, err
+	}
+	defer c.release(&err)
+	return c.client.NetworkFind(nfr)
+}
+
+func (c *limitedMetalStackClient) NetworkFree(id string) (_ *metalgo.NetworkDetailResponse, err error) {
+	if err := c.acquire(); err != nil {
+		return nil, err
+	}
+	defer c.release(&err)
+	return c.client.NetworkFree(id)
+}
+
+func (c *limitedMetalStackClient) PartitionCapacity() (_ *metalgo.PartitionCapacityResponse, err error) {
+	if err := c.acquire(); err != nil {
+		return nil, err
+	}
+	defer c.release(&err)
+	return c.client.PartitionCapacity()
+}
+
+func (c *limitedMetalStackClient) PartitionList() (_ *metalgo.PartitionListResponse, err error) {
+	if err := c.acquire(); err != nil {
+		return nil, err
+	}
+	defer c.release(&err)
+	return c.client.PartitionList()
+}
@@ -0,0 +1,137 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	metalgo "github.com/metal-stack/metal-go"
+	metalmachine "github.com/metal-stack/metal-go/api/client/machine"
+	"golang.org/x/time/rate"
+
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+
+	"github.com/metal-stack/cluster-api-provider-metalstack/controllers/mocks"
+)
+
+var _ = Describe("Limited MetalStackClient", func() {
+	ctrl := gomock.NewController(GinkgoT())
+	metalClient := mocks.NewMockMetalStackClient(ctrl)
+
+	type CircuitBreakerTestCase struct {
+		Errors  []error
+		Elapsed time.Duration
+		Open    bool
+	}
+
+	DescribeTable("Circuit breaker",
+		func(tc CircuitBreakerTestCase) {
+			now := time.Now()
+			c := NewLimitedMetalStackClient(metalClient, LimiterOptions{FailureThreshold: 2, OpenDuration: time.Minute}).(*limitedMetalStackClient)
+			c.breaker.now = func() time.Time { return now }
+
+			for _, err := range tc.Errors {
+				metalClient.EXPECT().MachineGet("id").Return(&metalgo.MachineGetResponse{}, err)
+				_, _ = c.MachineGet("id")
+			}
+			now = now.Add(tc.Elapsed)
+
+			_, ok := requeueWhileCircuitOpen(c)
+			Expect(ok).To(Equal(tc.Open))
+			if tc.Open {
+				_, err := c.MachineGet("id")
+				Expect(err).To(Equal(errCircuitOpen))
+			}
+		},
+		Entry("Should stay closed below the threshold", CircuitBreakerTestCase{
+			Errors: []error{context.DeadlineExceeded, nil, context.DeadlineExceeded},
+		}),
+		Entry("Should stay closed on terminal errors", CircuitBreakerTestCase{
+			Errors: []error{metalmachine.NewAllocateMachineDefault(http.StatusBadRequest), metalmachine.NewAllocateMachineDefault(http.StatusBadRequest)},
+		}),
+		Entry("Should open on consecutive transient errors", CircuitBreakerTestCase{
+			Errors: []error{context.DeadlineExceeded, metalmachine.NewAllocateMachineDefault(http.StatusServiceUnavailable)},
+			Open:   true,
+		}),
+		Entry("Should probe after the open duration", CircuitBreakerTestCase{
+			Errors:  []error{context.DeadlineExceeded, context.DeadlineExceeded},
+			Elapsed: 2 * time.Minute,
+		}),
+	)
+
+	It("Should keep counting transient errors across rate-limited requests", func() {
+		metalClient := mocks.NewMockMetalStackClient(ctrl)
+		metalClient.EXPECT().MachineGet("id").Return(nil, context.DeadlineExceeded).Times(2)
+		c := NewLimitedMetalStackClient(metalClient, LimiterOptions{QPS: 0.001, Burst: 1, FailureThreshold: 2, OpenDuration: time.Minute}).(*limitedMetalStackClient)
+		c.maxWait = 0
+
+		_, err := c.MachineGet("id")
+		Expect(err).To(Equal(context.DeadlineExceeded))
+		_, err = c.MachineGet("id")
+		Expect(err).To(Equal(errRateLimited))
+		_, ok := requeueWhileCircuitOpen(c)
+		Expect(ok).To(BeFalse())
+
+		c.limiter.SetLimit(rate.Inf)
+		_, err = c.MachineGet("id")
+		Expect(err).To(Equal(context.DeadlineExceeded))
+		_, ok = requeueWhileCircuitOpen(c)
+		Expect(ok).To(BeTrue())
+	})
+
+	type RateLimiterTestCase struct {
+		Opts        LimiterOptions
+		Requests    int
+		RateLimited bool
+	}
+
+	DescribeTable("Rate limiter",
+		func(tc RateLimiterTestCase) {
+			metalClient := mocks.NewMockMetalStackClient(ctrl)
+			metalClient.EXPECT().MachineGet("id").Return(&metalgo.MachineGetResponse{}, nil).AnyTimes()
+			c := NewLimitedMetalStackClient(metalClient, tc.Opts).(*limitedMetalStackClient)
+			c.maxWait = 0
+
+			var err error
+			for i := 0; i < tc.Requests; i++ {
+				_, err = c.MachineGet("id")
+			}
+			if tc.RateLimited {
+				Expect(err).To(Equal(errRateLimited))
+			} else {
+				Expect(err).NotTo(HaveOccurred())
+			}
+		},
+		Entry("Should allow a request without burst", RateLimiterTestCase{
+			Opts:     LimiterOptions{QPS: 0.001},
+			Requests: 1,
+		}),
+		Entry("Should fail a request exceeding the maximum delay", RateLimiterTestCase{
+			Opts:        LimiterOptions{QPS: 0.001, Burst: 1},
+			Requests:    2,
+			RateLimited: true,
+		}),
+		Entry("Should allow requests without QPS", RateLimiterTestCase{
+			Requests: 3,
+		}),
+	)
+})
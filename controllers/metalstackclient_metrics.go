@@ -0,0 +1,137 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"time"
+
+	metalgo "github.com/metal-stack/metal-go"
+)
+
+// instrumentedMetalStackClient records the count, the errors and the latency of the requests to `metal-API`.
+type instrumentedMetalStackClient struct {
+	client MetalStackClient
+}
+
+// NewInstrumentedMetalStackClient decorates the client with Prometheus metrics.
+func NewInstrumentedMetalStackClient(client MetalStackClient) MetalStackClient {
+	return &instrumentedMetalStackClient{client: client}
+}
+
+func (c *instrumentedMetalStackClient) pin() MetalStackClient {
+	return &instrumentedMetalStackClient{client: pinMetalStackClient(c.client)}
+}
+
+func (c *instrumentedMetalStackClient) FirewallCreate(fcr *metalgo.FirewallCreateRequest) (_ *metalgo.FirewallCreateResponse, err error) {
+	defer observeMetalAPIRequest("FirewallCreate", time.Now(), &err)
+	return c.client.FirewallCreate(fcr)
+}
+
+func (c *instrumentedMetalStackClient) FirewallGet(machineID string) (_ *metalgo.FirewallGetResponse, err error) {
+	defer observeMetalAPIRequest("FirewallGet", time.Now(), &err)
+	return c.client.FirewallGet(machineID)
+}
+
+func (c *instrumentedMetalStackClient) FirewallFind(ffr *metalgo.FirewallFindRequest) (_ *metalgo.FirewallListResponse, err error) {
+	defer observeMetalAPIRequest("FirewallFind", time.Now(), &err)
+	return c.client.FirewallFind(ffr)
+}
+
+func (c *instrumentedMetalStackClient) IPAllocate(iar *metalgo.IPAllocateRequest) (_ *metalgo.IPDetailResponse, err error) {
+	defer observeMetalAPIRequest("IPAllocate", time.Now(), &err)
+	return c.client.IPAllocate(iar)
+}
+
+func (c *instrumentedMetalStackClient) IPFree(id string) (_ *metalgo.IPDetailResponse, err error) {
+	defer observeMetalAPIRequest("IPFree", time.Now(), &err)
+	return c.client.IPFree(id)
+}
+
+func (c *instrumentedMetalStackClient) IPGet(ipaddress string) (_ *metalgo.IPDetailResponse, err error) {
+	defer observeMetalAPIRequest("IPGet", time.Now(), &err)
+	return c.client.IPGet(ipaddress)
+}
+
+func (c *instrumentedMetalStackClient) IPFind(ifr *metalgo.IPFindRequest) (_ *metalgo.IPListResponse, err error) {
+	defer observeMetalAPIRequest("IPFind", time.Now(), &err)
+	return c.client.IPFind(ifr)
+}
+
+func (c *instrumentedMetalStackClient) MachineCreate(mcr *metalgo.MachineCreateRequest) (_ *metalgo.MachineCreateResponse, err error) {
+	defer observeMetalAPIRequest("MachineCreate", time.Now(), &err)
+	return c.client.MachineCreate(mcr)
+}
+
+func (c *instrumentedMetalStackClient) MachineDelete(machineID string) (_ *metalgo.MachineDeleteResponse, err error) {
+	defer observeMetalAPIRequest("MachineDelete", time.Now(), &err)
+	return c.client.MachineDelete(machineID)
+}
+
+func (c *instrumentedMetalStackClient) MachineFind(mfr *metalgo.MachineFindRequest) (_ *metalgo.MachineListResponse, err error) {
+	defer observeMetalAPIRequest("MachineFind", time.Now(), &err)
+	return c.client.MachineFind(mfr)
+}
+
+func (c *instrumentedMetalStackClient) MachineGet(id string) (_ *metalgo.MachineGetResponse, err error) {
+	defer observeMetalAPIRequest("MachineGet", time.Now(), &err)
+	return c.client.MachineGet(id)
+}
+
+func (c *instrumentedMetalStackClient) MachinePowerOff(machineID string) (_ *metalgo.MachinePowerResponse, err error) {
+	defer observeMetalAPIRequest("MachinePowerOff", time.Now(), &err)
+	return c.client.MachinePowerOff(machineID)
+}
+
+func (c *instrumentedMetalStackClient) MachinePowerOn(machineID string) (_ *metalgo.MachinePowerResponse, err error) {
+	defer observeMetalAPIRequest("MachinePowerOn", time.Now(), &err)
+	return c.client.MachinePowerOn(machineID)
+}
+
+func (c *instrumentedMetalStackClient) MachinePowerReset(machineID string) (_ *metalgo.MachinePowerResponse, err error) {
+	defer observeMetalAPIRequest("MachinePowerReset", time.Now(), &err)
+	return c.client.MachinePowerReset(machineID)
+}
+
+func (c *instrumentedMetalStackClient) MachineReinstall(machineID, imageID, description string) (_ *metalgo.MachineGetResponse, err error) {
+	defer observeMetalAPIRequest("MachineReinstall", time.Now(), &err)
+	return c.client.MachineReinstall(machineID, imageID, description)
+}
+
+func (c *instrumentedMetalStackClient) NetworkAllocate(ncr *metalgo.NetworkAllocateRequest) (_ *metalgo.NetworkDetailResponse, err error) {
+	defer observeMetalAPIRequest("NetworkAllocate", time.Now(), &err)
+	return c.client.NetworkAllocate(ncr)
+}
+
+func (c *instrumentedMetalStackClient) NetworkFind(nfr *metalgo.NetworkFindRequest) (_ *metalgo.NetworkListResponse, err error) {
+	defer observeMetalAPIRequest("NetworkFind", time.Now(), &err)
+	return c.client.NetworkFind(nfr)
+}
+
+func (c *instrumentedMetalStackClient) NetworkFree(id string) (_ *metalgo.NetworkDetailResponse, err error) {
+	defer observeMetalAPIRequest("NetworkFree", time.Now(), &err)
+	return c.client.NetworkFree(id)
+}
+
+func (c *instrumentedMetalStackClient) PartitionCapacity() (_ *metalgo.PartitionCapacityResponse, err error) {
+	defer observeMetalAPIRequest("PartitionCapacity", time.Now(), &err)
+	return c.client.PartitionCapacity()
+}
+
+func (c *instrumentedMetalStackClient) PartitionList() (_ *metalgo.PartitionListResponse, err error) {
+	defer observeMetalAPIRequest("PartitionList", time.Now(), &err)
+	return c.client.PartitionList()
+}
@@ -0,0 +1,57 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+
+	metalgo "github.com/metal-stack/metal-go"
+
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/metal-stack/cluster-api-provider-metalstack/controllers/mocks"
+)
+
+var _ = Describe("Instrumented MetalStackClient", func() {
+	ctrl := gomock.NewController(GinkgoT())
+	metalClient := mocks.NewMockMetalStackClient(ctrl)
+	instrumentedClient := NewInstrumentedMetalStackClient(metalClient)
+
+	DescribeTable("Count requests",
+		func(err error, errors float64) {
+			requests := testutil.ToFloat64(metalAPIRequests.WithLabelValues("NetworkFree"))
+			failed := testutil.ToFloat64(metalAPIRequestErrors.WithLabelValues("NetworkFree"))
+
+			metalClient.EXPECT().NetworkFree("id").Return(&metalgo.NetworkDetailResponse{}, err)
+			_, e := instrumentedClient.NetworkFree("id")
+			if err != nil {
+				Expect(e).To(HaveOccurred())
+			} else {
+				Expect(e).NotTo(HaveOccurred())
+			}
+
+			Expect(testutil.ToFloat64(metalAPIRequests.WithLabelValues("NetworkFree"))).To(Equal(requests + 1))
+			Expect(testutil.ToFloat64(metalAPIRequestErrors.WithLabelValues("NetworkFree"))).To(Equal(failed + errors))
+		},
+		Entry("Should count successful request", nil, 0.0),
+		Entry("Should count failed request", fmt.Errorf("error"), 1.0),
+	)
+})
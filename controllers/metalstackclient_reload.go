@@ -0,0 +1,267 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-logr/logr"
+	metalgo "github.com/metal-stack/metal-go"
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	configv1 "github.com/metal-stack/cluster-api-provider-metalstack/api/config/v1alpha1"
+)
+
+// MetalAPICredentials are the URL of `metal-API` and the credentials the client authenticates with.
+// The token and the HMAC key are exclusive, so at most one of them is set.
+type MetalAPICredentials struct {
+	URL   string
+	HMAC  string
+	Token string
+}
+
+// LoadMetalAPICredentials reads the URL and the credentials of `metal-API` from the configured files.
+// Without files the HMAC key is read from the environment.
+func LoadMetalAPICredentials(config configv1.MetalAPIConfig) (MetalAPICredentials, error) {
+	credentials := MetalAPICredentials{URL: config.URL}
+
+	var err error
+	if config.URLFile != "" {
+		credentials.URL, err = readCredentialsFile(config.URLFile)
+		if err != nil {
+			return credentials, err
+		}
+	}
+
+	switch {
+	case config.TokenFile != "":
+		credentials.Token, err = readCredentialsFile(config.TokenFile)
+	case config.HMACFile != "":
+		credentials.HMAC, err = readCredentialsFile(config.HMACFile)
+	default:
+		credentials.HMAC = os.Getenv("METALCTL_HMAC")
+	}
+	return credentials, err
+}
+
+func readCredentialsFile(name string) (string, error) {
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		return "", fmt.Errorf("failed to read credentials: %w", err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// ReloadingMetalStackClient forwards the requests to a client which is recreated when the credentials change,
+// e.g. when a token is rotated. The client is swapped atomically. The reconcilers pin the client once per reconcilation,
+// so that reconcilations in flight finish on the former client.
+type ReloadingMetalStackClient struct {
+	load      func() (MetalAPICredentials, error)
+	newClient func(MetalAPICredentials) (MetalStackClient, error)
+	interval  time.Duration
+	log       logr.Logger
+
+	// onURLChange are called after the client of another URL was swapped in.
+	onURLChange []func()
+
+	// current holds the reloadedClient.
+	current atomic.Value
+}
+
+type reloadedClient struct {
+	client      MetalStackClient
+	credentials MetalAPICredentials
+}
+
+// NewReloadingMetalStackClient creates the client with the loaded credentials.
+// Once started, the credentials are loaded again every interval.
+func NewReloadingMetalStackClient(
+	load func() (MetalAPICredentials, error),
+	newClient func(MetalAPICredentials) (MetalStackClient, error),
+	interval time.Duration,
+	log logr.Logger,
+) (*ReloadingMetalStackClient, error) {
+	c := &ReloadingMetalStackClient{
+		load:      load,
+		newClient: newClient,
+		interval:  interval,
+		log:       log,
+	}
+	if err := c.reload(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Start reloads the credentials until the context is done. It implements manager.Runnable.
+func (c *ReloadingMetalStackClient) Start(ctx context.Context) error {
+	wait.Until(func() {
+		if err := c.reload(); err != nil {
+			c.log.Error(err, "unable to reload metal-API credentials, keeping the former ones")
+		}
+	}, c.interval, ctx.Done())
+	return nil
+}
+
+// NeedLeaderElection tells that the credentials are reloaded by every replica of the manager.
+func (c *ReloadingMetalStackClient) NeedLeaderElection() bool {
+	return false
+}
+
+// OnURLChange registers a function which is called when the URL of `metal-API` changed,
+// e.g. to flush what was cached from the former `metal-API`. It must be registered before the client is started.
+func (c *ReloadingMetalStackClient) OnURLChange(f func()) {
+	c.onURLChange = append(c.onURLChange, f)
+}
+
+// reload swaps the client if the credentials changed.
+func (c *ReloadingMetalStackClient) reload() error {
+	credentials, err := c.load()
+	if err != nil {
+		return err
+	}
+	current, ok := c.current.Load().(*reloadedClient)
+	if ok && current.credentials == credentials {
+		return nil
+	}
+
+	client, err := c.newClient(credentials)
+	if err != nil {
+		return err
+	}
+	c.current.Store(&reloadedClient{client: client, credentials: credentials})
+	if !ok {
+		return nil
+	}
+
+	c.log.Info("metal-API credentials changed, client reloaded")
+	if current.credentials.URL != credentials.URL {
+		for _, f := range c.onURLChange {
+			f()
+		}
+	}
+	return nil
+}
+
+func (c *ReloadingMetalStackClient) client() MetalStackClient {
+	return c.current.Load().(*reloadedClient).client
+}
+
+// pin returns the current client, which keeps serving the requests even if the credentials are reloaded.
+func (c *ReloadingMetalStackClient) pin() MetalStackClient {
+	return c.client()
+}
+
+// metalStackClientPinner is implemented by clients whose requests may be served by another client over time.
+type metalStackClientPinner interface {
+	pin() MetalStackClient
+}
+
+// pinMetalStackClient returns a client which serves all its requests by the current client,
+// so that a reconcilation isn't split between the former and the reloaded credentials.
+func pinMetalStackClient(client MetalStackClient) MetalStackClient {
+	if p, ok := client.(metalStackClientPinner); ok {
+		return p.pin()
+	}
+	return client
+}
+
+func (c *ReloadingMetalStackClient) FirewallCreate(fcr *metalgo.FirewallCreateRequest) (*metalgo.FirewallCreateResponse, error) {
+	return c.client().FirewallCreate(fcr)
+}
+
+func (c *ReloadingMetalStackClient) FirewallGet(machineID string) (*metalgo.FirewallGetResponse, error) {
+	return c.client().FirewallGet(machineID)
+}
+
+func (c *ReloadingMetalStackClient) FirewallFind(ffr *metalgo.FirewallFindRequest) (*metalgo.FirewallListResponse, error) {
+	return c.client().FirewallFind(ffr)
+}
+
+func (c *ReloadingMetalStackClient) IPAllocate(iar *metalgo.IPAllocateRequest) (*metalgo.IPDetailResponse, error) {
+	return c.client().IPAllocate(iar)
+}
+
+func (c *ReloadingMetalStackClient) IPFree(id string) (*metalgo.IPDetailResponse, error) {
+	return c.client().IPFree(id)
+}
+
+func (c *ReloadingMetalStackClient) IPGet(ipaddress string) (*metalgo.IPDetailResponse, error) {
+	return c.client().IPGet(ipaddress)
+}
+
+func (c *ReloadingMetalStackClient) IPFind(ifr *metalgo.IPFindRequest) (*metalgo.IPListResponse, error) {
+	return c.client().IPFind(ifr)
+}
+
+func (c *ReloadingMetalStackClient) MachineCreate(mcr *metalgo.MachineCreateRequest) (*metalgo.MachineCreateResponse, error) {
+	return c.client().MachineCreate(mcr)
+}
+
+func (c *ReloadingMetalStackClient) MachineDelete(machineID string) (*metalgo.MachineDeleteResponse, error) {
+	return c.client().MachineDelete(machineID)
+}
+
+func (c *ReloadingMetalStackClient) MachineFind(mfr *metalgo.MachineFindRequest) (*metalgo.MachineListResponse, error) {
+	return c.client().MachineFind(mfr)
+}
+
+func (c *ReloadingMetalStackClient) MachineGet(id string) (*metalgo.MachineGetResponse, error) {
+	return c.client().MachineGet(id)
+}
+
+func (c *ReloadingMetalStackClient) MachinePowerOff(machineID string) (*metalgo.MachinePowerResponse, error) {
+	return c.client().MachinePowerOff(machineID)
+}
+
+func (c *ReloadingMetalStackClient) MachinePowerOn(machineID string) (*metalgo.MachinePowerResponse, error) {
+	return c.client().MachinePowerOn(machineID)
+}
+
+func (c *ReloadingMetalStackClient) MachinePowerReset(machineID string) (*metalgo.MachinePowerResponse, error) {
+	return c.client().MachinePowerReset(machineID)
+}
+
+func (c *ReloadingMetalStackClient) MachineReinstall(machineID, imageID, description string) (*metalgo.MachineGetResponse, error) {
+	return c.client().MachineReinstall(machineID, imageID, description)
+}
+
+func (c *ReloadingMetalStackClient) NetworkAllocate(ncr *metalgo.NetworkAllocateRequest) (*metalgo.NetworkDetailResponse, error) {
+	return c.client().NetworkAllocate(ncr)
+}
+
+func (c *ReloadingMetalStackClient) NetworkFind(nfr *metalgo.NetworkFindRequest) (*metalgo.NetworkListResponse, error) {
+	return c.client().NetworkFind(nfr)
+}
+
+func (c *ReloadingMetalStackClient) NetworkFree(id string) (*metalgo.NetworkDetailResponse, error) {
+	return c.client().NetworkFree(id)
+}
+
+func (c *ReloadingMetalStackClient) PartitionCapacity() (*metalgo.PartitionCapacityResponse, error) {
+	return c.client().PartitionCapacity()
+}
+
+func (c *ReloadingMetalStackClient) PartitionList() (*metalgo.PartitionListResponse, error) {
+	return c.client().PartitionList()
+}
@@ -0,0 +1,172 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	metalgo "github.com/metal-stack/metal-go"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+
+	configv1 "github.com/metal-stack/cluster-api-provider-metalstack/api/config/v1alpha1"
+	"github.com/metal-stack/cluster-api-provider-metalstack/controllers/mocks"
+)
+
+var _ = Describe("metal-API credentials reload", func() {
+
+	type ReloadTestCase struct {
+		// Tokens are loaded in turn, an empty token fails to load.
+		Tokens []string
+		// URLs are loaded in turn along with the tokens, if set.
+		URLs []string
+		// Clients is the expected number of created clients.
+		Clients int
+		// Token is the expected token of the client in use.
+		Token string
+		// URLChanges is the expected number of notified URL changes.
+		URLChanges int
+	}
+
+	DescribeTable("Reload credentials",
+		func(tc ReloadTestCase) {
+			ctrl := gomock.NewController(GinkgoT())
+			defer ctrl.Finish()
+
+			loaded := 0
+			load := func() (MetalAPICredentials, error) {
+				token := tc.Tokens[loaded]
+				url := "https://metal-api"
+				if tc.URLs != nil {
+					url = tc.URLs[loaded]
+				}
+				loaded++
+				if token == "" {
+					return MetalAPICredentials{}, fmt.Errorf("file not found")
+				}
+				return MetalAPICredentials{URL: url, Token: token}, nil
+			}
+			clients := make(map[MetalStackClient]string)
+			newClient := func(credentials MetalAPICredentials) (MetalStackClient, error) {
+				client := mocks.NewMockMetalStackClient(ctrl)
+				clients[client] = credentials.Token
+				return client, nil
+			}
+
+			c, err := NewReloadingMetalStackClient(load, newClient, time.Minute, zap.New(zap.UseDevMode(true)))
+			Expect(err).NotTo(HaveOccurred())
+			urlChanges := 0
+			c.OnURLChange(func() { urlChanges++ })
+			pinned := pinMetalStackClient(c)
+			for range tc.Tokens[1:] {
+				_ = c.reload()
+			}
+
+			Expect(clients).To(HaveLen(tc.Clients))
+			Expect(clients[c.client()]).To(Equal(tc.Token))
+			Expect(clients[pinned]).To(Equal(tc.Tokens[0]))
+			Expect(urlChanges).To(Equal(tc.URLChanges))
+		},
+		Entry("Should swap the client if the token is rotated", ReloadTestCase{
+			Tokens:  []string{"old", "new"},
+			Clients: 2,
+			Token:   "new",
+		}),
+		Entry("Should keep the client if the credentials are unchanged", ReloadTestCase{
+			Tokens:  []string{"old", "old"},
+			Clients: 1,
+			Token:   "old",
+		}),
+		Entry("Should keep the former client if the credentials fail to load", ReloadTestCase{
+			Tokens:  []string{"old", ""},
+			Clients: 1,
+			Token:   "old",
+		}),
+		Entry("Should notify if the URL changed", ReloadTestCase{
+			Tokens:     []string{"old", "old", "new"},
+			URLs:       []string{"https://metal-api", "https://other-metal-api", "https://other-metal-api"},
+			Clients:    3,
+			Token:      "new",
+			URLChanges: 1,
+		}),
+	)
+
+	It("Should flush the cache shared with the pinned client", func() {
+		ctrl := gomock.NewController(GinkgoT())
+		defer ctrl.Finish()
+
+		metalClient := mocks.NewMockMetalStackClient(ctrl)
+		metalClient.EXPECT().MachineGet("id").Return(&metalgo.MachineGetResponse{}, nil).Times(2)
+		c := NewCachedMetalStackClient(NewLimitedMetalStackClient(metalClient, LimiterOptions{}), CacheOptions{TTL: time.Minute})
+
+		_, err := pinMetalStackClient(c).MachineGet("id")
+		Expect(err).NotTo(HaveOccurred())
+		_, err = c.MachineGet("id")
+		Expect(err).NotTo(HaveOccurred())
+
+		FlushMetalStackClientCache(c)
+		_, err = pinMetalStackClient(c).MachineGet("id")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	type LoadCredentialsTestCase struct {
+		Config func(dir string) configv1.MetalAPIConfig
+		Want   MetalAPICredentials
+		Error  bool
+	}
+
+	DescribeTable("Load credentials",
+		func(tc LoadCredentialsTestCase) {
+			dir, err := ioutil.TempDir("", "metal-api")
+			Expect(err).NotTo(HaveOccurred())
+			defer os.RemoveAll(dir)
+			Expect(ioutil.WriteFile(filepath.Join(dir, "url"), []byte("https://metal-api\n"), 0600)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(dir, "token"), []byte("token\n"), 0600)).To(Succeed())
+
+			credentials, err := LoadMetalAPICredentials(tc.Config(dir))
+			if tc.Error {
+				Expect(err).To(HaveOccurred())
+				return
+			}
+			Expect(err).NotTo(HaveOccurred())
+			Expect(credentials).To(Equal(tc.Want))
+		},
+		Entry("Should read the URL and the token from the files", LoadCredentialsTestCase{
+			Config: func(dir string) configv1.MetalAPIConfig {
+				return configv1.MetalAPIConfig{
+					URL:       "https://ignored",
+					URLFile:   filepath.Join(dir, "url"),
+					TokenFile: filepath.Join(dir, "token"),
+				}
+			},
+			Want: MetalAPICredentials{URL: "https://metal-api", Token: "token"},
+		}),
+		Entry("Should fail if a file is missing", LoadCredentialsTestCase{
+			Config: func(dir string) configv1.MetalAPIConfig {
+				return configv1.MetalAPIConfig{URL: "https://metal-api", HMACFile: filepath.Join(dir, "hmac")}
+			},
+			Error: true,
+		}),
+	)
+})
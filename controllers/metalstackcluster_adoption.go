@@ -0,0 +1,101 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-logr/logr"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	capi "sigs.k8s.io/cluster-api/api/v1alpha4"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	api "github.com/metal-stack/cluster-api-provider-metalstack/api/v1alpha4"
+)
+
+// adoptFirewalls takes over the existing firewalls of the cluster.
+// Firewalls created without owner reference get one, so that `clusterctl move` moves them with the cluster.
+// The status of a MetalStackCluster recreated by `clusterctl move` is empty,
+// so the firewall of each replica is recovered from the firewalls labeled with it.
+func (r *MetalStackClusterReconciler) adoptFirewalls(ctx context.Context, logger logr.Logger, metalCluster *api.MetalStackCluster) error {
+	firewalls := &api.MetalStackFirewallList{}
+	if err := r.Client.List(
+		ctx,
+		firewalls,
+		client.InNamespace(metalCluster.Namespace),
+		client.MatchingLabels{capi.ClusterLabelName: metalCluster.Name},
+	); err != nil {
+		return fmt.Errorf("failed to list firewalls: %w", err)
+	}
+
+	replicas := make(map[int32][]string)
+	for i := range firewalls.Items {
+		firewall := &firewalls.Items[i]
+		if !firewall.DeletionTimestamp.IsZero() {
+			continue
+		}
+		replicas[firewall.GetReplica()] = append(replicas[firewall.GetReplica()], firewall.Name)
+
+		if metav1.GetControllerOf(firewall) != nil {
+			continue
+		}
+		if err := controllerutil.SetControllerReference(metalCluster, firewall, r.Scheme); err != nil {
+			return fmt.Errorf("set controller reference: %w", err)
+		}
+		if err := r.Client.Update(ctx, firewall); err != nil {
+			return fmt.Errorf("failed to adopt firewall %s: %w", firewall.Name, err)
+		}
+		logger.Info(fmt.Sprintf("Firewall %s is adopted", firewall.Name))
+	}
+
+	if metalCluster.Status.FirewallUpdate != nil {
+		return nil
+	}
+	for replica, names := range replicas {
+		if r.hasFirewall(metalCluster, replica, names) {
+			continue
+		}
+
+		// An interrupted update left the replacement next to the current firewall. The update is resumed then.
+		replacement, err := r.replacementFirewallName(ctx, metalCluster, replica)
+		if err != nil {
+			return err
+		}
+		for _, name := range names {
+			if name != replacement || len(names) == 1 {
+				logger.Info(fmt.Sprintf("Firewall %s of replica %d is recovered", name, replica))
+				metalCluster.SetFirewallName(replica, name)
+				break
+			}
+		}
+	}
+
+	return nil
+}
+
+// hasFirewall tells whether the firewall the status names for the replica is one of the existing ones.
+func (r *MetalStackClusterReconciler) hasFirewall(metalCluster *api.MetalStackCluster, replica int32, names []string) bool {
+	current := metalCluster.GetFirewallNamespacedName(replica).Name
+	for _, name := range names {
+		if name == current {
+			return true
+		}
+	}
+	return false
+}
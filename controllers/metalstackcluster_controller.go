@@ -19,6 +19,9 @@ package controllers
 import (
 	"context"
 	"fmt"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/go-logr/logr"
 	api "github.com/metal-stack/cluster-api-provider-metalstack/api/v1alpha4"
@@ -31,8 +34,11 @@ import (
 	capierrors "sigs.k8s.io/cluster-api/errors"
 	"sigs.k8s.io/cluster-api/util"
 	"sigs.k8s.io/cluster-api/util/annotations"
+	"sigs.k8s.io/cluster-api/util/conditions"
 	"sigs.k8s.io/cluster-api/util/patch"
+	"sigs.k8s.io/cluster-api/util/predicates"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
@@ -40,12 +46,21 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/source"
 )
 
+// capacityResyncInterval is the period in which the capacity of the partition is resynced with `metal-API`.
+const capacityResyncInterval = 5 * time.Minute
+
+// firewallDeletionInterval is the period in which a deleted cluster checks whether its firewalls are gone.
+const firewallDeletionInterval = 15 * time.Second
+
 // MetalStackClusterReconciler reconciles a MetalStackCluster object
 type MetalStackClusterReconciler struct {
 	Client           client.Client
 	Log              logr.Logger
 	MetalStackClient MetalStackClient
 	Scheme           *runtime.Scheme
+
+	// WatchFilterValue restricts the reconciled objects to those with the watch-filter label of this value, if set.
+	WatchFilterValue string
 }
 
 func NewMetalStackClusterReconciler(metalClient MetalStackClient, mgr manager.Manager) *MetalStackClusterReconciler {
@@ -63,22 +78,41 @@ func NewMetalStackClusterReconciler(metalClient MetalStackClient, mgr manager.Ma
 
 func (r *MetalStackClusterReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&api.MetalStackCluster{}).
+		For(&api.MetalStackCluster{}, builder.WithPredicates(predicates.ResourceHasFilterLabel(r.Log, r.WatchFilterValue))).
+		Owns(&api.MetalStackFirewall{}, builder.WithPredicates(predicates.ResourceHasFilterLabel(r.Log, r.WatchFilterValue))).
+		WithEventFilter(predicates.ResourceNotPaused(r.Log)).
 		Watches(
 			&source.Kind{Type: &capi.Cluster{}},
 			handler.EnqueueRequestsFromMapFunc(
 				util.ClusterToInfrastructureMapFunc(api.GroupVersion.WithKind("MetalStackCluster")),
 			),
+			builder.WithPredicates(predicates.ClusterUnpaused(r.Log), predicates.ResourceHasFilterLabel(r.Log, r.WatchFilterValue)),
 		).
+		WithOptions(controllerOptions()).
 		Complete(r)
 }
 
+// withPinnedMetalStackClient returns a copy of the reconciler which sends all requests to the current metal-API client,
+// so that a reconcilation finishes with the credentials it started with, even if they are reloaded meanwhile.
+func (r *MetalStackClusterReconciler) withPinnedMetalStackClient() *MetalStackClusterReconciler {
+	pinned := *r
+	pinned.MetalStackClient = pinMetalStackClient(r.MetalStackClient)
+	return &pinned
+}
+
 // Reconcile reconciles MetalStackCluster resource
 func (r *MetalStackClusterReconciler) Reconcile(ctx context.Context, req ctrl.Request) (_ ctrl.Result, err error) {
+	r = r.withPinnedMetalStackClient()
+
 	logger := r.Log.WithValues("MetalStackCluster", req.NamespacedName)
 
 	logger.Info("Starting MetalStackCluster reconcilation")
 
+	if res, ok := requeueWhileCircuitOpen(r.MetalStackClient); ok {
+		logger.Info(fmt.Sprintf("metal-API is unavailable, requeueing after %s", res.RequeueAfter))
+		return res, nil
+	}
+
 	// Fetch the MetalStackCluster.
 	metalCluster := &api.MetalStackCluster{}
 	if err := r.Client.Get(ctx, req.NamespacedName, metalCluster); err != nil {
@@ -107,21 +141,23 @@ func (r *MetalStackClusterReconciler) Reconcile(ctx context.Context, req ctrl.Re
 		metalCluster.Status.FailureMessage = pointer.StringPtr("Unable to get OwnerCluster")
 		return ctrl.Result{}, fmt.Errorf("get OwnerCluster: %w", err)
 	}
+	// The MetalStackCluster is reconciled again once the cluster controller set the OwnerRef.
 	if cluster == nil {
 		logger.Info("Waiting for cluster controller to set OwnerRef to MetalStackCluster")
-		return ctrl.Result{Requeue: true}, nil
+		return ctrl.Result{}, nil
 	}
 
+	// The watches reconcile the cluster again once it's unpaused, e.g. after `clusterctl move`.
 	if annotations.IsPaused(cluster, metalCluster) {
 		logger.Info("reconcilation is paused for this object")
-		return ctrl.Result{Requeue: true}, nil
+		return ctrl.Result{}, nil
 	}
 
 	if !metalCluster.ObjectMeta.DeletionTimestamp.IsZero() {
 		return r.reconcileDelete(ctx, logger, cluster, metalCluster)
 	}
 
-	return r.reconcile(ctx, logger, metalCluster)
+	return r.reconcile(ctx, logger, cluster, metalCluster)
 }
 
 func (r *MetalStackClusterReconciler) reconcileDelete(ctx context.Context, logger logr.Logger, cluster *capi.Cluster, metalCluster *api.MetalStackCluster) (ctrl.Result, error) {
@@ -146,6 +182,21 @@ func (r *MetalStackClusterReconciler) reconcileDelete(ctx context.Context, logge
 		return ctrl.Result{}, fmt.Errorf("failed to delete Firewall: %w", err)
 	}
 
+	// Egress IPs and the network are released once the firewall machines, which use them, are freed.
+	remaining, err := r.countFirewalls(ctx, metalCluster)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if remaining > 0 {
+		logger.Info("Waiting for the firewalls to be deleted", "firewalls", remaining)
+		return ctrl.Result{RequeueAfter: firewallDeletionInterval}, nil
+	}
+
+	logger.Info("Releasing egress IPs")
+	if err := r.releaseEgressIPs(logger, metalCluster); err != nil {
+		return ctrl.Result{}, err
+	}
+
 	// Delete network
 	logger.Info("Deleting Cluster network")
 	resp, err := r.MetalStackClient.NetworkFind(&metalgo.NetworkFindRequest{
@@ -158,74 +209,157 @@ func (r *MetalStackClusterReconciler) reconcileDelete(ctx context.Context, logge
 
 	if len(resp.Networks) == 1 {
 		if _, err := r.MetalStackClient.NetworkFree(*metalCluster.Spec.PrivateNetworkID); err != nil {
-			return ctrl.Result{Requeue: true}, nil
+			return ctrl.Result{}, fmt.Errorf("failed to free network: %w", err)
 		}
 	}
 
 	controllerutil.RemoveFinalizer(metalCluster, api.MetalStackClusterFinalizer)
+	deleteMachineStates(metalCluster)
 	logger.Info("Successfully deleted MetalStackCluster")
 
 	return ctrl.Result{}, nil
 }
 
-func (r *MetalStackClusterReconciler) reconcile(ctx context.Context, logger logr.Logger, metalCluster *api.MetalStackCluster) (ctrl.Result, error) {
+func (r *MetalStackClusterReconciler) reconcile(ctx context.Context, logger logr.Logger, cluster *capi.Cluster, metalCluster *api.MetalStackCluster) (ctrl.Result, error) {
 	controllerutil.AddFinalizer(metalCluster, api.MetalStackClusterFinalizer)
+	metalCluster.SetClusterID()
 
 	// Allocate network.
 	if metalCluster.Spec.PrivateNetworkID == nil {
-		if err := r.allocateNetwork(metalCluster); err != nil {
-			logger.Info(err.Error() + ": requeueing")
-			return ctrl.Result{Requeue: true}, nil
+		if err := r.allocateNetwork(logger, metalCluster); err != nil {
+			return ctrl.Result{}, err
 		}
 	}
 
 	// Allocate IP for API server
 	if !metalCluster.Status.ControlPlaneIPAllocated {
 		if err := r.allocateControlPlaneIP(logger, metalCluster); err != nil {
-			return ctrl.Result{Requeue: true}, nil
+			return ctrl.Result{}, err
 		}
 	}
 
-	firewall := &api.MetalStackFirewall{}
-	if err := r.Client.Get(ctx, metalCluster.GetFirewallNamespacedName(), firewall); err != nil {
-		if !apierrors.IsNotFound(err) {
-			return ctrl.Result{}, fmt.Errorf("failed to fetch firewall: %w", err)
+	firewallReady := true
+	if metalCluster.Spec.DisableFirewall {
+		conditions.Delete(metalCluster, api.FirewallReadyCondition)
+	} else {
+		if err := r.reconcileEgressIPs(ctx, logger, metalCluster); err != nil {
+			conditions.MarkFalse(metalCluster, api.FirewallReadyCondition, api.EgressIPFailedReason, capi.ConditionSeverityWarning, "%v", err)
+			return ctrl.Result{}, err
 		}
 
-		if err := r.createFirewall(ctx, metalCluster); err != nil {
-			return ctrl.Result{}, fmt.Errorf("failed to create firewall: %w", err)
+		ready, err := r.reconcileFirewall(ctx, logger, metalCluster)
+		if err != nil {
+			return ctrl.Result{}, err
 		}
+		firewallReady = ready
+	}
+
+	// The capacity is informational and mustn't block the cluster.
+	if capacity, err := partitionCapacity(r.MetalStackClient, metalCluster.Spec.Partition); err != nil {
+		logger.Info(err.Error())
+	} else {
+		metalCluster.Status.Capacity = capacity
+	}
+
+	if err := r.updateMachineStates(ctx, cluster, metalCluster); err != nil {
+		logger.Info(err.Error())
+	}
 
-		logger.Info("Cluster firewall is created")
+	// Machines need the egress of the firewall to boot.
+	if !firewallReady {
+		logger.Info("Waiting for the firewall to be ready")
+		return ctrl.Result{RequeueAfter: capacityResyncInterval}, nil
 	}
 
 	metalCluster.Status.Ready = true
 
-	return ctrl.Result{}, nil
+	return ctrl.Result{RequeueAfter: capacityResyncInterval}, nil
+}
+
+// updateMachineStates counts the MetalStackMachines of the cluster per state.
+func (r *MetalStackClusterReconciler) updateMachineStates(ctx context.Context, cluster *capi.Cluster, metalCluster *api.MetalStackCluster) error {
+	metalMachines := &api.MetalStackMachineList{}
+	listOptions := []client.ListOption{
+		client.InNamespace(cluster.Namespace),
+		client.MatchingLabels(map[string]string{
+			capi.ClusterLabelName: cluster.Name,
+		}),
+	}
+
+	if err := r.Client.List(ctx, metalMachines, listOptions...); err != nil {
+		return fmt.Errorf("failed to list MetalStackMachines: %w", err)
+	}
+
+	setMachineStates(metalCluster, metalMachines.Items)
+	return nil
 }
 
-func (r *MetalStackClusterReconciler) allocateNetwork(metalCluster *api.MetalStackCluster) error {
+func (r *MetalStackClusterReconciler) allocateNetwork(logger logr.Logger, metalCluster *api.MetalStackCluster) error {
+	// The spec is lost when the MetalStackCluster is restored from a backup taken before the network was allocated.
+	// Networks allocated before the cluster ID was pinned are labeled with the name of the cluster.
+	for _, clusterID := range []string{metalCluster.GetClusterID(), metalCluster.Name} {
+		found, err := r.MetalStackClient.NetworkFind(&metalgo.NetworkFindRequest{
+			PartitionID: &metalCluster.Spec.Partition,
+			ProjectID:   &metalCluster.Spec.ProjectID,
+			Labels:      map[string]string{tag.ClusterID: clusterID},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to find networks: %w", err)
+		}
+		if len(found.Networks) == 1 {
+			logger.Info(fmt.Sprintf("Network %s is already allocated, adopting it", *found.Networks[0].ID))
+			metalCluster.Spec.PrivateNetworkID = found.Networks[0].ID
+			return nil
+		}
+		if clusterID == metalCluster.Name {
+			break
+		}
+	}
+
 	resp, err := r.MetalStackClient.NetworkAllocate(&metalgo.NetworkAllocateRequest{
 		Description: metalCluster.Name,
-		Labels:      map[string]string{tag.ClusterID: metalCluster.Name},
+		Labels:      map[string]string{tag.ClusterID: metalCluster.GetClusterID()},
 		Name:        metalCluster.Spec.Partition,
 		PartitionID: metalCluster.Spec.Partition,
 		ProjectID:   metalCluster.Spec.ProjectID,
 	})
 	if err != nil {
-		return err
+		return fmt.Errorf("failed to allocate network: %w", err)
 	}
 
 	metalCluster.Spec.PrivateNetworkID = resp.Network.ID
+	observeProvisioning(provisionedNetwork, metalCluster, metalCluster.CreationTimestamp)
 
 	return nil
 }
 
 func (r *MetalStackClusterReconciler) allocateControlPlaneIP(logger logr.Logger, metalCluster *api.MetalStackCluster) error {
+	// The status is lost when the MetalStackCluster is recreated, e.g. by `clusterctl move`, but the IP is still allocated.
+	if host := metalCluster.Spec.ControlPlaneEndpoint.Host; host != "" {
+		resp, err := r.MetalStackClient.IPGet(host)
+		if err == nil && resp.IP.Projectid != nil && *resp.IP.Projectid == metalCluster.Spec.ProjectID {
+			logger.Info(fmt.Sprintf("Control Plane IP %s is already allocated, adopting it", host))
+			metalCluster.Status.ControlPlaneIPAllocated = true
+			return nil
+		}
+	} else {
+		ip, err := r.findControlPlaneIP(metalCluster)
+		if err != nil {
+			return err
+		}
+		if ip != "" {
+			logger.Info(fmt.Sprintf("Control Plane IP %s is already allocated, adopting it", ip))
+			metalCluster.Spec.ControlPlaneEndpoint.Host = ip
+			metalCluster.Status.ControlPlaneIPAllocated = true
+			return nil
+		}
+	}
+
 	req := &metalgo.IPAllocateRequest{
-		Name:      metalCluster.Name + "-api-server-IP",
+		Name:      controlPlaneIPName(metalCluster),
 		Networkid: metalCluster.Spec.PublicNetworkID,
 		Projectid: metalCluster.Spec.ProjectID,
+		Tags:      []string{metalCluster.GetClusterIDTag()},
 	}
 	if metalCluster.Spec.ControlPlaneEndpoint.Host != "" {
 		req.IPAddress = metalCluster.Spec.ControlPlaneEndpoint.Host
@@ -233,18 +367,61 @@ func (r *MetalStackClusterReconciler) allocateControlPlaneIP(logger logr.Logger,
 
 	resp, err := r.MetalStackClient.IPAllocate(req)
 	if err != nil {
-		logger.Info(fmt.Sprintf("Failed to allocate Control Plane IP %s", err))
-		return err
+		return fmt.Errorf("failed to allocate Control Plane IP: %w", err)
 	}
 
 	metalCluster.Spec.ControlPlaneEndpoint.Host = *resp.IP.Ipaddress
 	metalCluster.Status.ControlPlaneIPAllocated = true
+	observeProvisioning(provisionedIP, metalCluster, metalCluster.CreationTimestamp)
 
 	logger.Info(fmt.Sprintf("Control Plane IP %s allocated", *resp.IP.Ipaddress))
 
 	return nil
 }
 
+// findControlPlaneIP returns the Control Plane IP allocated for the cluster, or an empty string if there's none.
+// The host is lost when the MetalStackCluster is restored from a backup taken before the IP was allocated.
+// IPs allocated before they were tagged with the cluster ID are only found by their name.
+func (r *MetalStackClusterReconciler) findControlPlaneIP(metalCluster *api.MetalStackCluster) (string, error) {
+	resp, err := r.MetalStackClient.IPFind(&metalgo.IPFindRequest{
+		ProjectID: &metalCluster.Spec.ProjectID,
+		NetworkID: &metalCluster.Spec.PublicNetworkID,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to find IPs: %w", err)
+	}
+
+	legacy := ""
+	for _, ip := range resp.IPs {
+		if ip.Name != controlPlaneIPName(metalCluster) || ip.Ipaddress == nil {
+			continue
+		}
+		clusterIDTag := clusterIDTagOf(ip.Tags)
+		if clusterIDTag == metalCluster.GetClusterIDTag() {
+			return *ip.Ipaddress, nil
+		}
+		// An IP of another cluster with the same name is never adopted.
+		if clusterIDTag == "" && legacy == "" {
+			legacy = *ip.Ipaddress
+		}
+	}
+	return legacy, nil
+}
+
+// clusterIDTagOf returns the cluster ID tag among the tags, or an empty string if there's none.
+func clusterIDTagOf(tags []string) string {
+	for _, t := range tags {
+		if strings.HasPrefix(t, tag.ClusterID+"=") {
+			return t
+		}
+	}
+	return ""
+}
+
+func controlPlaneIPName(metalCluster *api.MetalStackCluster) string {
+	return metalCluster.Name + "-api-server-IP"
+}
+
 func (r *MetalStackClusterReconciler) countMachines(ctx context.Context, cluster *capi.Cluster) (count int, err error) {
 	machines := capi.MachineList{}
 	listOptions := []client.ListOption{
@@ -273,18 +450,181 @@ func (r *MetalStackClusterReconciler) deleteMachines(ctx context.Context, cluste
 	return r.Client.DeleteAllOf(ctx, &machine, deleteOptions...)
 }
 
-func (r *MetalStackClusterReconciler) createFirewall(ctx context.Context, metalCluster *api.MetalStackCluster) error {
+// reconcileFirewall creates the firewalls of the cluster and reports whether a majority of them is ready.
+// The replicas are created one after the other, so that each of them can be placed in another rack.
+// An outdated firewall is replaced by a rolling update, one replica at a time.
+func (r *MetalStackClusterReconciler) reconcileFirewall(ctx context.Context, logger logr.Logger, metalCluster *api.MetalStackCluster) (ready bool, err error) {
+	if err := r.adoptFirewalls(ctx, logger, metalCluster); err != nil {
+		return false, err
+	}
+
+	if err := r.deleteSurplusFirewalls(ctx, logger, metalCluster); err != nil {
+		return false, err
+	}
+
+	update := metalCluster.Status.FirewallUpdate
+	if update != nil {
+		if err := r.reconcileFirewallUpdate(ctx, logger, metalCluster); err != nil {
+			return false, err
+		}
+	}
+
+	replicas := metalCluster.GetFirewallReplicas()
+	firewalls := make([]*api.MetalStackFirewall, replicas)
+	readyReplicas := int32(0)
+	placed := true
+	for replica := int32(0); replica < replicas; replica++ {
+		// The firewall was ready when the update started and some firewall routes the traffic of the replica throughout it.
+		if update != nil && update.Replica == replica {
+			readyReplicas++
+			continue
+		}
+
+		firewall := &api.MetalStackFirewall{}
+		if err := r.Client.Get(ctx, metalCluster.GetFirewallNamespacedName(replica), firewall); err != nil {
+			if !apierrors.IsNotFound(err) {
+				return false, fmt.Errorf("failed to fetch firewall: %w", err)
+			}
+			if !placed {
+				continue
+			}
+
+			name := metalCluster.GetFirewallNamespacedName(replica).Name
+			if err := r.createFirewall(ctx, metalCluster, name, replica, firewallSpec(metalCluster, replica)); err != nil {
+				conditions.MarkFalse(metalCluster, api.FirewallReadyCondition, api.FirewallCreationFailedReason, capi.ConditionSeverityWarning, "%v", err)
+				return false, fmt.Errorf("failed to create firewall: %w", err)
+			}
+
+			logger.Info(fmt.Sprintf("Cluster firewall %s is created", name))
+			placed = false
+			continue
+		}
+
+		firewalls[replica] = firewall
+		placed = placed && firewall.Spec.ProviderID != nil
+		if firewall.Status.Ready {
+			readyReplicas++
+		}
+	}
+
+	if quorum := replicas/2 + 1; readyReplicas < quorum {
+		conditions.MarkFalse(metalCluster, api.FirewallReadyCondition, api.FirewallProvisioningReason, capi.ConditionSeverityInfo,
+			"Waiting for firewalls to be ready: %d of %d are ready, %d are required", readyReplicas, replicas, quorum)
+		return false, nil
+	}
+
+	conditions.MarkTrue(metalCluster, api.FirewallReadyCondition)
+	if readyReplicas < replicas {
+		logger.Info(fmt.Sprintf("%d of %d firewalls are ready", readyReplicas, replicas))
+		return true, nil
+	}
+
+	// An update mustn't reduce the number of ready firewalls.
+	if update == nil {
+		r.updateOutdatedFirewall(ctx, logger, metalCluster, firewalls)
+	}
+
+	return true, nil
+}
+
+// updateOutdatedFirewall starts the update of the first outdated firewall.
+func (r *MetalStackClusterReconciler) updateOutdatedFirewall(
+	ctx context.Context,
+	logger logr.Logger,
+	metalCluster *api.MetalStackCluster,
+	firewalls []*api.MetalStackFirewall,
+) {
+	for replica, firewall := range firewalls {
+		reason, err := r.firewallOutdatedReason(ctx, metalCluster, firewall)
+		if err != nil {
+			logger.Info(fmt.Sprintf("Failed to check if the firewall is up to date: %s", err))
+			return
+		}
+		if reason == "" {
+			continue
+		}
+
+		if err := r.startFirewallUpdate(ctx, logger, metalCluster, int32(replica), reason); err != nil {
+			logger.Info(fmt.Sprintf("Failed to start firewall update: %s", err))
+		}
+		return
+	}
+}
+
+// deleteSurplusFirewalls deletes the firewalls of replicas which were scaled down.
+func (r *MetalStackClusterReconciler) deleteSurplusFirewalls(ctx context.Context, logger logr.Logger, metalCluster *api.MetalStackCluster) error {
+	replicas := metalCluster.GetFirewallReplicas()
+
+	firewalls := &api.MetalStackFirewallList{}
+	if err := r.Client.List(
+		ctx,
+		firewalls,
+		client.InNamespace(metalCluster.Namespace),
+		client.MatchingLabels{capi.ClusterLabelName: metalCluster.Name},
+	); err != nil {
+		return fmt.Errorf("failed to list firewalls: %w", err)
+	}
+
+	for i := range firewalls.Items {
+		firewall := &firewalls.Items[i]
+		if firewall.GetReplica() < replicas || !firewall.DeletionTimestamp.IsZero() {
+			continue
+		}
+
+		logger.Info(fmt.Sprintf("Deleting firewall %s of replica %d", firewall.Name, firewall.GetReplica()))
+		if err := r.Client.Delete(ctx, firewall); err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("failed to delete firewall %s: %w", firewall.Name, err)
+		}
+	}
+
+	if int(replicas) < len(metalCluster.Status.Firewalls) {
+		metalCluster.Status.Firewalls = metalCluster.Status.Firewalls[:replicas]
+	}
+	if update := metalCluster.Status.FirewallUpdate; update != nil && update.Replica >= replicas {
+		metalCluster.Status.FirewallUpdate = nil
+	}
+
+	return nil
+}
+
+func (r *MetalStackClusterReconciler) createFirewall(
+	ctx context.Context,
+	metalCluster *api.MetalStackCluster,
+	name string,
+	replica int32,
+	spec api.MetalStackFirewallSpec,
+) error {
 	firewall := &api.MetalStackFirewall{}
-	firewall.Name = metalCluster.Name
+	firewall.Name = name
 	firewall.Namespace = metalCluster.Namespace
-	firewall.Spec = metalCluster.Spec.FirewallSpec
+	firewall.Spec = spec
 	firewall.Labels = map[string]string{
-		capi.ClusterLabelName: metalCluster.Name,
+		capi.ClusterLabelName:    metalCluster.Name,
+		api.FirewallReplicaLabel: strconv.Itoa(int(replica)),
+	}
+	// The firewall is reconciled by the manager of the cluster.
+	if value, ok := metalCluster.Labels[capi.WatchLabel]; ok {
+		firewall.Labels[capi.WatchLabel] = value
+	}
+
+	// The owner reference triggers the reconcilation of the cluster once the firewall is ready.
+	if err := controllerutil.SetControllerReference(metalCluster, firewall, r.Scheme); err != nil {
+		return fmt.Errorf("set controller reference: %w", err)
 	}
 
 	return r.Client.Create(ctx, firewall)
 }
 
+// firewallSpec is the spec of the firewall of the replica.
+// Only the first replica is deployed on the machine the spec pins.
+func firewallSpec(metalCluster *api.MetalStackCluster, replica int32) api.MetalStackFirewallSpec {
+	spec := metalCluster.Spec.FirewallSpec.DeepCopy()
+	if replica > 0 {
+		spec.ProviderID = nil
+	}
+	return *spec
+}
+
 func (r *MetalStackClusterReconciler) deleteFirewall(ctx context.Context, metalCluster *api.MetalStackCluster) error {
 	firewall := &api.MetalStackFirewall{}
 	deleteOptions := []client.DeleteAllOfOption{
@@ -296,3 +636,18 @@ func (r *MetalStackClusterReconciler) deleteFirewall(ctx context.Context, metalC
 
 	return r.Client.DeleteAllOf(ctx, firewall, deleteOptions...)
 }
+
+// countFirewalls counts the firewalls of the cluster which weren't removed yet.
+func (r *MetalStackClusterReconciler) countFirewalls(ctx context.Context, metalCluster *api.MetalStackCluster) (int, error) {
+	firewalls := &api.MetalStackFirewallList{}
+	if err := r.Client.List(
+		ctx,
+		firewalls,
+		client.InNamespace(metalCluster.Namespace),
+		client.MatchingLabels{capi.ClusterLabelName: metalCluster.Name},
+	); err != nil {
+		return 0, fmt.Errorf("failed to list firewalls: %w", err)
+	}
+
+	return len(firewalls.Items), nil
+}
@@ -19,33 +19,48 @@ package controllers
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/golang/mock/gomock"
+	api "github.com/metal-stack/cluster-api-provider-metalstack/api/v1alpha4"
 	"github.com/metal-stack/cluster-api-provider-metalstack/controllers/mocks"
 	metalgo "github.com/metal-stack/metal-go"
 	metalmodels "github.com/metal-stack/metal-go/api/models"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/ginkgo/extensions/table"
 	. "github.com/onsi/gomega"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/utils/pointer"
+	capi "sigs.k8s.io/cluster-api/api/v1alpha4"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
 
 var _ = Describe("Reconcile MetalStackCluster", func() {
 
 	type MetalStackClusterTestCase struct {
-		Objects  []runtime.Object
-		Requeue  bool
-		Error    bool
-		MockFunc func()
+		Objects []runtime.Object
+		// RequeueAfter is the expected delay of the requeue, if set.
+		RequeueAfter time.Duration
+		Error        bool
+		MockFunc     func()
+		// Ready is the expected readiness of the MetalStackCluster, if set.
+		Ready *bool
+		// Check checks the reconciled MetalStackCluster, if set.
+		Check func(c client.Client, metalCluster *api.MetalStackCluster)
+		// WatchFilterValue is the watch-filter value of the reconciler, if set.
+		WatchFilterValue string
 	}
 
 	ctrl := gomock.NewController(GinkgoT())
 	metalClient := mocks.NewMockMetalStackClient(ctrl)
 	metalStackClusterTestFunc := func(tc MetalStackClusterTestCase) {
 		r := newTestMetalClusterReconciler(metalClient, tc.Objects)
+		r.WatchFilterValue = tc.WatchFilterValue
 		req := reconcile.Request{
 			NamespacedName: types.NamespacedName{
 				Name:      metalStackClusterName,
@@ -63,43 +78,618 @@ var _ = Describe("Reconcile MetalStackCluster", func() {
 		} else {
 			Expect(err).NotTo(HaveOccurred())
 		}
-		Expect(res.Requeue).To(Equal(tc.Requeue))
+		// Objects are never requeued immediately, but after an interval or with the backoff of errors.
+		Expect(res.Requeue).To(BeFalse())
+		if tc.RequeueAfter != 0 {
+			Expect(res.RequeueAfter).To(Equal(tc.RequeueAfter))
+		}
+
+		if tc.Ready != nil {
+			metalCluster := &api.MetalStackCluster{}
+			Expect(r.Client.Get(context.TODO(), req.NamespacedName, metalCluster)).To(Succeed())
+			Expect(metalCluster.Status.Ready).To(Equal(*tc.Ready))
+		}
+
+		if tc.Check != nil {
+			metalCluster := &api.MetalStackCluster{}
+			Expect(r.Client.Get(context.TODO(), req.NamespacedName, metalCluster)).To(Succeed())
+			tc.Check(r.Client, metalCluster)
+		}
 	}
 
+	// The network and the Control Plane IP are looked up before they are allocated.
+	// Networks are looked up by the cluster ID and by the legacy label of the cluster name.
+	expectNoNetwork := func() {
+		metalClient.EXPECT().NetworkFind(gomock.Any()).Return(&metalgo.NetworkListResponse{}, nil).Times(2)
+	}
+	expectNoControlPlaneIP := func() {
+		metalClient.EXPECT().IPFind(gomock.Any()).Return(&metalgo.IPListResponse{}, nil)
+	}
+
+	newFirewallName := metalStackClusterName + "-new"
+	getFirewall := func(c client.Client, name string) error {
+		return c.Get(context.TODO(), types.NamespacedName{Namespace: namespaceName, Name: name}, &api.MetalStackFirewall{})
+	}
+	newUpdatingMetalStackCluster := func(phase api.FirewallUpdatePhase) *api.MetalStackCluster {
+		metalCluster := newMetalStackCluster(newClusterOwnerRef(), pointer.StringPtr("privateNetworkID"), true, false)
+		metalCluster.Status.FirewallUpdate = &api.FirewallUpdate{Phase: phase, Firewall: newFirewallName}
+		return metalCluster
+	}
+
+	DescribeTable("Update Firewall", metalStackClusterTestFunc,
+		Entry("Should start update if the firewall image changed", MetalStackClusterTestCase{
+			Objects: []runtime.Object{
+				newCluster(false, false),
+				func() *api.MetalStackCluster {
+					metalCluster := newMetalStackCluster(newClusterOwnerRef(), pointer.StringPtr("privateNetworkID"), true, false)
+					metalCluster.Spec.FirewallSpec.Image = "firewall-ubuntu-2.1"
+					return metalCluster
+				}(),
+				newClusterFirewall(true),
+			},
+			Ready: pointer.BoolPtr(true),
+			Check: func(c client.Client, metalCluster *api.MetalStackCluster) {
+				Expect(metalCluster.Status.FirewallUpdate).NotTo(BeNil())
+				Expect(metalCluster.Status.FirewallUpdate.Phase).To(Equal(api.FirewallUpdateProvisioning))
+				Expect(getFirewall(c, metalCluster.Status.FirewallUpdate.Firewall)).To(Succeed())
+				Expect(getFirewall(c, metalStackClusterName)).To(Succeed())
+			},
+			MockFunc: func() {
+				metalClient.EXPECT().PartitionCapacity().Return(newPartitionCapacityResponse(1), nil)
+			},
+		}),
+		Entry("Should start update if the credentials of firewall-controller were rotated", MetalStackClusterTestCase{
+			Objects: []runtime.Object{
+				newCluster(false, false),
+				newMetalStackCluster(newClusterOwnerRef(), pointer.StringPtr("privateNetworkID"), true, false),
+				newClusterFirewall(true),
+				newFirewallControllerSecret(time.Now().Add(firewallControllerCredentialsLifetime)),
+			},
+			Ready: pointer.BoolPtr(true),
+			Check: func(c client.Client, metalCluster *api.MetalStackCluster) {
+				Expect(metalCluster.Status.FirewallUpdate).NotTo(BeNil())
+				Expect(metalCluster.Status.FirewallUpdate.Phase).To(Equal(api.FirewallUpdateProvisioning))
+			},
+			MockFunc: func() {
+				metalClient.EXPECT().PartitionCapacity().Return(newPartitionCapacityResponse(1), nil)
+			},
+		}),
+		Entry("Should not update an imported firewall if the credentials of firewall-controller were rotated", MetalStackClusterTestCase{
+			Objects: []runtime.Object{
+				newCluster(false, false),
+				newMetalStackCluster(newClusterOwnerRef(), pointer.StringPtr("privateNetworkID"), true, false),
+				func() *api.MetalStackFirewall {
+					firewall := newClusterFirewall(true)
+					firewall.Annotations = map[string]string{api.FirewallImportedAnnotation: "true"}
+					return firewall
+				}(),
+				newFirewallControllerSecret(time.Now().Add(firewallControllerCredentialsLifetime)),
+			},
+			Ready: pointer.BoolPtr(true),
+			Check: func(c client.Client, metalCluster *api.MetalStackCluster) {
+				Expect(metalCluster.Status.FirewallUpdate).To(BeNil())
+			},
+			MockFunc: func() {
+				metalClient.EXPECT().PartitionCapacity().Return(newPartitionCapacityResponse(1), nil)
+			},
+		}),
+		Entry("Should not start update if the new firewall has the name of the current one", MetalStackClusterTestCase{
+			Objects: func() []runtime.Object {
+				metalCluster := newMetalStackCluster(newClusterOwnerRef(), pointer.StringPtr("privateNetworkID"), true, false)
+				metalCluster.Spec.FirewallSpec.Image = "firewall-ubuntu-2.1"
+				name, err := newTestMetalClusterReconciler(metalClient, nil).replacementFirewallName(context.TODO(), metalCluster, 0)
+				Expect(err).NotTo(HaveOccurred())
+				metalCluster.Status.Firewalls = []string{name}
+
+				firewall := newClusterFirewall(true)
+				firewall.Name = name
+				return []runtime.Object{newCluster(false, false), metalCluster, firewall}
+			}(),
+			Ready: pointer.BoolPtr(true),
+			Check: func(c client.Client, metalCluster *api.MetalStackCluster) {
+				Expect(metalCluster.Status.FirewallUpdate).To(BeNil())
+				Expect(getFirewall(c, metalCluster.Status.Firewalls[0])).To(Succeed())
+			},
+			MockFunc: func() {
+				metalClient.EXPECT().PartitionCapacity().Return(newPartitionCapacityResponse(1), nil)
+			},
+		}),
+		Entry("Should abort update if the new firewall is the current one", MetalStackClusterTestCase{
+			Objects: []runtime.Object{
+				newCluster(false, false),
+				func() *api.MetalStackCluster {
+					metalCluster := newUpdatingMetalStackCluster(api.FirewallUpdateProvisioning)
+					metalCluster.Status.FirewallUpdate.Firewall = metalStackClusterName
+					return metalCluster
+				}(),
+				newClusterFirewall(true),
+			},
+			Error: true,
+			Check: func(c client.Client, metalCluster *api.MetalStackCluster) {
+				Expect(metalCluster.Status.FirewallUpdate).To(BeNil())
+				Expect(getFirewall(c, metalStackClusterName)).To(Succeed())
+			},
+			MockFunc: func() {
+				metalClient.EXPECT().PartitionCapacity().Return(newPartitionCapacityResponse(1), nil)
+			},
+		}),
+		Entry("Should keep the current firewall until the new one is ready", MetalStackClusterTestCase{
+			Objects: []runtime.Object{
+				newCluster(false, false),
+				newUpdatingMetalStackCluster(api.FirewallUpdateProvisioning),
+				newClusterFirewall(true),
+				func() *api.MetalStackFirewall {
+					firewall := newClusterFirewall(false)
+					firewall.Name = newFirewallName
+					return firewall
+				}(),
+			},
+			Ready: pointer.BoolPtr(true),
+			Check: func(c client.Client, metalCluster *api.MetalStackCluster) {
+				Expect(metalCluster.Status.FirewallUpdate.Phase).To(Equal(api.FirewallUpdateProvisioning))
+				Expect(getFirewall(c, metalStackClusterName)).To(Succeed())
+			},
+			MockFunc: func() {
+				metalClient.EXPECT().PartitionCapacity().Return(newPartitionCapacityResponse(1), nil)
+			},
+		}),
+		Entry("Should delete the current firewall once the new one is ready", MetalStackClusterTestCase{
+			Objects: []runtime.Object{
+				newCluster(false, false),
+				newUpdatingMetalStackCluster(api.FirewallUpdateProvisioning),
+				newClusterFirewall(true),
+				func() *api.MetalStackFirewall {
+					firewall := newClusterFirewall(true)
+					firewall.Name = newFirewallName
+					return firewall
+				}(),
+			},
+			Ready: pointer.BoolPtr(true),
+			Check: func(c client.Client, metalCluster *api.MetalStackCluster) {
+				Expect(metalCluster.Status.FirewallUpdate.Phase).To(Equal(api.FirewallUpdateDeleting))
+				Expect(apierrors.IsNotFound(getFirewall(c, metalStackClusterName))).To(BeTrue())
+			},
+			MockFunc: func() {
+				metalClient.EXPECT().PartitionCapacity().Return(newPartitionCapacityResponse(1), nil)
+			},
+		}),
+		Entry("Should complete update once the current firewall is deleted", MetalStackClusterTestCase{
+			Objects: []runtime.Object{
+				newCluster(false, false),
+				newUpdatingMetalStackCluster(api.FirewallUpdateDeleting),
+				func() *api.MetalStackFirewall {
+					firewall := newClusterFirewall(true)
+					firewall.Name = newFirewallName
+					return firewall
+				}(),
+			},
+			Ready: pointer.BoolPtr(true),
+			Check: func(c client.Client, metalCluster *api.MetalStackCluster) {
+				Expect(metalCluster.Status.FirewallUpdate).To(BeNil())
+				Expect(metalCluster.Status.Firewalls).To(Equal([]string{newFirewallName}))
+				Expect(metalCluster.GetFirewallNamespacedName(0).Name).To(Equal(newFirewallName))
+			},
+			MockFunc: func() {
+				metalClient.EXPECT().PartitionCapacity().Return(newPartitionCapacityResponse(1), nil)
+			},
+		}),
+	)
+
+	newReplicatedMetalStackCluster := func(replicas int32) *api.MetalStackCluster {
+		metalCluster := newMetalStackCluster(newClusterOwnerRef(), pointer.StringPtr("privateNetworkID"), true, false)
+		metalCluster.Spec.FirewallReplicas = &replicas
+		return metalCluster
+	}
+	newReplicaFirewall := func(replica int32, providerID *string, ready bool) *api.MetalStackFirewall {
+		firewall := newClusterFirewall(ready)
+		firewall.Name = newReplicatedMetalStackCluster(replica + 1).GetFirewallNamespacedName(replica).Name
+		firewall.Labels[api.FirewallReplicaLabel] = fmt.Sprint(replica)
+		firewall.Spec.ProviderID = providerID
+		return firewall
+	}
+	getReplicaFirewall := func(c client.Client, replica int32) (*api.MetalStackFirewall, error) {
+		firewall := &api.MetalStackFirewall{}
+		name := newReplicatedMetalStackCluster(replica + 1).GetFirewallNamespacedName(replica)
+		return firewall, c.Get(context.TODO(), name, firewall)
+	}
+
+	DescribeTable("Replicate Firewall", metalStackClusterTestFunc,
+		Entry("Should wait for the first firewall to be deployed before creating the next one", MetalStackClusterTestCase{
+			Objects: []runtime.Object{
+				newCluster(false, false),
+				newReplicatedMetalStackCluster(2),
+				newReplicaFirewall(0, nil, false),
+			},
+			Ready: pointer.BoolPtr(false),
+			Check: func(c client.Client, metalCluster *api.MetalStackCluster) {
+				_, err := getReplicaFirewall(c, 1)
+				Expect(apierrors.IsNotFound(err)).To(BeTrue())
+			},
+			MockFunc: func() {
+				metalClient.EXPECT().PartitionCapacity().Return(newPartitionCapacityResponse(1), nil)
+			},
+		}),
+		Entry("Should create the next firewall once the first one is deployed", MetalStackClusterTestCase{
+			Objects: []runtime.Object{
+				newCluster(false, false),
+				newReplicatedMetalStackCluster(2),
+				newReplicaFirewall(0, pointer.StringPtr(nodeID), false),
+			},
+			Ready: pointer.BoolPtr(false),
+			Check: func(c client.Client, metalCluster *api.MetalStackCluster) {
+				firewall, err := getReplicaFirewall(c, 1)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(firewall.GetReplica()).To(Equal(int32(1)))
+				Expect(firewall.Spec.ProviderID).To(BeNil())
+			},
+			MockFunc: func() {
+				metalClient.EXPECT().PartitionCapacity().Return(newPartitionCapacityResponse(1), nil)
+			},
+		}),
+		Entry("Should copy the watch-filter label onto the next firewall", MetalStackClusterTestCase{
+			Objects: []runtime.Object{
+				newCluster(false, false),
+				func() *api.MetalStackCluster {
+					metalCluster := newReplicatedMetalStackCluster(2)
+					metalCluster.Labels = map[string]string{capi.WatchLabel: "filter"}
+					return metalCluster
+				}(),
+				newReplicaFirewall(0, pointer.StringPtr(nodeID), false),
+			},
+			WatchFilterValue: "filter",
+			Ready:            pointer.BoolPtr(false),
+			Check: func(c client.Client, metalCluster *api.MetalStackCluster) {
+				firewall, err := getReplicaFirewall(c, 1)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(firewall.Labels).To(HaveKeyWithValue(capi.WatchLabel, "filter"))
+			},
+			MockFunc: func() {
+				metalClient.EXPECT().PartitionCapacity().Return(newPartitionCapacityResponse(1), nil)
+			},
+		}),
+		Entry("Should be ready if a majority of the firewalls is ready", MetalStackClusterTestCase{
+			Objects: []runtime.Object{
+				newCluster(false, false),
+				newReplicatedMetalStackCluster(3),
+				newReplicaFirewall(0, pointer.StringPtr(nodeID), true),
+				newReplicaFirewall(1, pointer.StringPtr(nodeID), true),
+				newReplicaFirewall(2, pointer.StringPtr(nodeID), false),
+			},
+			Ready: pointer.BoolPtr(true),
+			MockFunc: func() {
+				metalClient.EXPECT().PartitionCapacity().Return(newPartitionCapacityResponse(1), nil)
+			},
+		}),
+		Entry("Should not be ready if only a minority of the firewalls is ready", MetalStackClusterTestCase{
+			Objects: []runtime.Object{
+				newCluster(false, false),
+				newReplicatedMetalStackCluster(3),
+				newReplicaFirewall(0, pointer.StringPtr(nodeID), true),
+				newReplicaFirewall(1, pointer.StringPtr(nodeID), false),
+				newReplicaFirewall(2, pointer.StringPtr(nodeID), false),
+			},
+			Ready: pointer.BoolPtr(false),
+			MockFunc: func() {
+				metalClient.EXPECT().PartitionCapacity().Return(newPartitionCapacityResponse(1), nil)
+			},
+		}),
+		Entry("Should delete the firewalls of removed replicas", MetalStackClusterTestCase{
+			Objects: []runtime.Object{
+				newCluster(false, false),
+				newReplicatedMetalStackCluster(1),
+				newReplicaFirewall(0, pointer.StringPtr(nodeID), true),
+				newReplicaFirewall(1, pointer.StringPtr(nodeID), true),
+			},
+			Ready: pointer.BoolPtr(true),
+			Check: func(c client.Client, metalCluster *api.MetalStackCluster) {
+				_, err := getReplicaFirewall(c, 1)
+				Expect(apierrors.IsNotFound(err)).To(BeTrue())
+			},
+			MockFunc: func() {
+				metalClient.EXPECT().PartitionCapacity().Return(newPartitionCapacityResponse(1), nil)
+			},
+		}),
+	)
+
+	newEgressMetalStackCluster := func(egressIPs []api.EgressIP, status []api.EgressIPStatus) *api.MetalStackCluster {
+		metalCluster := newMetalStackCluster(newClusterOwnerRef(), pointer.StringPtr("privateNetworkID"), true, false)
+		metalCluster.Spec.FirewallSpec.EgressIPs = egressIPs
+		metalCluster.Status.EgressIPs = status
+		return metalCluster
+	}
+	newEgressIPResponse := func(ipType string) *metalgo.IPDetailResponse {
+		return &metalgo.IPDetailResponse{IP: &metalmodels.V1IPResponse{
+			Ipaddress: pointer.StringPtr("212.34.83.10"),
+			Networkid: pointer.StringPtr(""),
+			Projectid: pointer.StringPtr(""),
+			Type:      pointer.StringPtr(ipType),
+		}}
+	}
+
+	DescribeTable("Egress IPs", metalStackClusterTestFunc,
+		Entry("Should allocate static egress IP", MetalStackClusterTestCase{
+			Objects: []runtime.Object{
+				newCluster(false, false),
+				newEgressMetalStackCluster([]api.EgressIP{{Name: "partner"}}, nil),
+			},
+			Check: func(c client.Client, metalCluster *api.MetalStackCluster) {
+				Expect(metalCluster.Status.EgressIPs).To(Equal([]api.EgressIPStatus{{Name: "partner", IP: "212.34.83.10", Allocated: true}}))
+			},
+			MockFunc: func() {
+				metalClient.EXPECT().IPFind(gomock.Any()).Return(&metalgo.IPListResponse{}, nil)
+				metalClient.EXPECT().IPAllocate(gomock.Any()).DoAndReturn(func(iar *metalgo.IPAllocateRequest) (*metalgo.IPDetailResponse, error) {
+					Expect(iar.Type).To(Equal(ipTypeStatic))
+					return newEgressIPResponse(ipTypeStatic), nil
+				})
+				metalClient.EXPECT().PartitionCapacity().Return(newPartitionCapacityResponse(1), nil)
+			},
+		}),
+		Entry("Should use existing static egress IP", MetalStackClusterTestCase{
+			Objects: []runtime.Object{
+				newCluster(false, false),
+				newEgressMetalStackCluster([]api.EgressIP{{Name: "partner", IP: "212.34.83.10"}}, nil),
+			},
+			Check: func(c client.Client, metalCluster *api.MetalStackCluster) {
+				Expect(metalCluster.Status.EgressIPs).To(Equal([]api.EgressIPStatus{{Name: "partner", IP: "212.34.83.10"}}))
+			},
+			MockFunc: func() {
+				metalClient.EXPECT().IPGet("212.34.83.10").Return(newEgressIPResponse(ipTypeStatic), nil)
+				metalClient.EXPECT().PartitionCapacity().Return(newPartitionCapacityResponse(1), nil)
+			},
+		}),
+		Entry("Should fail if existing egress IP isn't static", MetalStackClusterTestCase{
+			Objects: []runtime.Object{
+				newCluster(false, false),
+				newEgressMetalStackCluster([]api.EgressIP{{Name: "partner", IP: "212.34.83.10"}}, nil),
+			},
+			Error: true,
+			Check: func(c client.Client, metalCluster *api.MetalStackCluster) {
+				Expect(conditions.GetReason(metalCluster, api.FirewallReadyCondition)).To(Equal(api.EgressIPFailedReason))
+			},
+			MockFunc: func() {
+				metalClient.EXPECT().IPGet("212.34.83.10").Return(newEgressIPResponse("ephemeral"), nil)
+			},
+		}),
+		Entry("Should release removed egress IP", MetalStackClusterTestCase{
+			Objects: []runtime.Object{
+				newCluster(false, false),
+				newEgressMetalStackCluster(nil, []api.EgressIPStatus{{Name: "partner", IP: "212.34.83.10", Allocated: true}}),
+			},
+			Check: func(c client.Client, metalCluster *api.MetalStackCluster) {
+				Expect(metalCluster.Status.EgressIPs).To(BeEmpty())
+			},
+			MockFunc: func() {
+				metalClient.EXPECT().IPFree("212.34.83.10").Return(&metalgo.IPDetailResponse{}, nil)
+				metalClient.EXPECT().PartitionCapacity().Return(newPartitionCapacityResponse(1), nil)
+			},
+		}),
+		Entry("Should keep removed egress IP while a firewall uses it", MetalStackClusterTestCase{
+			Objects: []runtime.Object{
+				newCluster(false, false),
+				newEgressMetalStackCluster(nil, []api.EgressIPStatus{{Name: "partner", IP: "212.34.83.10", Allocated: true}}),
+				func() *api.MetalStackFirewall {
+					firewall := newClusterFirewall(true)
+					firewall.Status.Addresses = []api.FirewallAddresses{{NetworkID: "internet", IPs: []string{"212.34.83.10"}}}
+					return firewall
+				}(),
+			},
+			Check: func(c client.Client, metalCluster *api.MetalStackCluster) {
+				Expect(metalCluster.Status.EgressIPs).To(HaveLen(1))
+			},
+			MockFunc: func() {
+				metalClient.EXPECT().PartitionCapacity().Return(newPartitionCapacityResponse(1), nil)
+			},
+		}),
+	)
+
+	DescribeTable("Adopt after move", metalStackClusterTestFunc,
+		Entry("Should adopt the allocated Control Plane IP", MetalStackClusterTestCase{
+			Objects: []runtime.Object{
+				newCluster(false, false),
+				func() *api.MetalStackCluster {
+					metalCluster := newMetalStackCluster(newClusterOwnerRef(), pointer.StringPtr("privateNetworkID"), false, false)
+					metalCluster.Spec.ControlPlaneEndpoint.Host = "100.255.254.1"
+					metalCluster.Spec.DisableFirewall = true
+					return metalCluster
+				}(),
+			},
+			Check: func(c client.Client, metalCluster *api.MetalStackCluster) {
+				Expect(metalCluster.Status.ControlPlaneIPAllocated).To(BeTrue())
+			},
+			MockFunc: func() {
+				metalClient.EXPECT().IPGet("100.255.254.1").Return(&metalgo.IPDetailResponse{
+					IP: &metalmodels.V1IPResponse{Ipaddress: pointer.StringPtr("100.255.254.1"), Projectid: pointer.StringPtr("")},
+				}, nil)
+				metalClient.EXPECT().PartitionCapacity().Return(newPartitionCapacityResponse(1), nil)
+			},
+		}),
+		Entry("Should adopt the allocated egress IP", MetalStackClusterTestCase{
+			Objects: []runtime.Object{
+				newCluster(false, false),
+				newEgressMetalStackCluster([]api.EgressIP{{Name: "partner"}}, nil),
+			},
+			Check: func(c client.Client, metalCluster *api.MetalStackCluster) {
+				Expect(metalCluster.Status.EgressIPs).To(Equal([]api.EgressIPStatus{{Name: "partner", IP: "212.34.83.10", Allocated: true}}))
+			},
+			MockFunc: func() {
+				metalClient.EXPECT().IPFind(gomock.Any()).Return(&metalgo.IPListResponse{
+					IPs: []*metalmodels.V1IPResponse{
+						{Name: metalStackClusterName + "-egress-other", Ipaddress: pointer.StringPtr("212.34.83.11")},
+						{Name: metalStackClusterName + "-egress-partner", Ipaddress: pointer.StringPtr("212.34.83.10")},
+					},
+				}, nil)
+				metalClient.EXPECT().PartitionCapacity().Return(newPartitionCapacityResponse(1), nil)
+			},
+		}),
+		Entry("Should recover and adopt the firewall of the replica", MetalStackClusterTestCase{
+			Objects: []runtime.Object{
+				newCluster(false, false),
+				newMetalStackCluster(newClusterOwnerRef(), pointer.StringPtr("privateNetworkID"), true, false),
+				func() *api.MetalStackFirewall {
+					firewall := newClusterFirewall(true)
+					firewall.Name = metalStackClusterName + "-updated"
+					return firewall
+				}(),
+			},
+			Ready: pointer.BoolPtr(true),
+			Check: func(c client.Client, metalCluster *api.MetalStackCluster) {
+				Expect(metalCluster.Status.Firewalls).To(Equal([]string{metalStackClusterName + "-updated"}))
+
+				firewall := &api.MetalStackFirewall{}
+				Expect(c.Get(context.TODO(), metalCluster.GetFirewallNamespacedName(0), firewall)).To(Succeed())
+				Expect(metav1.GetControllerOf(firewall)).NotTo(BeNil())
+			},
+			MockFunc: func() {
+				metalClient.EXPECT().PartitionCapacity().Return(newPartitionCapacityResponse(1), nil)
+			},
+		}),
+		Entry("Should pin the cluster ID", MetalStackClusterTestCase{
+			Objects: []runtime.Object{
+				newCluster(false, false),
+				func() *api.MetalStackCluster {
+					metalCluster := newMetalStackCluster(newClusterOwnerRef(), pointer.StringPtr("privateNetworkID"), true, false)
+					metalCluster.UID = "moved"
+					metalCluster.Annotations = map[string]string{api.ClusterIDAnnotation: "original"}
+					metalCluster.Spec.DisableFirewall = true
+					return metalCluster
+				}(),
+			},
+			Check: func(c client.Client, metalCluster *api.MetalStackCluster) {
+				Expect(metalCluster.GetClusterIDTag()).To(HaveSuffix("=original"))
+			},
+			MockFunc: func() {
+				metalClient.EXPECT().PartitionCapacity().Return(newPartitionCapacityResponse(1), nil)
+			},
+		}),
+	)
+
+	// A MetalStackCluster restored from a backup misses what was allocated after the backup was taken.
+	newRestoredMetalStackCluster := func() *api.MetalStackCluster {
+		metalCluster := newMetalStackCluster(newClusterOwnerRef(), nil, false, false)
+		metalCluster.Annotations = map[string]string{api.ClusterIDAnnotation: "original"}
+		metalCluster.Spec.DisableFirewall = true
+		return metalCluster
+	}
+
+	DescribeTable("Restore from backup", metalStackClusterTestFunc,
+		Entry("Should adopt the allocated network and Control Plane IP", MetalStackClusterTestCase{
+			Objects: []runtime.Object{
+				newCluster(false, false),
+				newRestoredMetalStackCluster(),
+			},
+			Check: func(c client.Client, metalCluster *api.MetalStackCluster) {
+				Expect(metalCluster.Spec.PrivateNetworkID).To(Equal(pointer.StringPtr("privateNetworkID")))
+				Expect(metalCluster.Spec.ControlPlaneEndpoint.Host).To(Equal("100.255.254.1"))
+				Expect(metalCluster.Status.ControlPlaneIPAllocated).To(BeTrue())
+			},
+			// NetworkAllocate and IPAllocate aren't expected, so the mock fails if a duplicate is allocated.
+			MockFunc: func() {
+				metalClient.EXPECT().NetworkFind(gomock.Any()).DoAndReturn(func(nfr *metalgo.NetworkFindRequest) (*metalgo.NetworkListResponse, error) {
+					Expect(nfr.Labels).To(HaveKeyWithValue("cluster.metal-stack.io/id", "original"))
+					return &metalgo.NetworkListResponse{
+						Networks: []*metalmodels.V1NetworkResponse{{ID: pointer.StringPtr("privateNetworkID")}},
+					}, nil
+				})
+				metalClient.EXPECT().IPFind(gomock.Any()).Return(&metalgo.IPListResponse{
+					IPs: []*metalmodels.V1IPResponse{
+						{Name: metalStackClusterName + "-egress-partner", Ipaddress: pointer.StringPtr("212.34.83.10"), Tags: []string{"cluster.metal-stack.io/id=original"}},
+						{Name: metalStackClusterName + "-api-server-IP", Ipaddress: pointer.StringPtr("100.255.254.2"), Tags: []string{"cluster.metal-stack.io/id=other"}},
+						{Name: metalStackClusterName + "-api-server-IP", Ipaddress: pointer.StringPtr("100.255.254.1"), Tags: []string{"cluster.metal-stack.io/id=original"}},
+					},
+				}, nil)
+				metalClient.EXPECT().PartitionCapacity().Return(newPartitionCapacityResponse(1), nil)
+			},
+		}),
+		Entry("Should adopt the network and Control Plane IP allocated before the cluster ID was pinned", MetalStackClusterTestCase{
+			Objects: []runtime.Object{
+				newCluster(false, false),
+				newRestoredMetalStackCluster(),
+			},
+			Check: func(c client.Client, metalCluster *api.MetalStackCluster) {
+				Expect(metalCluster.Spec.PrivateNetworkID).To(Equal(pointer.StringPtr("legacyNetworkID")))
+				Expect(metalCluster.Spec.ControlPlaneEndpoint.Host).To(Equal("100.255.254.1"))
+				Expect(metalCluster.Status.ControlPlaneIPAllocated).To(BeTrue())
+			},
+			MockFunc: func() {
+				metalClient.EXPECT().NetworkFind(gomock.Any()).DoAndReturn(func(nfr *metalgo.NetworkFindRequest) (*metalgo.NetworkListResponse, error) {
+					if nfr.Labels["cluster.metal-stack.io/id"] != metalStackClusterName {
+						return &metalgo.NetworkListResponse{}, nil
+					}
+					return &metalgo.NetworkListResponse{
+						Networks: []*metalmodels.V1NetworkResponse{{ID: pointer.StringPtr("legacyNetworkID")}},
+					}, nil
+				}).Times(2)
+				metalClient.EXPECT().IPFind(gomock.Any()).DoAndReturn(func(ifr *metalgo.IPFindRequest) (*metalgo.IPListResponse, error) {
+					Expect(ifr.Tags).To(BeEmpty())
+					return &metalgo.IPListResponse{
+						IPs: []*metalmodels.V1IPResponse{
+							{Name: metalStackClusterName + "-api-server-IP", Ipaddress: pointer.StringPtr("100.255.254.1")},
+						},
+					}, nil
+				})
+				metalClient.EXPECT().PartitionCapacity().Return(newPartitionCapacityResponse(1), nil)
+			},
+		}),
+		Entry("Should fail if finding the network failed", MetalStackClusterTestCase{
+			Objects: []runtime.Object{
+				newCluster(false, false),
+				newRestoredMetalStackCluster(),
+			},
+			Error: true,
+			MockFunc: func() {
+				metalClient.EXPECT().NetworkFind(gomock.Any()).Return(nil, fmt.Errorf("error"))
+			},
+		}),
+		Entry("Should fail if finding the Control Plane IP failed", MetalStackClusterTestCase{
+			Objects: []runtime.Object{
+				newCluster(false, false),
+				func() *api.MetalStackCluster {
+					metalCluster := newRestoredMetalStackCluster()
+					metalCluster.Spec.PrivateNetworkID = pointer.StringPtr("privateNetworkID")
+					return metalCluster
+				}(),
+			},
+			Error: true,
+			MockFunc: func() {
+				metalClient.EXPECT().IPFind(gomock.Any()).Return(nil, fmt.Errorf("error"))
+			},
+		}),
+	)
+
 	DescribeTable("Create Cluster", metalStackClusterTestFunc,
 		Entry("Should be no error when metal-stack cluster not found", MetalStackClusterTestCase{}),
-		Entry("Should requeue if Owner Cluster not set", MetalStackClusterTestCase{
+		Entry("Should wait for the OwnerRef if Owner Cluster not set", MetalStackClusterTestCase{
 			Objects: []runtime.Object{newMetalStackCluster(nil, nil, false, false)},
-			Requeue: true,
 		}),
 		Entry("Should fail if unable to get Owner Cluster", MetalStackClusterTestCase{
 			Objects: []runtime.Object{newMetalStackCluster(newClusterOwnerRef(), nil, false, false)},
 			Error:   true,
 		}),
-		Entry("Should requeue if paused", MetalStackClusterTestCase{
+		Entry("Should wait for the watch if paused", MetalStackClusterTestCase{
 			Objects: []runtime.Object{
 				newCluster(true, false),
 				newMetalStackCluster(newClusterOwnerRef(), nil, false, false),
 			},
-			Requeue: true,
 		}),
-		Entry("Should requeue if network allocation failed", MetalStackClusterTestCase{
+		Entry("Should fail if network allocation failed", MetalStackClusterTestCase{
 			Objects: []runtime.Object{
 				newCluster(false, false),
 				newMetalStackCluster(newClusterOwnerRef(), nil, false, false),
 			},
-			Requeue: true,
+			Error: true,
 			MockFunc: func() {
+				expectNoNetwork()
 				metalClient.EXPECT().NetworkAllocate(gomock.Any()).Return(nil, fmt.Errorf("error"))
 			},
 		}),
-		Entry("Should requeue if Control Plane IP allocation failed", MetalStackClusterTestCase{
+		Entry("Should fail if Control Plane IP allocation failed", MetalStackClusterTestCase{
 			Objects: []runtime.Object{
 				newCluster(false, false),
 				newMetalStackCluster(newClusterOwnerRef(), pointer.StringPtr("privateNetworkID"), false, false),
 			},
-			Requeue: true,
+			Error: true,
 			MockFunc: func() {
+				expectNoControlPlaneIP()
 				metalClient.EXPECT().IPAllocate(gomock.Any()).Return(nil, fmt.Errorf("error"))
 			},
 		}),
@@ -109,9 +699,59 @@ var _ = Describe("Reconcile MetalStackCluster", func() {
 				newMetalStackCluster(newClusterOwnerRef(), pointer.StringPtr("privateNetworkID"), false, false),
 			},
 			MockFunc: func() {
-				metalClient.EXPECT().IPAllocate(gomock.Any()).Return(&metalgo.IPDetailResponse{
-					IP: &metalmodels.V1IPResponse{Ipaddress: pointer.StringPtr("8.8.8.8")},
-				}, nil)
+				expectNoControlPlaneIP()
+				metalClient.EXPECT().IPAllocate(gomock.Any()).DoAndReturn(func(iar *metalgo.IPAllocateRequest) (*metalgo.IPDetailResponse, error) {
+					Expect(iar.Tags).To(HaveLen(1))
+					return &metalgo.IPDetailResponse{
+						IP: &metalmodels.V1IPResponse{Ipaddress: pointer.StringPtr("8.8.8.8")},
+					}, nil
+				})
+				metalClient.EXPECT().PartitionCapacity().Return(newPartitionCapacityResponse(1), nil)
+			},
+		}),
+		Entry("Should not be ready until the firewall is ready", MetalStackClusterTestCase{
+			Objects: []runtime.Object{
+				newCluster(false, false),
+				newMetalStackCluster(newClusterOwnerRef(), pointer.StringPtr("privateNetworkID"), true, false),
+				newClusterFirewall(false),
+			},
+			Ready: pointer.BoolPtr(false),
+			MockFunc: func() {
+				metalClient.EXPECT().PartitionCapacity().Return(newPartitionCapacityResponse(1), nil)
+			},
+		}),
+		Entry("Should be ready if the firewall is ready", MetalStackClusterTestCase{
+			Objects: []runtime.Object{
+				newCluster(false, false),
+				newMetalStackCluster(newClusterOwnerRef(), pointer.StringPtr("privateNetworkID"), true, false),
+				newClusterFirewall(true),
+			},
+			Ready: pointer.BoolPtr(true),
+			MockFunc: func() {
+				metalClient.EXPECT().PartitionCapacity().Return(newPartitionCapacityResponse(1), nil)
+			},
+		}),
+		Entry("Should be ready without firewall if opted out", MetalStackClusterTestCase{
+			Objects: []runtime.Object{
+				newCluster(false, false),
+				func() *api.MetalStackCluster {
+					metalCluster := newMetalStackCluster(newClusterOwnerRef(), pointer.StringPtr("privateNetworkID"), true, false)
+					metalCluster.Spec.DisableFirewall = true
+					return metalCluster
+				}(),
+			},
+			Ready: pointer.BoolPtr(true),
+			MockFunc: func() {
+				metalClient.EXPECT().PartitionCapacity().Return(newPartitionCapacityResponse(1), nil)
+			},
+		}),
+		Entry("Should succeed if PartitionCapacity failed", MetalStackClusterTestCase{
+			Objects: []runtime.Object{
+				newCluster(false, false),
+				newMetalStackCluster(newClusterOwnerRef(), pointer.StringPtr("privateNetworkID"), true, false),
+			},
+			MockFunc: func() {
+				metalClient.EXPECT().PartitionCapacity().Return(nil, fmt.Errorf("error"))
 			},
 		}),
 	)
@@ -127,12 +767,12 @@ var _ = Describe("Reconcile MetalStackCluster", func() {
 				metalClient.EXPECT().NetworkFind(gomock.Any()).Return(nil, fmt.Errorf("error"))
 			},
 		}),
-		Entry("Should requeue if NetworkFree returned error", MetalStackClusterTestCase{
+		Entry("Should fail if NetworkFree returned error", MetalStackClusterTestCase{
 			Objects: []runtime.Object{
 				newCluster(false, false),
 				newMetalStackCluster(newClusterOwnerRef(), pointer.StringPtr("privateNetworkID"), false, true),
 			},
-			Requeue: true,
+			Error: true,
 			MockFunc: func() {
 				metalClient.EXPECT().NetworkFind(gomock.Any()).Return(
 					&metalgo.NetworkListResponse{Networks: []*metalmodels.V1NetworkResponse{nil}}, nil)
@@ -150,5 +790,49 @@ var _ = Describe("Reconcile MetalStackCluster", func() {
 				metalClient.EXPECT().NetworkFree(gomock.Any()).Return(nil, nil)
 			},
 		}),
+		Entry("Should wait for the firewalls before releasing egress IPs and the network", MetalStackClusterTestCase{
+			Objects: []runtime.Object{
+				newCluster(false, false),
+				func() *api.MetalStackCluster {
+					metalCluster := newMetalStackCluster(newClusterOwnerRef(), pointer.StringPtr("privateNetworkID"), false, true)
+					metalCluster.Finalizers = []string{api.MetalStackClusterFinalizer}
+					metalCluster.Status.EgressIPs = []api.EgressIPStatus{{Name: "partner", IP: "212.34.83.10", Allocated: true}}
+					return metalCluster
+				}(),
+				func() *api.MetalStackFirewall {
+					firewall := newClusterFirewall(true)
+					firewall.Finalizers = []string{api.MetalStackFirewallFinalizer}
+					return firewall
+				}(),
+			},
+			RequeueAfter: firewallDeletionInterval,
+			Check: func(c client.Client, metalCluster *api.MetalStackCluster) {
+				Expect(metalCluster.Finalizers).To(ContainElement(api.MetalStackClusterFinalizer))
+				Expect(metalCluster.Status.EgressIPs[0].Allocated).To(BeTrue())
+
+				firewall := &api.MetalStackFirewall{}
+				Expect(c.Get(context.TODO(), types.NamespacedName{Namespace: namespaceName, Name: metalStackClusterName}, firewall)).To(Succeed())
+				Expect(firewall.DeletionTimestamp).NotTo(BeNil())
+			},
+			MockFunc: func() {
+				metalClient.EXPECT().IPFree(gomock.Any()).Times(0)
+				metalClient.EXPECT().NetworkFind(gomock.Any()).Times(0)
+				metalClient.EXPECT().NetworkFree(gomock.Any()).Times(0)
+			},
+		}),
+		Entry("Should fail if releasing egress IPs failed", MetalStackClusterTestCase{
+			Objects: []runtime.Object{
+				newCluster(false, false),
+				func() *api.MetalStackCluster {
+					metalCluster := newMetalStackCluster(newClusterOwnerRef(), pointer.StringPtr("privateNetworkID"), false, true)
+					metalCluster.Status.EgressIPs = []api.EgressIPStatus{{Name: "partner", IP: "212.34.83.10", Allocated: true}}
+					return metalCluster
+				}(),
+			},
+			Error: true,
+			MockFunc: func() {
+				metalClient.EXPECT().IPFree("212.34.83.10").Return(nil, fmt.Errorf("error"))
+			},
+		}),
 	)
 })
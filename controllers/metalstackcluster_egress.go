@@ -0,0 +1,213 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-logr/logr"
+	metalgo "github.com/metal-stack/metal-go"
+	capi "sigs.k8s.io/cluster-api/api/v1alpha4"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	api "github.com/metal-stack/cluster-api-provider-metalstack/api/v1alpha4"
+)
+
+// ipTypeStatic is the type of IPs which stay allocated when their machine is deleted.
+const ipTypeStatic = "static"
+
+// reconcileEgressIPs allocates the static egress IPs of the firewall spec and verifies the referenced ones.
+// An allocated IP which was removed from the spec is released once no firewall of the cluster uses it anymore.
+func (r *MetalStackClusterReconciler) reconcileEgressIPs(ctx context.Context, logger logr.Logger, metalCluster *api.MetalStackCluster) error {
+	current := make(map[string]api.EgressIPStatus, len(metalCluster.Status.EgressIPs))
+	for _, egressIP := range metalCluster.Status.EgressIPs {
+		current[egressIP.Name] = egressIP
+	}
+
+	var egressIPs []api.EgressIPStatus
+	kept := make(map[api.EgressIPStatus]bool)
+	for _, egressIP := range metalCluster.Spec.FirewallSpec.EgressIPs {
+		if st, ok := current[egressIP.Name]; ok && (egressIP.IP == "" && st.Allocated || egressIP.IP == st.IP) {
+			egressIPs = append(egressIPs, st)
+			kept[st] = true
+			continue
+		}
+
+		st, err := r.egressIP(metalCluster, egressIP)
+		if err != nil {
+			// Keep what's allocated, so that it's released once it's removed from the spec.
+			metalCluster.Status.EgressIPs = append(egressIPs, unkeptEgressIPs(metalCluster.Status.EgressIPs, kept)...)
+			return err
+		}
+		logger.Info(fmt.Sprintf("Egress IP %s is %s", egressIP.Name, st.IP))
+		egressIPs = append(egressIPs, st)
+	}
+
+	// The removed IPs are kept after the ones of the spec, so that they don't shadow them.
+	used, err := r.firewallIPs(ctx, metalCluster)
+	if err != nil {
+		return err
+	}
+	for _, st := range unkeptEgressIPs(metalCluster.Status.EgressIPs, kept) {
+		if !st.Allocated {
+			continue
+		}
+		if used[st.IP] {
+			logger.Info(fmt.Sprintf("Egress IP %s is removed, but still used by a firewall", st.IP))
+			egressIPs = append(egressIPs, st)
+			continue
+		}
+		if _, err := r.MetalStackClient.IPFree(st.IP); err != nil {
+			logger.Info(fmt.Sprintf("Failed to release egress IP %s: %s", st.IP, err))
+			egressIPs = append(egressIPs, st)
+			continue
+		}
+		logger.Info(fmt.Sprintf("Egress IP %s is released", st.IP))
+	}
+
+	metalCluster.Status.EgressIPs = egressIPs
+	return nil
+}
+
+// egressIP allocates a static IP in the public network or verifies the referenced one.
+func (r *MetalStackClusterReconciler) egressIP(metalCluster *api.MetalStackCluster, egressIP api.EgressIP) (api.EgressIPStatus, error) {
+	if egressIP.IP == "" {
+		name := fmt.Sprintf("%s-egress-%s", metalCluster.Name, egressIP.Name)
+
+		// The status is lost when the MetalStackCluster is recreated, e.g. by `clusterctl move`, but the IP is still allocated.
+		ip, err := r.findEgressIP(metalCluster, name)
+		if err != nil {
+			return api.EgressIPStatus{}, err
+		}
+		if ip != "" {
+			return api.EgressIPStatus{Name: egressIP.Name, IP: ip, Allocated: true}, nil
+		}
+
+		resp, err := r.MetalStackClient.IPAllocate(&metalgo.IPAllocateRequest{
+			Name:        name,
+			Description: fmt.Sprintf("egress IP of cluster %s", metalCluster.Name),
+			Networkid:   metalCluster.Spec.PublicNetworkID,
+			Projectid:   metalCluster.Spec.ProjectID,
+			Type:        ipTypeStatic,
+			Tags:        []string{metalCluster.GetClusterIDTag()},
+		})
+		if err != nil {
+			return api.EgressIPStatus{}, fmt.Errorf("failed to allocate egress IP %s: %w", egressIP.Name, err)
+		}
+		return api.EgressIPStatus{Name: egressIP.Name, IP: *resp.IP.Ipaddress, Allocated: true}, nil
+	}
+
+	resp, err := r.MetalStackClient.IPGet(egressIP.IP)
+	if err != nil {
+		return api.EgressIPStatus{}, fmt.Errorf("failed to get egress IP %s: %w", egressIP.IP, err)
+	}
+	ip := resp.IP
+	switch {
+	case ip.Projectid == nil || *ip.Projectid != metalCluster.Spec.ProjectID:
+		return api.EgressIPStatus{}, fmt.Errorf("egress IP %s doesn't belong to project %s", egressIP.IP, metalCluster.Spec.ProjectID)
+	case ip.Networkid == nil || *ip.Networkid != metalCluster.Spec.PublicNetworkID:
+		return api.EgressIPStatus{}, fmt.Errorf("egress IP %s isn't in network %s", egressIP.IP, metalCluster.Spec.PublicNetworkID)
+	case ip.Type == nil || *ip.Type != ipTypeStatic:
+		return api.EgressIPStatus{}, fmt.Errorf("egress IP %s isn't static", egressIP.IP)
+	}
+
+	return api.EgressIPStatus{Name: egressIP.Name, IP: egressIP.IP}, nil
+}
+
+// findEgressIP returns the address of the static IP with the name allocated for the cluster, if it exists.
+func (r *MetalStackClusterReconciler) findEgressIP(metalCluster *api.MetalStackCluster, name string) (string, error) {
+	ipType := ipTypeStatic
+	resp, err := r.MetalStackClient.IPFind(&metalgo.IPFindRequest{
+		ProjectID: &metalCluster.Spec.ProjectID,
+		NetworkID: &metalCluster.Spec.PublicNetworkID,
+		Type:      &ipType,
+		Tags:      []string{metalCluster.GetClusterIDTag()},
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to find egress IP %s: %w", name, err)
+	}
+
+	for _, ip := range resp.IPs {
+		if ip.Name == name && ip.Ipaddress != nil {
+			return *ip.Ipaddress, nil
+		}
+	}
+	return "", nil
+}
+
+// firewallIPs returns the IPs the firewalls of the cluster are provisioned with.
+func (r *MetalStackClusterReconciler) firewallIPs(ctx context.Context, metalCluster *api.MetalStackCluster) (map[string]bool, error) {
+	firewalls := &api.MetalStackFirewallList{}
+	if err := r.Client.List(
+		ctx,
+		firewalls,
+		client.InNamespace(metalCluster.Namespace),
+		client.MatchingLabels{capi.ClusterLabelName: metalCluster.Name},
+	); err != nil {
+		return nil, fmt.Errorf("failed to list firewalls: %w", err)
+	}
+
+	ips := make(map[string]bool)
+	for _, firewall := range firewalls.Items {
+		for _, addresses := range firewall.Status.Addresses {
+			for _, ip := range addresses.IPs {
+				ips[ip] = true
+			}
+		}
+		// A firewall whose status isn't read yet may have been provisioned with any of the egress IPs.
+		if firewall.Status.Addresses == nil && firewall.Spec.ProviderID != nil {
+			for _, egressIP := range metalCluster.Status.EgressIPs {
+				ips[egressIP.IP] = true
+			}
+		}
+	}
+	return ips, nil
+}
+
+// releaseEgressIPs releases the egress IPs allocated for the cluster.
+func (r *MetalStackClusterReconciler) releaseEgressIPs(logger logr.Logger, metalCluster *api.MetalStackCluster) error {
+	var egressIPs []api.EgressIPStatus
+	var errs []error
+	for _, st := range metalCluster.Status.EgressIPs {
+		if !st.Allocated {
+			continue
+		}
+		if _, err := r.MetalStackClient.IPFree(st.IP); err != nil {
+			egressIPs = append(egressIPs, st)
+			errs = append(errs, err)
+			continue
+		}
+		logger.Info(fmt.Sprintf("Egress IP %s is released", st.IP))
+	}
+
+	metalCluster.Status.EgressIPs = egressIPs
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to release egress IPs: %v", errs)
+	}
+	return nil
+}
+
+func unkeptEgressIPs(egressIPs []api.EgressIPStatus, kept map[api.EgressIPStatus]bool) []api.EgressIPStatus {
+	var unkept []api.EgressIPStatus
+	for _, st := range egressIPs {
+		if !kept[st] {
+			unkept = append(unkept, st)
+		}
+	}
+	return unkept
+}
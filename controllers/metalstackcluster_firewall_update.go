@@ -0,0 +1,210 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+
+	"github.com/go-logr/logr"
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	api "github.com/metal-stack/cluster-api-provider-metalstack/api/v1alpha4"
+)
+
+// firewallOutdatedReason tells why the firewall has to be replaced. It's empty if the firewall is up to date.
+// A firewall is replaced if its spec changed or if the credentials of its firewall-controller were rotated.
+// Imported firewalls never had credentials, so they are only replaced if their spec changed.
+func (r *MetalStackClusterReconciler) firewallOutdatedReason(
+	ctx context.Context,
+	metalCluster *api.MetalStackCluster,
+	firewall *api.MetalStackFirewall,
+) (string, error) {
+	spec := metalCluster.Spec.FirewallSpec
+	if firewall.Spec.Image != spec.Image {
+		return fmt.Sprintf("image changed from %q to %q", firewall.Spec.Image, spec.Image), nil
+	}
+	if firewall.Spec.MachineType != spec.MachineType {
+		return fmt.Sprintf("machine type changed from %q to %q", firewall.Spec.MachineType, spec.MachineType), nil
+	}
+	// The ignition and the SSH keys are only applied on provisioning.
+	if !equality.Semantic.DeepEqual(provisionedFirewallSpec(firewall.Spec), provisionedFirewallSpec(spec)) {
+		return "firewall spec changed", nil
+	}
+
+	if _, imported := firewall.Annotations[api.FirewallImportedAnnotation]; imported {
+		return "", nil
+	}
+	expireAt, err := r.firewallControllerCredentialsExpireAt(ctx, metalCluster)
+	if err != nil {
+		return "", err
+	}
+	if expireAt != nil && (firewall.Status.CredentialsExpireAt == nil || firewall.Status.CredentialsExpireAt.Before(expireAt)) {
+		return "credentials of firewall-controller were rotated", nil
+	}
+
+	return "", nil
+}
+
+// firewallControllerCredentialsExpireAt returns the expiry of the current firewall-controller credentials, if they were issued.
+func (r *MetalStackClusterReconciler) firewallControllerCredentialsExpireAt(ctx context.Context, metalCluster *api.MetalStackCluster) (*metav1.Time, error) {
+	secret := &core.Secret{}
+	namespacedName := types.NamespacedName{
+		Namespace: metalCluster.Namespace,
+		Name:      fmt.Sprintf(firewallControllerKubeconfigSecretNameTemplate, metalCluster.Name),
+	}
+	if err := r.Client.Get(ctx, namespacedName, secret); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("get credentials of firewall-controller: %w", err)
+	}
+
+	return credentialsExpireAt(secret), nil
+}
+
+// startFirewallUpdate creates the firewall replacing the current one of the replica.
+// The name of the new firewall is derived from what's changed, so that it's created only once.
+func (r *MetalStackClusterReconciler) startFirewallUpdate(
+	ctx context.Context,
+	logger logr.Logger,
+	metalCluster *api.MetalStackCluster,
+	replica int32,
+	reason string,
+) error {
+	name, err := r.replacementFirewallName(ctx, metalCluster, replica)
+	if err != nil {
+		return err
+	}
+	// Replacing the firewall by itself would delete the only firewall of the replica.
+	if current := metalCluster.GetFirewallNamespacedName(replica); name == current.Name {
+		return fmt.Errorf("new firewall of replica %d has the name of the current one %s", replica, current.Name)
+	}
+
+	if err := r.createFirewall(ctx, metalCluster, name, replica, replacementFirewallSpec(metalCluster)); err != nil && !apierrors.IsAlreadyExists(err) {
+		return fmt.Errorf("failed to create new firewall: %w", err)
+	}
+
+	logger.Info(fmt.Sprintf("Updating firewall of replica %d: %s, replacing it by %s", replica, reason, name))
+	metalCluster.Status.FirewallUpdate = &api.FirewallUpdate{
+		Phase:     api.FirewallUpdateProvisioning,
+		Replica:   replica,
+		Firewall:  name,
+		StartTime: metav1.Now(),
+	}
+
+	return nil
+}
+
+// reconcileFirewallUpdate replaces the firewall of a replica by a new one.
+// The current firewall routes the traffic until the new one is ready. Then both of them route the traffic,
+// and deleting the current firewall moves all of it to the new one.
+func (r *MetalStackClusterReconciler) reconcileFirewallUpdate(ctx context.Context, logger logr.Logger, metalCluster *api.MetalStackCluster) error {
+	update := metalCluster.Status.FirewallUpdate
+	current := metalCluster.GetFirewallNamespacedName(update.Replica)
+	if update.Firewall == current.Name {
+		metalCluster.Status.FirewallUpdate = nil
+		return fmt.Errorf("aborted update of replica %d, the new firewall is the current one %s", update.Replica, current.Name)
+	}
+
+	switch update.Phase {
+	case api.FirewallUpdateProvisioning:
+		firewall := &api.MetalStackFirewall{}
+		if err := r.Client.Get(ctx, types.NamespacedName{Namespace: metalCluster.Namespace, Name: update.Firewall}, firewall); err != nil {
+			if !apierrors.IsNotFound(err) {
+				return fmt.Errorf("failed to fetch new firewall: %w", err)
+			}
+			if err := r.createFirewall(ctx, metalCluster, update.Firewall, update.Replica, replacementFirewallSpec(metalCluster)); err != nil {
+				return fmt.Errorf("failed to create new firewall: %w", err)
+			}
+			return nil
+		}
+
+		if !firewall.Status.Ready {
+			logger.Info(fmt.Sprintf("Waiting for new firewall %s to be ready", firewall.Name))
+			return nil
+		}
+
+		old := &api.MetalStackFirewall{}
+		old.Namespace = current.Namespace
+		old.Name = current.Name
+		if err := r.Client.Delete(ctx, old); err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("failed to delete firewall %s: %w", current.Name, err)
+		}
+
+		logger.Info(fmt.Sprintf("New firewall %s is ready, deleting firewall %s", firewall.Name, current.Name))
+		update.Phase = api.FirewallUpdateDeleting
+		return nil
+
+	case api.FirewallUpdateDeleting:
+		if err := r.Client.Get(ctx, current, &api.MetalStackFirewall{}); err == nil {
+			logger.Info(fmt.Sprintf("Waiting for firewall %s to be deleted", current.Name))
+			return nil
+		} else if !apierrors.IsNotFound(err) {
+			return fmt.Errorf("failed to fetch firewall: %w", err)
+		}
+
+		logger.Info(fmt.Sprintf("Firewall is updated to %s", update.Firewall))
+		metalCluster.SetFirewallName(update.Replica, update.Firewall)
+		metalCluster.Status.FirewallUpdate = nil
+		return nil
+	}
+
+	return fmt.Errorf("unknown phase %q of firewall update", update.Phase)
+}
+
+// replacementFirewallName derives the name of the new firewall from its replica, spec and credentials.
+func (r *MetalStackClusterReconciler) replacementFirewallName(ctx context.Context, metalCluster *api.MetalStackCluster, replica int32) (string, error) {
+	expireAt, err := r.firewallControllerCredentialsExpireAt(ctx, metalCluster)
+	if err != nil {
+		return "", err
+	}
+
+	spec, err := json.Marshal(provisionedFirewallSpec(metalCluster.Spec.FirewallSpec))
+	if err != nil {
+		return "", err
+	}
+
+	h := fnv.New32a()
+	fmt.Fprintf(h, "%d/%s", replica, spec)
+	if expireAt != nil {
+		fmt.Fprintf(h, "/%d", expireAt.Unix())
+	}
+
+	return fmt.Sprintf("%s-%08x", metalCluster.Name, h.Sum32()), nil
+}
+
+// replacementFirewallSpec is the spec of a new firewall.
+// It can't be deployed on the machine the spec pins, because the current firewall still runs on it.
+func replacementFirewallSpec(metalCluster *api.MetalStackCluster) api.MetalStackFirewallSpec {
+	spec := metalCluster.Spec.FirewallSpec.DeepCopy()
+	spec.ProviderID = nil
+	return *spec
+}
+
+// provisionedFirewallSpec is the part of the spec which is applied when the firewall is provisioned.
+// The machine is chosen for the firewall, so it doesn't need to match the spec of the cluster.
+func provisionedFirewallSpec(spec api.MetalStackFirewallSpec) api.MetalStackFirewallSpec {
+	spec.ProviderID = nil
+	return spec
+}
@@ -0,0 +1,216 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	metalgo "github.com/metal-stack/metal-go"
+	metalmodels "github.com/metal-stack/metal-go/api/models"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/utils/pointer"
+	capi "sigs.k8s.io/cluster-api/api/v1alpha4"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	api "github.com/metal-stack/cluster-api-provider-metalstack/api/v1alpha4"
+	"github.com/metal-stack/cluster-api-provider-metalstack/controllers/mocks"
+)
+
+// The move is run against the API server of envtest, which drops the status of the created objects like the target cluster of `clusterctl move`.
+var _ = Describe("Move MetalStackCluster", func() {
+	const (
+		source   = "move-source"
+		target   = "move-target"
+		name     = "moved"
+		firewall = "moved-updated"
+		host     = "100.255.254.1"
+		egressIP = "212.34.83.10"
+	)
+
+	ctrl := gomock.NewController(GinkgoT())
+	metalClient := mocks.NewMockMetalStackClient(ctrl)
+	statusReader := mocks.NewMockFirewallControllerStatusReader(ctrl)
+	expireAt := metav1.NewTime(time.Now().Add(firewallControllerCredentialsLifetime).Truncate(time.Second))
+	ctx := context.TODO()
+
+	It("Should adopt the resources of the moved cluster", func() {
+		for _, namespace := range []string{source, target} {
+			Expect(k8sClient.Create(ctx, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespace}})).To(Succeed())
+		}
+
+		By("provisioning the cluster in the source namespace")
+		cluster := &capi.Cluster{
+			ObjectMeta: metav1.ObjectMeta{Namespace: source, Name: name},
+			Spec: capi.ClusterSpec{
+				Paused: true,
+				InfrastructureRef: &corev1.ObjectReference{
+					APIVersion: api.GroupVersion.String(),
+					Kind:       "MetalStackCluster",
+					Name:       name,
+				},
+			},
+		}
+		Expect(k8sClient.Create(ctx, cluster)).To(Succeed())
+
+		metalCluster := &api.MetalStackCluster{
+			ObjectMeta: metav1.ObjectMeta{Namespace: source, Name: name},
+			Spec: api.MetalStackClusterSpec{
+				ControlPlaneEndpoint: capi.APIEndpoint{Host: host, Port: 6443},
+				ProjectID:            "project",
+				Partition:            "partition",
+				PrivateNetworkID:     pointer.StringPtr("privateNetworkID"),
+				PublicNetworkID:      "internet",
+				FirewallSpec: api.MetalStackFirewallSpec{
+					Image:       "firewall-ubuntu-2.0",
+					MachineType: "v1-small-x86",
+					EgressIPs:   []api.EgressIP{{Name: "partner"}},
+				},
+			},
+		}
+		Expect(controllerutil.SetOwnerReference(cluster, metalCluster, scheme.Scheme)).To(Succeed())
+		Expect(k8sClient.Create(ctx, metalCluster)).To(Succeed())
+		metalCluster.SetClusterID()
+		Expect(k8sClient.Update(ctx, metalCluster)).To(Succeed())
+		clusterIDTag := metalCluster.GetClusterIDTag()
+
+		metalCluster.Status.ControlPlaneIPAllocated = true
+		metalCluster.Status.Firewalls = []string{firewall}
+		metalCluster.Status.EgressIPs = []api.EgressIPStatus{{Name: "partner", IP: egressIP, Allocated: true}}
+		Expect(k8sClient.Status().Update(ctx, metalCluster)).To(Succeed())
+
+		fw := &api.MetalStackFirewall{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: source,
+				Name:      firewall,
+				Labels:    map[string]string{capi.ClusterLabelName: name},
+			},
+			Spec: api.MetalStackFirewallSpec{
+				ProviderID:  pointer.StringPtr("metalstack://firewall"),
+				Image:       "firewall-ubuntu-2.0",
+				MachineType: "v1-small-x86",
+				EgressIPs:   []api.EgressIP{{Name: "partner"}},
+			},
+		}
+		setProvisionedCredentials(fw, &expireAt)
+		Expect(controllerutil.SetControllerReference(metalCluster, fw, scheme.Scheme)).To(Succeed())
+		Expect(k8sClient.Create(ctx, fw)).To(Succeed())
+
+		By("moving the cluster to the target namespace")
+		moveObjects(ctx, target, cluster, metalCluster, fw)
+
+		moved := &api.MetalStackCluster{}
+		Expect(k8sClient.Get(ctx, types.NamespacedName{Namespace: target, Name: name}, moved)).To(Succeed())
+		Expect(moved.Status.ControlPlaneIPAllocated).To(BeFalse())
+		Expect(moved.Status.Firewalls).To(BeEmpty())
+		Expect(moved.GetClusterIDTag()).To(Equal(clusterIDTag))
+
+		By("reconciling the paused cluster")
+		clusterReconciler := &MetalStackClusterReconciler{
+			Client:           k8sClient,
+			Log:              zap.New(zap.UseDevMode(true)),
+			MetalStackClient: metalClient,
+			Scheme:           scheme.Scheme,
+		}
+		req := reconcile.Request{NamespacedName: types.NamespacedName{Namespace: target, Name: name}}
+		res, err := clusterReconciler.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(res).To(Equal(reconcile.Result{}))
+
+		By("reconciling the unpaused cluster")
+		movedCluster := &capi.Cluster{}
+		Expect(k8sClient.Get(ctx, types.NamespacedName{Namespace: target, Name: name}, movedCluster)).To(Succeed())
+		movedCluster.Spec.Paused = false
+		Expect(k8sClient.Update(ctx, movedCluster)).To(Succeed())
+
+		metalClient.EXPECT().IPGet(host).Return(&metalgo.IPDetailResponse{
+			IP: &metalmodels.V1IPResponse{Ipaddress: pointer.StringPtr(host), Projectid: pointer.StringPtr("project")},
+		}, nil)
+		metalClient.EXPECT().IPFind(gomock.Any()).DoAndReturn(func(ifr *metalgo.IPFindRequest) (*metalgo.IPListResponse, error) {
+			Expect(ifr.Tags).To(ConsistOf(clusterIDTag))
+			return &metalgo.IPListResponse{
+				IPs: []*metalmodels.V1IPResponse{{Name: name + "-egress-partner", Ipaddress: pointer.StringPtr(egressIP)}},
+			}, nil
+		})
+		metalClient.EXPECT().PartitionCapacity().Return(newPartitionCapacityResponse(1), nil)
+
+		_, err = clusterReconciler.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(k8sClient.Get(ctx, req.NamespacedName, moved)).To(Succeed())
+		Expect(moved.Status.ControlPlaneIPAllocated).To(BeTrue())
+		Expect(moved.Status.Firewalls).To(Equal([]string{firewall}))
+		Expect(moved.Status.EgressIPs).To(Equal([]api.EgressIPStatus{{Name: "partner", IP: egressIP, Allocated: true}}))
+
+		firewalls := &api.MetalStackFirewallList{}
+		Expect(k8sClient.List(ctx, firewalls, client.InNamespace(target))).To(Succeed())
+		Expect(firewalls.Items).To(HaveLen(1))
+
+		By("reconciling the moved firewall")
+		firewallReconciler := &MetalStackFirewallReconciler{
+			Client:                 k8sClient,
+			ControllerStatusReader: statusReader,
+			Log:                    zap.New(zap.UseDevMode(true)),
+			MetalStackClient:       metalClient,
+			Scheme:                 scheme.Scheme,
+		}
+		expectAllocatedFirewall(metalClient)
+
+		_, err = firewallReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: types.NamespacedName{Namespace: target, Name: firewall}})
+		Expect(err).NotTo(HaveOccurred())
+
+		movedFirewall := &api.MetalStackFirewall{}
+		Expect(k8sClient.Get(ctx, types.NamespacedName{Namespace: target, Name: firewall}, movedFirewall)).To(Succeed())
+		Expect(movedFirewall.Status.CredentialsExpireAt).NotTo(BeNil())
+		Expect(movedFirewall.Status.CredentialsExpireAt.Time).To(BeTemporally("==", expireAt.Time))
+	})
+})
+
+// moveObjects recreates the objects in the namespace like `clusterctl move` does.
+// The objects are ordered by their owners, whose references are updated to the recreated owners.
+func moveObjects(ctx context.Context, namespace string, objects ...client.Object) {
+	uids := make(map[types.UID]types.UID)
+	for _, o := range objects {
+		o = o.DeepCopyObject().(client.Object)
+		Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(o), o)).To(Succeed())
+
+		uid := o.GetUID()
+		o.SetNamespace(namespace)
+		o.SetUID("")
+		o.SetResourceVersion("")
+		o.SetCreationTimestamp(metav1.Time{})
+		o.SetManagedFields(nil)
+
+		refs := o.GetOwnerReferences()
+		for i := range refs {
+			refs[i].UID = uids[refs[i].UID]
+		}
+		o.SetOwnerReferences(refs)
+
+		Expect(k8sClient.Create(ctx, o)).To(Succeed())
+		uids[uid] = o.GetUID()
+	}
+}
@@ -19,49 +19,153 @@ package controllers
 import (
 	"context"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/go-logr/logr"
 	api "github.com/metal-stack/cluster-api-provider-metalstack/api/v1alpha4"
 	metalgo "github.com/metal-stack/metal-go"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	capi "sigs.k8s.io/cluster-api/api/v1alpha4"
+	"sigs.k8s.io/cluster-api/util"
+	"sigs.k8s.io/cluster-api/util/annotations"
+	"sigs.k8s.io/cluster-api/util/conditions"
 	"sigs.k8s.io/cluster-api/util/patch"
+	"sigs.k8s.io/cluster-api/util/predicates"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 )
 
+// firewallAllocationInterval is the period in which a firewall is checked until its allocation succeeded and its firewall-controller reported.
+const firewallAllocationInterval = 15 * time.Second
+
 // MetalStackFirewallReconciler reconciles a MetalStackFirewall object
 type MetalStackFirewallReconciler struct {
-	Client           client.Client
-	Log              logr.Logger
-	MetalStackClient MetalStackClient
-	Scheme           *runtime.Scheme
+	Client                 client.Client
+	ControllerStatusReader FirewallControllerStatusReader
+	CredentialsIssuer      FirewallCredentialsIssuer
+	Log                    logr.Logger
+	MetalStackClient       MetalStackClient
+	Scheme                 *runtime.Scheme
+
+	// WatchFilterValue restricts the reconciled objects to those with the watch-filter label of this value, if set.
+	WatchFilterValue string
 }
 
 func NewMetalStackFirewallReconciler(metalClient MetalStackClient, mgr manager.Manager) *MetalStackFirewallReconciler {
 	return &MetalStackFirewallReconciler{
-		Client:           mgr.GetClient(),
-		Log:              ctrl.Log.WithName("controllers").WithName("MetalStackCluster"),
-		MetalStackClient: metalClient,
-		Scheme:           mgr.GetScheme(),
+		Client:                 mgr.GetClient(),
+		ControllerStatusReader: NewFirewallControllerStatusReader(),
+		CredentialsIssuer:      NewServiceAccountCredentialsIssuer(),
+		Log:                    ctrl.Log.WithName("controllers").WithName("MetalStackCluster"),
+		MetalStackClient:       metalClient,
+		Scheme:                 mgr.GetScheme(),
 	}
 }
 
 // +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=metalstackfirewalls,verbs=get;list;watch;create;update;patch;delete;deletecollection
 // +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=metalstackfirewalls/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch;create;update
+// +kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch
 
+// SetupWithManager watches the kubeconfig Secret and the MetalStackCluster of the firewalls,
+// so that a firewall is reconciled as soon as its inputs appear.
+// Only the metadata of the Secrets is watched, since their names are enough to map them to the firewalls.
 func (r *MetalStackFirewallReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&api.MetalStackFirewall{}).
+		For(&api.MetalStackFirewall{}, builder.WithPredicates(predicates.ResourceHasFilterLabel(r.Log, r.WatchFilterValue))).
+		Watches(
+			&source.Kind{Type: &core.Secret{}},
+			handler.EnqueueRequestsFromMapFunc(r.kubeconfigToFirewalls),
+			builder.OnlyMetadata,
+		).
+		Watches(
+			&source.Kind{Type: &api.MetalStackCluster{}},
+			handler.EnqueueRequestsFromMapFunc(r.metalClusterToFirewalls),
+			builder.WithPredicates(predicates.ResourceHasFilterLabel(r.Log, r.WatchFilterValue)),
+		).
+		Watches(
+			&source.Kind{Type: &capi.Cluster{}},
+			handler.EnqueueRequestsFromMapFunc(r.clusterToFirewalls),
+			builder.WithPredicates(predicates.ClusterUnpaused(r.Log), predicates.ResourceHasFilterLabel(r.Log, r.WatchFilterValue)),
+		).
+		WithEventFilter(predicates.ResourceNotPaused(r.Log)).
+		WithOptions(controllerOptions()).
 		Complete(r)
 }
 
+// clusterToFirewalls maps a Cluster to the firewalls of its MetalStackCluster.
+func (r *MetalStackFirewallReconciler) clusterToFirewalls(o client.Object) []ctrl.Request {
+	cluster, ok := o.(*capi.Cluster)
+	if !ok || cluster.Spec.InfrastructureRef == nil {
+		return nil
+	}
+
+	return r.firewallsOfCluster(cluster.Namespace, cluster.Spec.InfrastructureRef.Name)
+}
+
+// kubeconfigToFirewalls maps the kubeconfig Secret of a cluster to its firewalls.
+func (r *MetalStackFirewallReconciler) kubeconfigToFirewalls(o client.Object) []ctrl.Request {
+	suffix := fmt.Sprintf(kubeconfigSecretNameTemplate, "")
+	if !strings.HasSuffix(o.GetName(), suffix) {
+		return nil
+	}
+
+	return r.firewallsOfCluster(o.GetNamespace(), strings.TrimSuffix(o.GetName(), suffix))
+}
+
+// metalClusterToFirewalls maps a MetalStackCluster to its firewalls.
+func (r *MetalStackFirewallReconciler) metalClusterToFirewalls(o client.Object) []ctrl.Request {
+	return r.firewallsOfCluster(o.GetNamespace(), o.GetName())
+}
+
+func (r *MetalStackFirewallReconciler) firewallsOfCluster(namespace, clusterName string) []ctrl.Request {
+	// The kubeconfig Secret isn't labeled for the watch filter, so the firewalls are filtered instead.
+	labels := client.MatchingLabels{capi.ClusterLabelName: clusterName}
+	if r.WatchFilterValue != "" {
+		labels[capi.WatchLabel] = r.WatchFilterValue
+	}
+
+	firewalls := &api.MetalStackFirewallList{}
+	if err := r.Client.List(context.TODO(), firewalls, client.InNamespace(namespace), labels); err != nil {
+		r.Log.Info(fmt.Sprintf("Failed to list MetalStackFirewalls of cluster %s/%s: %s", namespace, clusterName, err))
+		return nil
+	}
+
+	requests := make([]ctrl.Request, 0, len(firewalls.Items))
+	for _, firewall := range firewalls.Items {
+		requests = append(requests, ctrl.Request{
+			NamespacedName: types.NamespacedName{Namespace: firewall.Namespace, Name: firewall.Name},
+		})
+	}
+	return requests
+}
+
+// withPinnedMetalStackClient returns a copy of the reconciler which sends all requests to the current metal-API client.
+func (r *MetalStackFirewallReconciler) withPinnedMetalStackClient() *MetalStackFirewallReconciler {
+	pinned := *r
+	pinned.MetalStackClient = pinMetalStackClient(r.MetalStackClient)
+	return &pinned
+}
+
 func (r *MetalStackFirewallReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	r = r.withPinnedMetalStackClient()
+
 	logger := r.Log.WithValues("MetalStackFirewall", req.NamespacedName)
 
+	if res, ok := requeueWhileCircuitOpen(r.MetalStackClient); ok {
+		logger.Info(fmt.Sprintf("metal-API is unavailable, requeueing after %s", res.RequeueAfter))
+		return res, nil
+	}
+
 	// Fetch the MetalStackFirewall in the Request.
 	firewall := &api.MetalStackFirewall{}
 	if err := r.Client.Get(ctx, req.NamespacedName, firewall); err != nil {
@@ -72,9 +176,24 @@ func (r *MetalStackFirewallReconciler) Reconcile(ctx context.Context, req ctrl.R
 		Namespace: firewall.Namespace,
 		Name:      firewall.Labels[capi.ClusterLabelName],
 	}
+	// The firewall is reconciled again by the watch once the MetalStackCluster is ready.
 	metalCluster := getMetalStackCluster(ctx, logger, r.Client, metalClusterNamespacedName)
 	if metalCluster == nil {
-		return ctrl.Result{Requeue: true}, nil
+		return ctrl.Result{}, nil
+	}
+
+	// The firewall is paused with its cluster, e.g. during `clusterctl move`.
+	cluster, err := util.GetOwnerCluster(ctx, r.Client, metalCluster.ObjectMeta)
+	if err != nil {
+		return ctrl.Result{}, fmt.Errorf("get OwnerCluster: %w", err)
+	}
+	if annotations.HasPausedAnnotation(firewall) || cluster != nil && annotations.IsPaused(cluster, metalCluster) {
+		logger.Info("Cluster or MetalStackFirewall is paused")
+		return ctrl.Result{}, nil
+	}
+
+	if err := prefetchClusterMachines(r.MetalStackClient, metalCluster); err != nil {
+		logger.Info(fmt.Sprintf("Failed to prefetch the machines of the cluster: %s", err))
 	}
 
 	// Persist any change to MetalStackFirewall
@@ -141,20 +260,49 @@ func (r *MetalStackFirewallReconciler) reconcile(
 	metalCluster *api.MetalStackCluster,
 ) (ctrl.Result, error) {
 	controllerutil.AddFinalizer(firewall, api.MetalStackFirewallFinalizer)
+	recoverProvisionedCredentials(firewall)
 
 	// Check if the firewall was deployed successfully
 	if pid, err := firewall.Spec.ParsedProviderID(); err == nil {
-		resp, _ := r.MetalStackClient.MachineGet(pid)
+		resp, err := r.MetalStackClient.MachineGet(pid)
+		if err != nil {
+			return ctrl.Result{}, fmt.Errorf("failed to get machine with ID %s: %w", pid, err)
+		}
 		if resp.Machine.Allocation != nil {
+			setFirewallMachineStatus(firewall, resp.Machine)
+
 			resp2, err := r.MetalStackClient.FirewallGet(pid)
 			if err != nil {
 				return ctrl.Result{}, fmt.Errorf("failed to get firewall with ID %s: %w", pid, err)
 			}
 
+			// The firewall routes the traffic once it's allocated and its firewall-controller reported.
 			succeded := *resp2.Firewall.Allocation.Succeeded
+			if !succeded {
+				conditions.MarkFalse(firewall, api.FirewallAllocatedCondition, api.FirewallAllocatingReason, capi.ConditionSeverityInfo, "Waiting for allocation of machine %s to succeed", pid)
+			} else {
+				conditions.MarkTrue(firewall, api.FirewallAllocatedCondition)
+			}
+			if !firewall.Status.Ready {
+				ready := succeded && r.firewallControllerReported(ctx, logger, firewall, metalCluster)
+				if !ready {
+					return ctrl.Result{RequeueAfter: firewallAllocationInterval}, nil
+				}
+				observeProvisioning(provisionedFirewall, metalCluster, firewall.CreationTimestamp)
+			} else if succeded {
+				// The heartbeat is kept up to date, but a ready firewall keeps routing the traffic without it.
+				r.firewallControllerReported(ctx, logger, firewall, metalCluster)
+			}
 			firewall.Status.Ready = succeded
+			if !succeded {
+				return ctrl.Result{RequeueAfter: firewallAllocationInterval}, nil
+			}
 
-			return ctrl.Result{Requeue: !succeded}, nil
+			res := r.rotateCredentials(ctx, logger, firewall, metalCluster)
+			if res.RequeueAfter <= 0 || res.RequeueAfter > firewallHealthCheckInterval {
+				res.RequeueAfter = firewallHealthCheckInterval
+			}
+			return res, nil
 		}
 	}
 
@@ -162,8 +310,8 @@ func (r *MetalStackFirewallReconciler) reconcile(
 		return ctrl.Result{}, err
 	}
 
-	// Always requeue after successful firewall creation to check allocation in next reconcilation
-	return ctrl.Result{Requeue: true}, nil
+	// The allocation isn't watched, so it's checked after an interval.
+	return ctrl.Result{RequeueAfter: firewallAllocationInterval}, nil
 }
 
 func (r *MetalStackFirewallReconciler) createRawMachineIfNotExists(
@@ -172,29 +320,52 @@ func (r *MetalStackFirewallReconciler) createRawMachineIfNotExists(
 	firewall *api.MetalStackFirewall,
 	metalCluster *api.MetalStackCluster,
 ) error {
-	kubeconfig, err := getKubeconfig(ctx, r.Client, metalCluster)
+	if adopted, err := r.adoptFirewallMachine(logger, firewall, metalCluster); err != nil || adopted {
+		return err
+	}
+
+	egressIPs, err := firewallEgressIPs(firewall, metalCluster)
+	if err != nil {
+		return err
+	}
+
+	// The kubeconfig is generated once the cluster is ready, which waits for the firewall.
+	// Neither may the workload cluster be reachable without the firewall.
+	// Failing to issue credentials for an existing kubeconfig is retried instead of creating a firewall
+	// which can't be provisioned again with firewall-controller.
+	kubeconfig, expireAt, err := r.firewallControllerKubeconfig(ctx, logger, metalCluster)
 	if err != nil {
-		return fmt.Errorf("Failed to get kubeconfig: %w", err)
+		return err
 	}
 	if kubeconfig == nil {
-		return nil
+		logger.Info("Kubeconfig of the cluster doesn't exist yet, creating firewall without firewall-controller")
 	}
 
-	userData, err := generateFirewallIgnitionConfig(kubeconfig)
+	files, err := r.firewallFiles(ctx, firewall)
+	if err != nil {
+		return err
+	}
+
+	userData, err := generateFirewallIgnitionConfig(&firewall.Spec, kubeconfig, files)
 	if err != nil {
 		return fmt.Errorf("Failed to generate firewall ignition config: %w", err)
 	}
 
+	networks := toMachineNetworks(metalCluster.Spec.PublicNetworkID, *metalCluster.Spec.PrivateNetworkID)
+	// The egress traffic leaves through the static IPs instead of an ephemeral one.
+	networks[0].Autoacquire = len(egressIPs) == 0
+
 	machineCreateReq := metalgo.MachineCreateRequest{
 		Description:   firewall.Name + " created by Cluster API provider MetalStack",
 		Name:          firewall.Name,
-		Hostname:      firewall.Name + "-firewall",
+		Hostname:      firewallHostname(firewall),
 		Size:          firewall.Spec.MachineType,
 		Project:       metalCluster.Spec.ProjectID,
 		Partition:     metalCluster.Spec.Partition,
 		Image:         firewall.Spec.Image,
 		SSHPublicKeys: firewall.Spec.SSHKeys,
-		Networks:      toMachineNetworks(metalCluster.Spec.PublicNetworkID, *metalCluster.Spec.PrivateNetworkID),
+		Networks:      networks,
+		IPs:           egressIPs,
 		UserData:      userData,
 		Tags:          []string{metalCluster.GetClusterIDTag()},
 	}
@@ -203,6 +374,15 @@ func (r *MetalStackFirewallReconciler) createRawMachineIfNotExists(
 	if pid, err := firewall.Spec.ParsedProviderID(); err == nil {
 		logger.Info(fmt.Sprintf("Deploy Firewall on machine: %s", pid))
 		machineCreateReq.UUID = pid
+	} else {
+		pid, err := r.placeFirewall(ctx, firewall, metalCluster)
+		if err != nil {
+			return err
+		}
+		if pid != "" {
+			logger.Info(fmt.Sprintf("Deploy Firewall on machine %s in a rack without other firewalls", pid))
+			machineCreateReq.UUID = pid
+		}
 	}
 
 	resp, err := r.MetalStackClient.FirewallCreate(&metalgo.FirewallCreateRequest{
@@ -213,5 +393,99 @@ func (r *MetalStackFirewallReconciler) createRawMachineIfNotExists(
 	}
 
 	firewall.Spec.SetProviderID(*resp.Firewall.ID)
+	setProvisionedCredentials(firewall, nil)
+	if kubeconfig != nil {
+		setProvisionedCredentials(firewall, expireAt)
+	}
 	return nil
 }
+
+// adoptFirewallMachine looks up the firewall machine allocated for the firewall by its name and the tag of the cluster.
+// The provider ID is lost if the firewall was allocated, but the MetalStackFirewall wasn't updated anymore.
+func (r *MetalStackFirewallReconciler) adoptFirewallMachine(
+	logger logr.Logger,
+	firewall *api.MetalStackFirewall,
+	metalCluster *api.MetalStackCluster,
+) (bool, error) {
+	resp, err := r.MetalStackClient.FirewallFind(&metalgo.FirewallFindRequest{
+		MachineFindRequest: metalgo.MachineFindRequest{
+			AllocationName:    &firewall.Name,
+			AllocationProject: &metalCluster.Spec.ProjectID,
+			Tags:              []string{metalCluster.GetClusterIDTag()},
+		},
+	})
+	if err != nil {
+		return false, fmt.Errorf("error finding firewalls: %w", err)
+	}
+	if len(resp.Firewalls) != 1 || resp.Firewalls[0].ID == nil {
+		return false, nil
+	}
+
+	id := *resp.Firewalls[0].ID
+	logger.Info(fmt.Sprintf("Firewall machine %s is already allocated, adopting it", id))
+	firewall.Spec.SetProviderID(id)
+	return true, nil
+}
+
+// setProvisionedCredentials records the expiry of the firewall-controller credentials the firewall is provisioned with.
+func setProvisionedCredentials(firewall *api.MetalStackFirewall, expireAt *metav1.Time) {
+	firewall.Status.CredentialsExpireAt = expireAt
+	if expireAt == nil {
+		delete(firewall.Annotations, api.FirewallCredentialsExpireAtAnnotation)
+		return
+	}
+	if firewall.Annotations == nil {
+		firewall.Annotations = make(map[string]string)
+	}
+	firewall.Annotations[api.FirewallCredentialsExpireAtAnnotation] = expireAt.UTC().Format(time.RFC3339)
+}
+
+// recoverProvisionedCredentials recovers the expiry of the firewall-controller credentials from the annotation.
+func recoverProvisionedCredentials(firewall *api.MetalStackFirewall) {
+	if firewall.Status.CredentialsExpireAt != nil {
+		return
+	}
+	t, err := time.Parse(time.RFC3339, firewall.Annotations[api.FirewallCredentialsExpireAtAnnotation])
+	if err != nil {
+		return
+	}
+	firewall.Status.CredentialsExpireAt = &metav1.Time{Time: t}
+}
+
+// firewallEgressIPs returns the addresses of the egress IPs of the firewall spec.
+// They're allocated by the MetalStackCluster controller.
+func firewallEgressIPs(firewall *api.MetalStackFirewall, metalCluster *api.MetalStackCluster) ([]string, error) {
+	var ips []string
+	for _, egressIP := range firewall.Spec.EgressIPs {
+		ip, ok := metalCluster.Status.GetEgressIP(egressIP.Name)
+		if !ok {
+			return nil, fmt.Errorf("egress IP %s isn't allocated yet", egressIP.Name)
+		}
+		ips = append(ips, ip)
+	}
+	return ips, nil
+}
+
+// rotateCredentials rotates the credentials of the firewall-controller before they expire.
+// The firewall gets the current credentials only when it's provisioned again.
+func (r *MetalStackFirewallReconciler) rotateCredentials(
+	ctx context.Context,
+	logger logr.Logger,
+	firewall *api.MetalStackFirewall,
+	metalCluster *api.MetalStackCluster,
+) ctrl.Result {
+	_, expireAt, err := r.firewallControllerKubeconfig(ctx, logger, metalCluster)
+	if err != nil {
+		logger.Info(fmt.Sprintf("Failed to rotate credentials of firewall-controller: %s", err))
+		return ctrl.Result{RequeueAfter: time.Minute}
+	}
+	if expireAt == nil {
+		return ctrl.Result{}
+	}
+
+	if !expireAt.Equal(firewall.Status.CredentialsExpireAt) {
+		logger.Info("Firewall isn't provisioned with the current credentials of firewall-controller")
+	}
+
+	return ctrl.Result{RequeueAfter: time.Until(expireAt.Add(-firewallControllerCredentialsRotation))}
+}
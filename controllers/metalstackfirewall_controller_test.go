@@ -19,34 +19,54 @@ package controllers
 import (
 	"context"
 	"fmt"
+	"time"
 
+	"github.com/go-openapi/strfmt"
 	"github.com/golang/mock/gomock"
 	metalgo "github.com/metal-stack/metal-go"
 	metalmodels "github.com/metal-stack/metal-go/api/models"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/ginkgo/extensions/table"
 	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/utils/pointer"
+	capi "sigs.k8s.io/cluster-api/api/v1alpha4"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
+	api "github.com/metal-stack/cluster-api-provider-metalstack/api/v1alpha4"
 	"github.com/metal-stack/cluster-api-provider-metalstack/controllers/mocks"
 )
 
 var _ = Describe("Reconcile MetalStackFirewall", func() {
 
 	type MetalStackFirewallTestCase struct {
-		Objects  []runtime.Object
-		Requeue  bool
-		Error    bool
-		MockFunc func()
+		Objects []runtime.Object
+		// RequeueAfter is the expected delay of the requeue, if set.
+		RequeueAfter time.Duration
+		Error        bool
+		MockFunc     func()
+		// CredentialsIssued expects the firewall to be provisioned with issued credentials of the firewall-controller.
+		CredentialsIssued bool
+		// Check checks the reconciled MetalStackFirewall, if set.
+		Check func(firewall *api.MetalStackFirewall)
 	}
 
 	ctrl := gomock.NewController(GinkgoT())
 	metalClient := mocks.NewMockMetalStackClient(ctrl)
+	credentialsIssuer := mocks.NewMockFirewallCredentialsIssuer(ctrl)
+	statusReader := mocks.NewMockFirewallControllerStatusReader(ctrl)
+	expireAt := time.Now().Add(firewallControllerCredentialsLifetime).Truncate(time.Second)
+	expectNoFirewallMachine := func() {
+		metalClient.EXPECT().FirewallFind(gomock.Any()).Return(&metalgo.FirewallListResponse{}, nil)
+	}
 	metalStackMachineTestFunc := func(tc MetalStackFirewallTestCase) {
-		r := newTestMetalFirewallReconciler(metalClient, tc.Objects)
+		r := newTestMetalFirewallReconciler(metalClient, credentialsIssuer, statusReader, tc.Objects)
 		req := reconcile.Request{
 			NamespacedName: types.NamespacedName{
 				Name:      metalStackFirewallName,
@@ -64,14 +84,37 @@ var _ = Describe("Reconcile MetalStackFirewall", func() {
 		} else {
 			Expect(err).NotTo(HaveOccurred())
 		}
-		Expect(res.Requeue).To(Equal(tc.Requeue))
+		// Objects are never requeued immediately, but after an interval or with the backoff of errors.
+		Expect(res.Requeue).To(BeFalse())
+		if tc.RequeueAfter != 0 {
+			Expect(res.RequeueAfter).To(Equal(tc.RequeueAfter))
+		}
+
+		if tc.CredentialsIssued {
+			secret := &corev1.Secret{}
+			Expect(r.Client.Get(context.TODO(), types.NamespacedName{
+				Namespace: namespaceName,
+				Name:      fmt.Sprintf(firewallControllerKubeconfigSecretNameTemplate, metalStackClusterName),
+			}, secret)).To(Succeed())
+			Expect(secret.Data["value"]).To(Equal([]byte("restricted")))
+
+			firewall := &api.MetalStackFirewall{}
+			Expect(r.Client.Get(context.TODO(), req.NamespacedName, firewall)).To(Succeed())
+			Expect(firewall.Status.CredentialsExpireAt).NotTo(BeNil())
+			Expect(firewall.Status.CredentialsExpireAt.Time).To(BeTemporally("==", expireAt))
+		}
+
+		if tc.Check != nil {
+			firewall := &api.MetalStackFirewall{}
+			Expect(r.Client.Get(context.TODO(), req.NamespacedName, firewall)).To(Succeed())
+			tc.Check(firewall)
+		}
 	}
 
 	DescribeTable("Create Firewall", metalStackMachineTestFunc,
 		Entry("Should be no error when metal-stack firewall not found", MetalStackFirewallTestCase{}),
-		Entry("Should requeue if MetalStackCluster not available", MetalStackFirewallTestCase{
+		Entry("Should wait for the watch if MetalStackCluster not available", MetalStackFirewallTestCase{
 			Objects: []runtime.Object{newMetalStackFirewall(nil, false)},
-			Requeue: true,
 		}),
 		Entry("Should fail if FirewallCreate failed", MetalStackFirewallTestCase{
 			Objects: []runtime.Object{
@@ -81,16 +124,111 @@ var _ = Describe("Reconcile MetalStackFirewall", func() {
 			},
 			Error: true,
 			MockFunc: func() {
+				expectNoFirewallMachine()
+				credentialsIssuer.EXPECT().Issue(gomock.Any(), gomock.Any(), gomock.Any()).Return([]byte("restricted"), expireAt, nil)
 				metalClient.EXPECT().FirewallCreate(gomock.Any()).Return(nil, fmt.Errorf("error"))
 			},
 		}),
+		Entry("Should create firewall with credentials of firewall-controller", MetalStackFirewallTestCase{
+			Objects: []runtime.Object{
+				newSecret(fmt.Sprintf(kubeconfigSecretNameTemplate, metalStackClusterName)),
+				newMetalStackCluster(nil, pointer.StringPtr("privateNetworkID"), false, false),
+				newMetalStackFirewall(nil, false),
+			},
+			RequeueAfter:      firewallAllocationInterval,
+			CredentialsIssued: true,
+			MockFunc: func() {
+				expectNoFirewallMachine()
+				credentialsIssuer.EXPECT().Issue(gomock.Any(), gomock.Any(), firewallControllerCredentialsLifetime).Return([]byte("restricted"), expireAt, nil)
+				metalClient.EXPECT().FirewallCreate(gomock.Any()).DoAndReturn(
+					func(fcr *metalgo.FirewallCreateRequest) (*metalgo.FirewallCreateResponse, error) {
+						Expect(fcr.UserData).To(ContainSubstring("restricted"))
+						return &metalgo.FirewallCreateResponse{
+							Firewall: &metalmodels.V1FirewallResponse{ID: pointer.StringPtr(nodeID)},
+						}, nil
+					})
+			},
+		}),
+		Entry("Should not create firewall if issuing credentials failed", MetalStackFirewallTestCase{
+			Objects: []runtime.Object{
+				newSecret(fmt.Sprintf(kubeconfigSecretNameTemplate, metalStackClusterName)),
+				newMetalStackCluster(nil, pointer.StringPtr("privateNetworkID"), false, false),
+				newMetalStackFirewall(nil, false),
+			},
+			Error: true,
+			MockFunc: func() {
+				expectNoFirewallMachine()
+				credentialsIssuer.EXPECT().Issue(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil, time.Time{}, fmt.Errorf("error"))
+			},
+		}),
+		Entry("Should create firewall with static egress IPs", MetalStackFirewallTestCase{
+			Objects: []runtime.Object{
+				newSecret(fmt.Sprintf(kubeconfigSecretNameTemplate, metalStackClusterName)),
+				func() *api.MetalStackCluster {
+					metalCluster := newMetalStackCluster(nil, pointer.StringPtr("privateNetworkID"), false, false)
+					metalCluster.Status.EgressIPs = []api.EgressIPStatus{{Name: "partner", IP: "212.34.83.10", Allocated: true}}
+					return metalCluster
+				}(),
+				func() *api.MetalStackFirewall {
+					firewall := newMetalStackFirewall(nil, false)
+					firewall.Spec.EgressIPs = []api.EgressIP{{Name: "partner"}}
+					return firewall
+				}(),
+			},
+			RequeueAfter: firewallAllocationInterval,
+			MockFunc: func() {
+				expectNoFirewallMachine()
+				credentialsIssuer.EXPECT().Issue(gomock.Any(), gomock.Any(), gomock.Any()).Return([]byte("restricted"), expireAt, nil)
+				metalClient.EXPECT().FirewallCreate(gomock.Any()).DoAndReturn(
+					func(fcr *metalgo.FirewallCreateRequest) (*metalgo.FirewallCreateResponse, error) {
+						Expect(fcr.IPs).To(Equal([]string{"212.34.83.10"}))
+						Expect(fcr.Networks[0].Autoacquire).To(BeFalse())
+						return &metalgo.FirewallCreateResponse{
+							Firewall: &metalmodels.V1FirewallResponse{ID: pointer.StringPtr(nodeID)},
+						}, nil
+					})
+			},
+		}),
+		Entry("Should fail if static egress IP isn't allocated yet", MetalStackFirewallTestCase{
+			Objects: []runtime.Object{
+				newSecret(fmt.Sprintf(kubeconfigSecretNameTemplate, metalStackClusterName)),
+				newMetalStackCluster(nil, pointer.StringPtr("privateNetworkID"), false, false),
+				func() *api.MetalStackFirewall {
+					firewall := newMetalStackFirewall(nil, false)
+					firewall.Spec.EgressIPs = []api.EgressIP{{Name: "partner"}}
+					return firewall
+				}(),
+			},
+			Error:    true,
+			MockFunc: expectNoFirewallMachine,
+		}),
+		Entry("Should adopt the firewall machine allocated for the firewall", MetalStackFirewallTestCase{
+			Objects: []runtime.Object{
+				newSecret(fmt.Sprintf(kubeconfigSecretNameTemplate, metalStackClusterName)),
+				newMetalStackCluster(nil, pointer.StringPtr("privateNetworkID"), false, false),
+				newMetalStackFirewall(nil, false),
+			},
+			RequeueAfter: firewallAllocationInterval,
+			Check: func(firewall *api.MetalStackFirewall) {
+				Expect(firewall.Spec.ProviderID).To(Equal(pointer.StringPtr(nodeID)))
+			},
+			MockFunc: func() {
+				metalClient.EXPECT().FirewallFind(gomock.Any()).DoAndReturn(
+					func(ffr *metalgo.FirewallFindRequest) (*metalgo.FirewallListResponse, error) {
+						Expect(*ffr.AllocationName).To(Equal(metalStackFirewallName))
+						return &metalgo.FirewallListResponse{
+							Firewalls: []*metalmodels.V1FirewallResponse{{ID: pointer.StringPtr("test")}},
+						}, nil
+					})
+			},
+		}),
 		Entry("Should requeue if allocation not succeeded", MetalStackFirewallTestCase{
 			Objects: []runtime.Object{
 				newSecret(fmt.Sprintf(kubeconfigSecretNameTemplate, metalStackClusterName)),
 				newMetalStackCluster(nil, pointer.StringPtr("privateNetworkID"), false, false),
 				newMetalStackFirewall(pointer.StringPtr(nodeID), false),
 			},
-			Requeue: true,
+			RequeueAfter: firewallAllocationInterval,
 			MockFunc: func() {
 				metalClient.EXPECT().MachineGet(gomock.Any()).Return(
 					&metalgo.MachineGetResponse{
@@ -111,6 +249,258 @@ var _ = Describe("Reconcile MetalStackFirewall", func() {
 		Entry("Should succeed", MetalStackFirewallTestCase{
 			Objects: []runtime.Object{
 				newSecret(fmt.Sprintf(kubeconfigSecretNameTemplate, metalStackClusterName)),
+				newFirewallControllerSecret(expireAt),
+				newMetalStackCluster(nil, pointer.StringPtr("privateNetworkID"), false, false),
+				newMetalStackFirewall(pointer.StringPtr(nodeID), false),
+			},
+			MockFunc: func() {
+				metalClient.EXPECT().MachineGet(gomock.Any()).Return(
+					&metalgo.MachineGetResponse{
+						Machine: &metalmodels.V1MachineResponse{
+							Allocation: &metalmodels.V1MachineAllocation{},
+						},
+					}, nil)
+				metalClient.EXPECT().FirewallGet(gomock.Any()).Return(
+					&metalgo.FirewallGetResponse{
+						Firewall: &metalmodels.V1FirewallResponse{
+							Allocation: &metalmodels.V1MachineAllocation{
+								Succeeded: pointer.BoolPtr(true),
+							},
+						},
+					}, nil)
+			},
+		}),
+	)
+
+	newReplicaFirewall := func(name string, replica int32, providerID *string) *api.MetalStackFirewall {
+		firewall := newMetalStackFirewall(providerID, false)
+		firewall.Name = name
+		firewall.Labels[api.FirewallReplicaLabel] = fmt.Sprint(replica)
+		return firewall
+	}
+	expectFirewallRack := func(rack string) {
+		metalClient.EXPECT().MachineGet("other").Return(&metalgo.MachineGetResponse{
+			Machine: &metalmodels.V1MachineResponse{ID: pointer.StringPtr("other"), Rackid: rack},
+		}, nil)
+	}
+
+	DescribeTable("Place Firewall", metalStackMachineTestFunc,
+		Entry("Should deploy firewall in a rack without firewall of another replica", MetalStackFirewallTestCase{
+			Objects: []runtime.Object{
+				newMetalStackCluster(nil, pointer.StringPtr("privateNetworkID"), false, false),
+				newReplicaFirewall("other", 0, pointer.StringPtr("metalstack://other")),
+				newReplicaFirewall(metalStackFirewallName, 1, nil),
+			},
+			RequeueAfter: firewallAllocationInterval,
+			MockFunc: func() {
+				expectNoFirewallMachine()
+				expectFirewallRack("rack-1")
+				metalClient.EXPECT().MachineFind(gomock.Any()).Return(&metalgo.MachineListResponse{
+					Machines: []*metalmodels.V1MachineResponse{
+						{ID: pointer.StringPtr("same-rack"), Rackid: "rack-1"},
+						{ID: pointer.StringPtr("allocated"), Rackid: "rack-2", Allocation: &metalmodels.V1MachineAllocation{}},
+						{ID: pointer.StringPtr("other-rack"), Rackid: "rack-2"},
+					},
+				}, nil)
+				metalClient.EXPECT().FirewallCreate(gomock.Any()).DoAndReturn(
+					func(fcr *metalgo.FirewallCreateRequest) (*metalgo.FirewallCreateResponse, error) {
+						Expect(fcr.UUID).To(Equal("other-rack"))
+						return &metalgo.FirewallCreateResponse{
+							Firewall: &metalmodels.V1FirewallResponse{ID: pointer.StringPtr("other-rack")},
+						}, nil
+					})
+			},
+		}),
+		Entry("Should fail if every free machine is in a rack with firewall", MetalStackFirewallTestCase{
+			Objects: []runtime.Object{
+				newMetalStackCluster(nil, pointer.StringPtr("privateNetworkID"), false, false),
+				newReplicaFirewall("other", 0, pointer.StringPtr("metalstack://other")),
+				newReplicaFirewall(metalStackFirewallName, 1, nil),
+			},
+			Error: true,
+			MockFunc: func() {
+				expectNoFirewallMachine()
+				expectFirewallRack("rack-1")
+				metalClient.EXPECT().MachineFind(gomock.Any()).Return(&metalgo.MachineListResponse{
+					Machines: []*metalmodels.V1MachineResponse{
+						{ID: pointer.StringPtr("same-rack"), Rackid: "rack-1"},
+					},
+				}, nil)
+			},
+		}),
+	)
+
+	DescribeTable("Wait for firewall-controller", metalStackMachineTestFunc,
+		Entry("Should requeue until firewall-controller reported", MetalStackFirewallTestCase{
+			Objects: []runtime.Object{
+				newSecret(fmt.Sprintf(kubeconfigSecretNameTemplate, metalStackClusterName)),
+				newFirewallControllerSecret(expireAt),
+				newMetalStackCluster(nil, pointer.StringPtr("privateNetworkID"), false, false),
+				newFirewallWithController(expireAt),
+			},
+			RequeueAfter: firewallAllocationInterval,
+			MockFunc: func() {
+				expectAllocatedFirewall(metalClient)
+				statusReader.EXPECT().Read(gomock.Any(), gomock.Any(), metalStackFirewallName+"-firewall").Return("", nil, nil)
+			},
+		}),
+		Entry("Should be ready once firewall-controller reported", MetalStackFirewallTestCase{
+			Objects: []runtime.Object{
+				newSecret(fmt.Sprintf(kubeconfigSecretNameTemplate, metalStackClusterName)),
+				newFirewallControllerSecret(expireAt),
+				newMetalStackCluster(nil, pointer.StringPtr("privateNetworkID"), false, false),
+				newFirewallWithController(expireAt),
+			},
+			MockFunc: func() {
+				expectAllocatedFirewall(metalClient)
+				statusReader.EXPECT().Read(gomock.Any(), gomock.Any(), gomock.Any()).Return("v1.0.0", &metav1.Time{Time: time.Now()}, nil)
+			},
+		}),
+	)
+
+	allocatedAt := metav1.NewTime(time.Now().Add(-time.Hour).Truncate(time.Second))
+	expectFirewallMachine := func(liveliness string) {
+		created := strfmt.DateTime(allocatedAt.Time)
+		metalClient.EXPECT().MachineGet(gomock.Any()).Return(
+			&metalgo.MachineGetResponse{
+				Machine: &metalmodels.V1MachineResponse{
+					Liveliness: pointer.StringPtr(liveliness),
+					Allocation: &metalmodels.V1MachineAllocation{
+						Created: &created,
+						Image:   &metalmodels.V1ImageResponse{ID: pointer.StringPtr("firewall-ubuntu-2.0")},
+						Networks: []*metalmodels.V1MachineNetwork{
+							{Networkid: pointer.StringPtr("internet"), Networktype: pointer.StringPtr("external"), Ips: []string{"212.34.83.1"}},
+							{Networkid: pointer.StringPtr("privateNetworkID"), Ips: []string{"10.0.0.1"}},
+						},
+					},
+				},
+			}, nil)
+		metalClient.EXPECT().FirewallGet(gomock.Any()).Return(
+			&metalgo.FirewallGetResponse{
+				Firewall: &metalmodels.V1FirewallResponse{
+					Allocation: &metalmodels.V1MachineAllocation{
+						Succeeded: pointer.BoolPtr(true),
+					},
+				},
+			}, nil)
+	}
+	newReadyFirewallWithController := func() *api.MetalStackFirewall {
+		firewall := newFirewallWithController(expireAt)
+		firewall.Status.Ready = true
+		return firewall
+	}
+
+	DescribeTable("Adopt after move", metalStackMachineTestFunc,
+		Entry("Should wait for the watch if the cluster is paused", MetalStackFirewallTestCase{
+			Objects: []runtime.Object{
+				newCluster(true, false),
+				newMetalStackCluster(newClusterOwnerRef(), pointer.StringPtr("privateNetworkID"), false, false),
+				newMetalStackFirewall(nil, false),
+			},
+		}),
+		Entry("Should recover the credentials the firewall was provisioned with", MetalStackFirewallTestCase{
+			Objects: []runtime.Object{
+				newSecret(fmt.Sprintf(kubeconfigSecretNameTemplate, metalStackClusterName)),
+				newFirewallControllerSecret(expireAt),
+				newMetalStackCluster(nil, pointer.StringPtr("privateNetworkID"), false, false),
+				func() *api.MetalStackFirewall {
+					firewall := newMetalStackFirewall(pointer.StringPtr(nodeID), false)
+					firewall.CreationTimestamp = metav1.Now()
+					firewall.Annotations = map[string]string{
+						api.FirewallCredentialsExpireAtAnnotation: expireAt.UTC().Format(time.RFC3339),
+					}
+					return firewall
+				}(),
+			},
+			Check: func(firewall *api.MetalStackFirewall) {
+				Expect(firewall.Status.CredentialsExpireAt.Time).To(BeTemporally("==", expireAt))
+				Expect(firewall.Status.Ready).To(BeTrue())
+				Expect(conditions.IsTrue(firewall, api.FirewallControllerReadyCondition)).To(BeTrue())
+			},
+			MockFunc: func() {
+				expectFirewallMachine("Alive")
+				// The firewall-controller reported before the MetalStackFirewall was recreated.
+				statusReader.EXPECT().Read(gomock.Any(), gomock.Any(), gomock.Any()).Return("v1.0.0", &metav1.Time{Time: time.Now().Add(-time.Minute)}, nil)
+			},
+		}),
+	)
+
+	DescribeTable("Firewall status", metalStackMachineTestFunc,
+		Entry("Should read the firewall machine from metal-API", MetalStackFirewallTestCase{
+			Objects: []runtime.Object{
+				newMetalStackCluster(nil, pointer.StringPtr("privateNetworkID"), false, false),
+				newMetalStackFirewall(pointer.StringPtr(nodeID), false),
+			},
+			MockFunc: func() {
+				expectFirewallMachine(livelinessAlive)
+			},
+			Check: func(firewall *api.MetalStackFirewall) {
+				Expect(firewall.Status.Liveliness).To(Equal(livelinessAlive))
+				Expect(firewall.Status.Image).To(Equal("firewall-ubuntu-2.0"))
+				Expect(firewall.Status.AllocatedAt.Time).To(BeTemporally("==", allocatedAt.Time))
+				Expect(firewall.Status.Addresses).To(Equal([]api.FirewallAddresses{
+					{NetworkID: "internet", NetworkType: "external", IPs: []string{"212.34.83.1"}},
+					{NetworkID: "privateNetworkID", IPs: []string{"10.0.0.1"}},
+				}))
+				Expect(conditions.IsTrue(firewall, api.FirewallAllocatedCondition)).To(BeTrue())
+				Expect(conditions.IsTrue(firewall, api.MachineHealthyCondition)).To(BeTrue())
+				Expect(conditions.GetReason(firewall, api.FirewallControllerReadyCondition)).To(Equal(api.FirewallControllerNotDeployedReason))
+			},
+		}),
+		Entry("Should report dead firewall machine", MetalStackFirewallTestCase{
+			Objects: []runtime.Object{
+				newMetalStackCluster(nil, pointer.StringPtr("privateNetworkID"), false, false),
+				newMetalStackFirewall(pointer.StringPtr(nodeID), false),
+			},
+			MockFunc: func() {
+				expectFirewallMachine(livelinessDead)
+			},
+			Check: func(firewall *api.MetalStackFirewall) {
+				Expect(firewall.Status.Liveliness).To(Equal(livelinessDead))
+				Expect(conditions.GetReason(firewall, api.MachineHealthyCondition)).To(Equal(api.MachineDeadReason))
+			},
+		}),
+		Entry("Should keep the heartbeat of firewall-controller up to date", MetalStackFirewallTestCase{
+			Objects: []runtime.Object{
+				newSecret(fmt.Sprintf(kubeconfigSecretNameTemplate, metalStackClusterName)),
+				newFirewallControllerSecret(expireAt),
+				newMetalStackCluster(nil, pointer.StringPtr("privateNetworkID"), false, false),
+				newReadyFirewallWithController(),
+			},
+			MockFunc: func() {
+				expectFirewallMachine(livelinessAlive)
+				statusReader.EXPECT().Read(gomock.Any(), gomock.Any(), gomock.Any()).Return("v1.0.0", &metav1.Time{Time: time.Now()}, nil)
+			},
+			Check: func(firewall *api.MetalStackFirewall) {
+				Expect(firewall.Status.Ready).To(BeTrue())
+				Expect(firewall.Status.ControllerVersion).To(Equal("v1.0.0"))
+				Expect(conditions.IsTrue(firewall, api.FirewallControllerReadyCondition)).To(BeTrue())
+			},
+		}),
+		Entry("Should report missed heartbeat of firewall-controller", MetalStackFirewallTestCase{
+			Objects: []runtime.Object{
+				newSecret(fmt.Sprintf(kubeconfigSecretNameTemplate, metalStackClusterName)),
+				newFirewallControllerSecret(expireAt),
+				newMetalStackCluster(nil, pointer.StringPtr("privateNetworkID"), false, false),
+				newReadyFirewallWithController(),
+			},
+			MockFunc: func() {
+				expectFirewallMachine(livelinessAlive)
+				statusReader.EXPECT().Read(gomock.Any(), gomock.Any(), gomock.Any()).Return(
+					"v1.0.0", &metav1.Time{Time: time.Now().Add(-2 * firewallControllerHeartbeatTimeout)}, nil)
+			},
+			Check: func(firewall *api.MetalStackFirewall) {
+				Expect(firewall.Status.Ready).To(BeTrue())
+				Expect(conditions.GetReason(firewall, api.FirewallControllerReadyCondition)).To(Equal(api.FirewallControllerHeartbeatMissedReason))
+			},
+		}),
+	)
+
+	DescribeTable("Rotate credentials of firewall-controller", metalStackMachineTestFunc,
+		Entry("Should rotate credentials before they expire", MetalStackFirewallTestCase{
+			Objects: []runtime.Object{
+				newSecret(fmt.Sprintf(kubeconfigSecretNameTemplate, metalStackClusterName)),
+				newFirewallControllerSecret(time.Now().Add(firewallControllerCredentialsRotation / 2)),
 				newMetalStackCluster(nil, pointer.StringPtr("privateNetworkID"), false, false),
 				newMetalStackFirewall(pointer.StringPtr(nodeID), false),
 			},
@@ -129,10 +519,42 @@ var _ = Describe("Reconcile MetalStackFirewall", func() {
 							},
 						},
 					}, nil)
+				credentialsIssuer.EXPECT().Issue(gomock.Any(), gomock.Any(), gomock.Any()).Return([]byte("restricted"), expireAt, nil)
 			},
 		}),
 	)
 
+	It("Should restrict kubeconfig to the token", func() {
+		kubeconfig, err := restrictedKubeconfig([]byte(`apiVersion: v1
+kind: Config
+clusters:
+- name: test
+  cluster:
+    server: https://100.255.254.1:6443
+    certificate-authority-data: Y2E=
+users:
+- name: test-admin
+  user:
+    client-certificate-data: Y2VydA==
+    client-key-data: a2V5
+contexts:
+- name: test-admin@test
+  context:
+    cluster: test
+    user: test-admin
+current-context: test-admin@test
+`), "token")
+		Expect(err).NotTo(HaveOccurred())
+
+		cfg, err := clientcmd.Load(kubeconfig)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cfg.Clusters["test"].Server).To(Equal("https://100.255.254.1:6443"))
+		Expect(cfg.Clusters["test"].CertificateAuthorityData).To(Equal([]byte("ca")))
+		Expect(cfg.AuthInfos).To(HaveLen(1))
+		Expect(cfg.AuthInfos[firewallControllerName].Token).To(Equal("token"))
+		Expect(cfg.AuthInfos[firewallControllerName].ClientKeyData).To(BeEmpty())
+	})
+
 	DescribeTable("Delete Firewall", metalStackMachineTestFunc,
 		Entry("Should fail if ProviderID not set", MetalStackFirewallTestCase{
 			Objects: []runtime.Object{
@@ -184,4 +606,63 @@ var _ = Describe("Reconcile MetalStackFirewall", func() {
 		}),
 	)
 
+	DescribeTable("Map watched objects to firewalls",
+		func(o client.Object, watchFilterValue, firewallWatchLabel string, firewalls int) {
+			firewall := newMetalStackFirewall(nil, false)
+			if firewallWatchLabel != "" {
+				firewall.Labels[capi.WatchLabel] = firewallWatchLabel
+			}
+			r := newTestMetalFirewallReconciler(metalClient, credentialsIssuer, statusReader, []runtime.Object{firewall})
+			r.WatchFilterValue = watchFilterValue
+
+			var requests []reconcile.Request
+			switch o.(type) {
+			case *corev1.Secret:
+				requests = r.kubeconfigToFirewalls(o)
+			default:
+				requests = r.metalClusterToFirewalls(o)
+			}
+
+			Expect(requests).To(HaveLen(firewalls))
+			for _, req := range requests {
+				Expect(req.NamespacedName).To(Equal(types.NamespacedName{Namespace: namespaceName, Name: metalStackFirewallName}))
+			}
+		},
+		Entry("Should map kubeconfig Secret of the cluster",
+			newSecret(fmt.Sprintf(kubeconfigSecretNameTemplate, metalStackClusterName)), "", "", 1),
+		Entry("Should ignore other Secrets", newSecret(dataSecretName), "", "", 0),
+		Entry("Should ignore kubeconfig Secret of other clusters",
+			newSecret(fmt.Sprintf(kubeconfigSecretNameTemplate, "other")), "", "", 0),
+		Entry("Should map MetalStackCluster",
+			newMetalStackCluster(nil, pointer.StringPtr("privateNetworkID"), false, false), "", "", 1),
+		Entry("Should map kubeconfig Secret to the firewalls with the watch filter label",
+			newSecret(fmt.Sprintf(kubeconfigSecretNameTemplate, metalStackClusterName)), "tenant-a", "tenant-a", 1),
+		Entry("Should ignore the firewalls of other provider instances",
+			newSecret(fmt.Sprintf(kubeconfigSecretNameTemplate, metalStackClusterName)), "tenant-a", "tenant-b", 0),
+		Entry("Should ignore the firewalls without the watch filter label",
+			newMetalStackCluster(nil, pointer.StringPtr("privateNetworkID"), false, false), "tenant-a", "", 0),
+	)
 })
+
+func newFirewallWithController(expireAt time.Time) *api.MetalStackFirewall {
+	firewall := newMetalStackFirewall(pointer.StringPtr(nodeID), false)
+	firewall.Status.CredentialsExpireAt = &metav1.Time{Time: expireAt}
+	return firewall
+}
+
+func expectAllocatedFirewall(metalClient *mocks.MockMetalStackClient) {
+	metalClient.EXPECT().MachineGet(gomock.Any()).Return(
+		&metalgo.MachineGetResponse{
+			Machine: &metalmodels.V1MachineResponse{
+				Allocation: &metalmodels.V1MachineAllocation{},
+			},
+		}, nil)
+	metalClient.EXPECT().FirewallGet(gomock.Any()).Return(
+		&metalgo.FirewallGetResponse{
+			Firewall: &metalmodels.V1FirewallResponse{
+				Allocation: &metalmodels.V1MachineAllocation{
+					Succeeded: pointer.BoolPtr(true),
+				},
+			},
+		}, nil)
+}
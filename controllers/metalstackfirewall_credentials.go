@@ -0,0 +1,353 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+	authentication "k8s.io/api/authentication/v1"
+	core "k8s.io/api/core/v1"
+	rbac "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdv1 "k8s.io/client-go/tools/clientcmd/api/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/yaml"
+
+	api "github.com/metal-stack/cluster-api-provider-metalstack/api/v1alpha4"
+)
+
+//go:generate mockgen -destination=mocks/mock_firewallcredentialsissuer.go -package=mocks . FirewallCredentialsIssuer
+
+const (
+	// firewallControllerNamespace is the namespace of the firewall-controller in the workload cluster.
+	firewallControllerNamespace = "firewall"
+
+	firewallControllerKubeconfigSecretNameTemplate = "%s-firewall-controller-kubeconfig" // cluster_name-firewall-controller-kubeconfig
+
+	// credentialsExpireAtAnnotation holds the expiry of the credentials in a Secret in RFC 3339 format.
+	credentialsExpireAtAnnotation = "infrastructure.cluster.x-k8s.io/credentials-expire-at"
+
+	// firewallControllerCredentialsLifetime is the lifetime of the issued firewall-controller credentials.
+	firewallControllerCredentialsLifetime = 90 * 24 * time.Hour
+	// firewallControllerCredentialsRotation is the time before their expiry when the credentials are rotated.
+	firewallControllerCredentialsRotation = 30 * 24 * time.Hour
+)
+
+// FirewallCredentialsIssuer issues the credentials of the firewall-controller in the workload cluster.
+type FirewallCredentialsIssuer interface {
+	// Issue returns a kubeconfig of the firewall-controller which expires at the returned time.
+	// The admin kubeconfig of the cluster is only used to set the firewall-controller up.
+	Issue(ctx context.Context, adminKubeconfig []byte, lifetime time.Duration) (kubeconfig []byte, expireAt time.Time, err error)
+}
+
+// serviceAccountCredentialsIssuer issues a token of a ServiceAccount,
+// which is only permitted what the firewall-controller needs.
+type serviceAccountCredentialsIssuer struct{}
+
+func NewServiceAccountCredentialsIssuer() FirewallCredentialsIssuer {
+	return serviceAccountCredentialsIssuer{}
+}
+
+func (serviceAccountCredentialsIssuer) Issue(ctx context.Context, adminKubeconfig []byte, lifetime time.Duration) ([]byte, time.Time, error) {
+	restConfig, err := clientcmd.RESTConfigFromKubeConfig(adminKubeconfig)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("parse kubeconfig: %w", err)
+	}
+
+	c, err := client.New(restConfig, client.Options{})
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("init client of workload cluster: %w", err)
+	}
+
+	for _, o := range firewallControllerServiceAccount() {
+		if err := c.Create(ctx, o); err != nil && !apierrors.IsAlreadyExists(err) {
+			return nil, time.Time{}, fmt.Errorf("create %s %s: %w", o.GetObjectKind().GroupVersionKind().Kind, o.GetName(), err)
+		}
+	}
+	for _, o := range firewallControllerRBAC() {
+		if err := createOrUpdate(ctx, c, o); err != nil {
+			return nil, time.Time{}, fmt.Errorf("apply %s %s: %w", o.GetObjectKind().GroupVersionKind().Kind, o.GetName(), err)
+		}
+	}
+
+	clientset, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("init clientset of workload cluster: %w", err)
+	}
+
+	expirationSeconds := int64(lifetime.Seconds())
+	token, err := clientset.CoreV1().ServiceAccounts(firewallControllerNamespace).CreateToken(
+		ctx,
+		firewallControllerName,
+		&authentication.TokenRequest{
+			Spec: authentication.TokenRequestSpec{
+				ExpirationSeconds: &expirationSeconds,
+			},
+		},
+		metav1.CreateOptions{},
+	)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("request token: %w", err)
+	}
+
+	kubeconfig, err := restrictedKubeconfig(adminKubeconfig, token.Status.Token)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	return kubeconfig, token.Status.ExpirationTimestamp.Time, nil
+}
+
+// restrictedKubeconfig replaces the credentials of the admin kubeconfig by the token.
+func restrictedKubeconfig(adminKubeconfig []byte, token string) ([]byte, error) {
+	admin, err := clientcmd.Load(adminKubeconfig)
+	if err != nil {
+		return nil, fmt.Errorf("parse kubeconfig: %w", err)
+	}
+
+	adminContext, ok := admin.Contexts[admin.CurrentContext]
+	if !ok {
+		return nil, fmt.Errorf("No current context in kubeconfig")
+	}
+	cluster, ok := admin.Clusters[adminContext.Cluster]
+	if !ok {
+		return nil, fmt.Errorf("No cluster %s in kubeconfig", adminContext.Cluster)
+	}
+
+	cfg := clientcmdv1.Config{
+		APIVersion: "v1",
+		Kind:       "Config",
+		Clusters: []clientcmdv1.NamedCluster{{
+			Name: adminContext.Cluster,
+			Cluster: clientcmdv1.Cluster{
+				Server:                   cluster.Server,
+				TLSServerName:            cluster.TLSServerName,
+				CertificateAuthorityData: cluster.CertificateAuthorityData,
+			},
+		}},
+		AuthInfos: []clientcmdv1.NamedAuthInfo{{
+			Name:     firewallControllerName,
+			AuthInfo: clientcmdv1.AuthInfo{Token: token},
+		}},
+		Contexts: []clientcmdv1.NamedContext{{
+			Name: firewallControllerName,
+			Context: clientcmdv1.Context{
+				Cluster:   adminContext.Cluster,
+				AuthInfo:  firewallControllerName,
+				Namespace: firewallControllerNamespace,
+			},
+		}},
+		CurrentContext: firewallControllerName,
+	}
+
+	return yaml.Marshal(cfg)
+}
+
+// firewallControllerServiceAccount returns the ServiceAccount of the firewall-controller and its namespace.
+func firewallControllerServiceAccount() []client.Object {
+	return []client.Object{
+		&core.Namespace{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Namespace"},
+			ObjectMeta: metav1.ObjectMeta{Name: firewallControllerNamespace},
+		},
+		&core.ServiceAccount{
+			TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "ServiceAccount"},
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      firewallControllerName,
+				Namespace: firewallControllerNamespace,
+			},
+		},
+	}
+}
+
+// firewallControllerRBAC returns the permissions of the firewall-controller.
+// It maintains its custom resources, watches the services of the cluster
+// and reads the secrets of its namespace, e.g. the certificates of the droptailer.
+func firewallControllerRBAC() []client.Object {
+	subjects := []rbac.Subject{{
+		Kind:      rbac.ServiceAccountKind,
+		Name:      firewallControllerName,
+		Namespace: firewallControllerNamespace,
+	}}
+
+	return []client.Object{
+		&rbac.ClusterRole{
+			TypeMeta:   metav1.TypeMeta{APIVersion: rbac.SchemeGroupVersion.String(), Kind: "ClusterRole"},
+			ObjectMeta: metav1.ObjectMeta{Name: firewallControllerName},
+			Rules: []rbac.PolicyRule{
+				{
+					APIGroups: []string{"metal-stack.io"},
+					Resources: []string{"firewalls", "firewalls/status", "clusterwidenetworkpolicies", "clusterwidenetworkpolicies/status"},
+					Verbs:     []string{"get", "list", "watch", "create", "update", "patch"},
+				},
+				// Creating can't be restricted by name, the other verbs are restricted to the CRDs of firewall-controller.
+				{
+					APIGroups: []string{"apiextensions.k8s.io"},
+					Resources: []string{"customresourcedefinitions"},
+					Verbs:     []string{"create"},
+				},
+				{
+					APIGroups:     []string{"apiextensions.k8s.io"},
+					Resources:     []string{"customresourcedefinitions"},
+					ResourceNames: []string{"firewalls.metal-stack.io", "clusterwidenetworkpolicies.metal-stack.io"},
+					Verbs:         []string{"get", "list", "watch", "update", "patch"},
+				},
+				{
+					APIGroups: []string{""},
+					Resources: []string{"services", "endpoints"},
+					Verbs:     []string{"get", "list", "watch"},
+				},
+				{
+					APIGroups: []string{""},
+					Resources: []string{"events"},
+					Verbs:     []string{"create", "patch"},
+				},
+			},
+		},
+		&rbac.ClusterRoleBinding{
+			TypeMeta:   metav1.TypeMeta{APIVersion: rbac.SchemeGroupVersion.String(), Kind: "ClusterRoleBinding"},
+			ObjectMeta: metav1.ObjectMeta{Name: firewallControllerName},
+			RoleRef: rbac.RoleRef{
+				APIGroup: rbac.GroupName,
+				Kind:     "ClusterRole",
+				Name:     firewallControllerName,
+			},
+			Subjects: subjects,
+		},
+		&rbac.Role{
+			TypeMeta: metav1.TypeMeta{APIVersion: rbac.SchemeGroupVersion.String(), Kind: "Role"},
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      firewallControllerName,
+				Namespace: firewallControllerNamespace,
+			},
+			Rules: []rbac.PolicyRule{{
+				APIGroups: []string{""},
+				Resources: []string{"secrets"},
+				Verbs:     []string{"get", "list", "watch"},
+			}},
+		},
+		&rbac.RoleBinding{
+			TypeMeta: metav1.TypeMeta{APIVersion: rbac.SchemeGroupVersion.String(), Kind: "RoleBinding"},
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      firewallControllerName,
+				Namespace: firewallControllerNamespace,
+			},
+			RoleRef: rbac.RoleRef{
+				APIGroup: rbac.GroupName,
+				Kind:     "Role",
+				Name:     firewallControllerName,
+			},
+			Subjects: subjects,
+		},
+	}
+}
+
+// createOrUpdate overwrites an existing object with the desired one.
+func createOrUpdate(ctx context.Context, c client.Client, desired client.Object) error {
+	err := c.Create(ctx, desired)
+	if !apierrors.IsAlreadyExists(err) {
+		return err
+	}
+
+	existing := desired.DeepCopyObject().(client.Object)
+	if err := c.Get(ctx, client.ObjectKeyFromObject(desired), existing); err != nil {
+		return err
+	}
+	desired.SetResourceVersion(existing.GetResourceVersion())
+
+	return c.Update(ctx, desired)
+}
+
+// firewallControllerKubeconfig returns the credentials of the firewall-controller and their expiry.
+// They are issued once the kubeconfig of the cluster exists and are rotated before they expire.
+// Without the kubeconfig of the cluster no credentials are returned.
+func (r *MetalStackFirewallReconciler) firewallControllerKubeconfig(
+	ctx context.Context,
+	logger logr.Logger,
+	metalCluster *api.MetalStackCluster,
+) ([]byte, *metav1.Time, error) {
+	adminKubeconfig, err := getKubeconfig(ctx, r.Client, metalCluster)
+	if err != nil {
+		return nil, nil, fmt.Errorf("get kubeconfig: %w", err)
+	}
+	if adminKubeconfig == nil {
+		return nil, nil, nil
+	}
+
+	secret := &core.Secret{}
+	namespacedName := types.NamespacedName{
+		Namespace: metalCluster.Namespace,
+		Name:      fmt.Sprintf(firewallControllerKubeconfigSecretNameTemplate, metalCluster.Name),
+	}
+	if err := r.Client.Get(ctx, namespacedName, secret); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return nil, nil, fmt.Errorf("get credentials of firewall-controller: %w", err)
+		}
+		secret.Namespace = namespacedName.Namespace
+		secret.Name = namespacedName.Name
+	}
+
+	if expireAt := credentialsExpireAt(secret); expireAt != nil && time.Until(expireAt.Time) > firewallControllerCredentialsRotation {
+		return secret.Data["value"], expireAt, nil
+	}
+
+	logger.Info("Issuing credentials of firewall-controller")
+	kubeconfig, expireAt, err := r.CredentialsIssuer.Issue(ctx, adminKubeconfig, firewallControllerCredentialsLifetime)
+	if err != nil {
+		return nil, nil, fmt.Errorf("issue credentials of firewall-controller: %w", err)
+	}
+
+	if secret.Annotations == nil {
+		secret.Annotations = map[string]string{}
+	}
+	secret.Annotations[credentialsExpireAtAnnotation] = expireAt.UTC().Format(time.RFC3339)
+	secret.Data = map[string][]byte{"value": kubeconfig}
+	if err := controllerutil.SetControllerReference(metalCluster, secret, r.Scheme); err != nil {
+		return nil, nil, fmt.Errorf("set owner of credentials of firewall-controller: %w", err)
+	}
+
+	if secret.ResourceVersion == "" {
+		err = r.Client.Create(ctx, secret)
+	} else {
+		err = r.Client.Update(ctx, secret)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("save credentials of firewall-controller: %w", err)
+	}
+
+	return kubeconfig, credentialsExpireAt(secret), nil
+}
+
+// credentialsExpireAt returns the expiry of the credentials in the Secret, if it's known.
+func credentialsExpireAt(secret *core.Secret) *metav1.Time {
+	if _, ok := secret.Data["value"]; !ok {
+		return nil
+	}
+	expireAt, err := time.Parse(time.RFC3339, secret.Annotations[credentialsExpireAtAnnotation])
+	if err != nil {
+		return nil
+	}
+	return &metav1.Time{Time: expireAt}
+}
@@ -0,0 +1,170 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/clientcmd"
+	capi "sigs.k8s.io/cluster-api/api/v1alpha4"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	api "github.com/metal-stack/cluster-api-provider-metalstack/api/v1alpha4"
+)
+
+//go:generate mockgen -destination=mocks/mock_firewallcontrollerstatusreader.go -package=mocks . FirewallControllerStatusReader
+
+const (
+	// firewallHealthCheckInterval is the period in which the status of ready firewalls is resynced.
+	firewallHealthCheckInterval = time.Minute
+
+	// firewallControllerHeartbeatTimeout is the age of the last heartbeat after which the firewall-controller is considered unhealthy.
+	firewallControllerHeartbeatTimeout = 5 * time.Minute
+)
+
+// firewallControllerGVK is the resource the firewall-controller reports its status to.
+var firewallControllerGVK = schema.GroupVersionKind{Group: "metal-stack.io", Version: "v1", Kind: "Firewall"}
+
+// FirewallControllerStatusReader reads the status of the firewall-controller from the workload cluster.
+type FirewallControllerStatusReader interface {
+	// Read returns the version and the last heartbeat of the firewall-controller of the firewall with the hostname.
+	// The heartbeat is nil if the firewall-controller didn't report yet.
+	Read(ctx context.Context, kubeconfig []byte, hostname string) (version string, heartbeat *metav1.Time, err error)
+}
+
+type firewallResourceStatusReader struct{}
+
+func NewFirewallControllerStatusReader() FirewallControllerStatusReader {
+	return firewallResourceStatusReader{}
+}
+
+// Read reads the `Firewall` resource of the firewall-controller,
+// which is named after the hostname of the firewall in the namespace of the firewall-controller.
+func (firewallResourceStatusReader) Read(ctx context.Context, kubeconfig []byte, hostname string) (string, *metav1.Time, error) {
+	restConfig, err := clientcmd.RESTConfigFromKubeConfig(kubeconfig)
+	if err != nil {
+		return "", nil, fmt.Errorf("parse kubeconfig: %w", err)
+	}
+
+	c, err := client.New(restConfig, client.Options{})
+	if err != nil {
+		return "", nil, fmt.Errorf("init client of workload cluster: %w", err)
+	}
+
+	firewall := &unstructured.Unstructured{}
+	firewall.SetGroupVersionKind(firewallControllerGVK)
+	if err := c.Get(ctx, types.NamespacedName{Namespace: firewallControllerNamespace, Name: hostname}, firewall); err != nil {
+		if apierrors.IsNotFound(err) || meta.IsNoMatchError(err) {
+			return "", nil, nil
+		}
+		return "", nil, err
+	}
+
+	return firewallControllerStatus(firewall)
+}
+
+// firewallControllerStatus reads the version and the last run of the firewall-controller from its `Firewall` resource.
+func firewallControllerStatus(firewall *unstructured.Unstructured) (version string, heartbeat *metav1.Time, err error) {
+	lastRun, found, err := unstructured.NestedString(firewall.Object, "status", "lastRun")
+	if err != nil || !found {
+		return "", nil, err
+	}
+	t, err := time.Parse(time.RFC3339, lastRun)
+	if err != nil {
+		return "", nil, fmt.Errorf("parse last run of firewall-controller: %w", err)
+	}
+
+	version, _, err = unstructured.NestedString(firewall.Object, "status", "controllerVersion")
+	if err != nil {
+		return "", nil, err
+	}
+
+	return version, &metav1.Time{Time: t}, nil
+}
+
+// firewallControllerReported reads the status of the firewall-controller into the MetalStackFirewall.
+// It reports whether the firewall-controller reported since the firewall was created.
+// A firewall provisioned without firewall-controller doesn't wait for it.
+func (r *MetalStackFirewallReconciler) firewallControllerReported(
+	ctx context.Context,
+	logger logr.Logger,
+	firewall *api.MetalStackFirewall,
+	metalCluster *api.MetalStackCluster,
+) bool {
+	if firewall.Status.CredentialsExpireAt == nil {
+		conditions.MarkFalse(firewall, api.FirewallControllerReadyCondition, api.FirewallControllerNotDeployedReason, capi.ConditionSeverityInfo,
+			"Firewall is provisioned without firewall-controller")
+		return true
+	}
+
+	kubeconfig, err := getKubeconfig(ctx, r.Client, metalCluster)
+	if err != nil || kubeconfig == nil {
+		logger.Info(fmt.Sprintf("Failed to get kubeconfig to read status of firewall-controller: %v", err))
+		conditions.MarkUnknown(firewall, api.FirewallControllerReadyCondition, api.FirewallControllerStatusUnknownReason, "Kubeconfig of the cluster isn't available: %v", err)
+		return false
+	}
+
+	version, heartbeat, err := r.ControllerStatusReader.Read(ctx, kubeconfig, firewallHostname(firewall))
+	if err != nil {
+		logger.Info(fmt.Sprintf("Failed to read status of firewall-controller: %s", err))
+		conditions.MarkUnknown(firewall, api.FirewallControllerReadyCondition, api.FirewallControllerStatusUnknownReason, "%v", err)
+		return false
+	}
+	if heartbeat == nil {
+		logger.Info("Waiting for firewall-controller to report")
+		conditions.MarkFalse(firewall, api.FirewallControllerReadyCondition, api.FirewallControllerNotReportedReason, capi.ConditionSeverityWarning,
+			"Waiting for firewall-controller to report")
+		return false
+	}
+
+	firewall.Status.ControllerVersion = version
+	firewall.Status.ControllerHeartbeat = heartbeat
+
+	// The MetalStackFirewall may be recreated by `clusterctl move` long after the firewall was provisioned.
+	provisionedAt := firewall.CreationTimestamp
+	if firewall.Status.AllocatedAt != nil {
+		provisionedAt = *firewall.Status.AllocatedAt
+	}
+	if !heartbeat.After(provisionedAt.Time) {
+		conditions.MarkFalse(firewall, api.FirewallControllerReadyCondition, api.FirewallControllerNotReportedReason, capi.ConditionSeverityWarning,
+			"Waiting for firewall-controller to report")
+		return false
+	}
+
+	if since := time.Since(heartbeat.Time); since > firewallControllerHeartbeatTimeout {
+		conditions.MarkFalse(firewall, api.FirewallControllerReadyCondition, api.FirewallControllerHeartbeatMissedReason, capi.ConditionSeverityWarning,
+			"Last heartbeat of firewall-controller was %s ago", since.Truncate(time.Second))
+	} else {
+		conditions.MarkTrue(firewall, api.FirewallControllerReadyCondition)
+	}
+
+	return true
+}
+
+func firewallHostname(firewall *api.MetalStackFirewall) string {
+	return firewall.Name + "-firewall"
+}
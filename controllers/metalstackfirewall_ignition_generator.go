@@ -1,20 +1,71 @@
 package controllers
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"strings"
 
 	"github.com/coreos/container-linux-config-transpiler/config/types"
+	core "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/utils/pointer"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	api "github.com/metal-stack/cluster-api-provider-metalstack/api/v1alpha4"
 )
 
 const (
 	firewallControllerName = "firewall-controller"
+
+	// firewallControllerReleaseURLTemplate is the download URL of a release of firewall-controller.
+	firewallControllerReleaseURLTemplate = "https://github.com/metal-stack/firewall-controller/releases/download/%s/firewall-controller"
+	firewallControllerBinary             = "/usr/local/bin/firewall-controller"
+
+	defaultFirewallFileMode = 0644
+	defaultSyslogPort       = 514
 )
 
-func generateFirewallIgnitionConfig(kubeconfig []byte) (string, error) {
+// generateFirewallIgnitionConfig transpiles the settings of the firewall spec into the ignition of the firewall.
+// The kubeconfig enables the firewall-controller. Without a kubeconfig the firewall only routes the traffic of the cluster.
+// The contents of the files of the spec are passed by path.
+func generateFirewallIgnitionConfig(spec *api.MetalStackFirewallSpec, kubeconfig []byte, files map[string][]byte) (string, error) {
 	cfg := types.Config{}
 
-	cfg.Systemd = types.Systemd{}
+	if kubeconfig != nil {
+		if err := addFirewallController(&cfg, spec.FirewallController, kubeconfig); err != nil {
+			return "", err
+		}
+	}
+	addDNSServers(&cfg, spec.DNSServers)
+	addNTPServers(&cfg, spec.NTPServers)
+	addSyslog(&cfg, spec.Syslog)
+	for _, f := range spec.Files {
+		mode := defaultFirewallFileMode
+		if f.Mode != nil {
+			mode = int(*f.Mode)
+		}
+		addFile(&cfg, f.Path, mode, types.FileContents{Inline: string(files[f.Path])})
+	}
+	for _, u := range spec.SystemdUnits {
+		addSystemdUnit(&cfg, u)
+	}
+
+	outCfg, report := types.Convert(cfg, "", nil)
+	if report.IsFatal() {
+		return "", fmt.Errorf("Could not transpile ignition config: %s", report.String())
+	}
+
+	userData, err := json.Marshal(outCfg)
+	if err != nil {
+		return "", err
+	}
+
+	return string(userData), nil
+}
+
+// addFirewallController enables the firewall-controller. A downloaded binary must be verified by its checksum.
+func addFirewallController(cfg *types.Config, controller *api.FirewallControllerSpec, kubeconfig []byte) error {
 	enabled := true
 	fcUnit := types.SystemdUnit{
 		Name:    fmt.Sprintf("%s.service", firewallControllerName),
@@ -23,11 +74,99 @@ func generateFirewallIgnitionConfig(kubeconfig []byte) (string, error) {
 	}
 	cfg.Systemd.Units = append(cfg.Systemd.Units, fcUnit)
 
-	cfg.Storage = types.Storage{}
-	mode := 0600
+	addFile(cfg, "/etc/firewall-controller/.kubeconfig", 0600, types.FileContents{
+		Inline: string(kubeconfig),
+	})
+
+	if url := firewallControllerURL(controller); url != "" {
+		if controller.SHA512 == "" {
+			return fmt.Errorf("firewall-controller from %s has no SHA512 checksum", url)
+		}
+		addFile(cfg, firewallControllerBinary, 0755, types.FileContents{
+			Remote: types.Remote{
+				Url:          url,
+				Verification: types.Verification{Hash: types.Hash{Function: "sha512", Sum: controller.SHA512}},
+			},
+		})
+	}
+	return nil
+}
+
+// firewallControllerURL returns the download URL of the firewall-controller.
+// It's empty if the binary shipped with the image is used.
+func firewallControllerURL(controller *api.FirewallControllerSpec) string {
+	switch {
+	case controller == nil:
+		return ""
+	case controller.URL != "":
+		return controller.URL
+	case controller.Version != "":
+		return fmt.Sprintf(firewallControllerReleaseURLTemplate, controller.Version)
+	}
+	return ""
+}
+
+// addDNSServers configures systemd-resolved to resolve names with the DNS servers.
+func addDNSServers(cfg *types.Config, servers []string) {
+	if len(servers) == 0 {
+		return
+	}
+	addFile(cfg, "/etc/systemd/resolved.conf.d/dns.conf", defaultFirewallFileMode, types.FileContents{
+		Inline: fmt.Sprintf("[Resolve]\nDNS=%s\n", strings.Join(servers, " ")),
+	})
+}
+
+// addNTPServers configures systemd-timesyncd to synchronize the clock with the NTP servers.
+func addNTPServers(cfg *types.Config, servers []string) {
+	if len(servers) == 0 {
+		return
+	}
+	addFile(cfg, "/etc/systemd/timesyncd.conf.d/ntp.conf", defaultFirewallFileMode, types.FileContents{
+		Inline: fmt.Sprintf("[Time]\nNTP=%s\n", strings.Join(servers, " ")),
+	})
+}
+
+// addSyslog configures rsyslog to forward all logs to the syslog server.
+func addSyslog(cfg *types.Config, syslog *api.FirewallSyslog) {
+	if syslog == nil {
+		return
+	}
+
+	port := int32(defaultSyslogPort)
+	if syslog.Port != nil {
+		port = *syslog.Port
+	}
+	// rsyslog forwards via UDP with a single @ and via TCP with @@.
+	target := "@"
+	if syslog.Protocol == "tcp" {
+		target = "@@"
+	}
+
+	addFile(cfg, "/etc/rsyslog.d/99-remote.conf", defaultFirewallFileMode, types.FileContents{
+		Inline: fmt.Sprintf("*.* %s%s:%d\n", target, syslog.Server, port),
+	})
+}
+
+func addSystemdUnit(cfg *types.Config, u api.FirewallSystemdUnit) {
+	unit := types.SystemdUnit{
+		Name:     u.Name,
+		Enabled:  u.Enabled,
+		Contents: u.Contents,
+	}
+	if unit.Enabled == nil && u.Contents != "" {
+		unit.Enabled = pointer.BoolPtr(true)
+	}
+	for _, d := range u.Dropins {
+		unit.Dropins = append(unit.Dropins, types.SystemdUnitDropIn{Name: d.Name, Contents: d.Contents})
+	}
+	cfg.Systemd.Units = append(cfg.Systemd.Units, unit)
+}
+
+// addFile adds a file owned by root.
+func addFile(cfg *types.Config, path string, mode int, contents types.FileContents) {
 	id := 0
-	ignitionFile := types.File{
-		Path:       "/etc/firewall-controller/.kubeconfig",
+	cfg.Storage.Files = append(cfg.Storage.Files, types.File{
+		Path:       path,
 		Filesystem: "root",
 		Mode:       &mode,
 		User: &types.FileUser{
@@ -36,21 +175,64 @@ func generateFirewallIgnitionConfig(kubeconfig []byte) (string, error) {
 		Group: &types.FileGroup{
 			Id: &id,
 		},
-		Contents: types.FileContents{
-			Inline: string(kubeconfig),
-		},
-	}
-	cfg.Storage.Files = append(cfg.Storage.Files, ignitionFile)
+		Contents: contents,
+	})
+}
 
-	outCfg, report := types.Convert(cfg, "", nil)
-	if report.IsFatal() {
-		return "", fmt.Errorf("Could not transpile ignition config: %s", report.String())
+// firewallFiles reads the contents of the files of the firewall from their Secrets and ConfigMaps.
+// A file whose optional source doesn't exist is empty.
+func (r *MetalStackFirewallReconciler) firewallFiles(ctx context.Context, firewall *api.MetalStackFirewall) (map[string][]byte, error) {
+	files := make(map[string][]byte, len(firewall.Spec.Files))
+	for _, f := range firewall.Spec.Files {
+		contents, err := r.firewallFileContents(ctx, firewall.Namespace, f.ContentFrom)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read contents of file %s: %w", f.Path, err)
+		}
+		files[f.Path] = contents
 	}
+	return files, nil
+}
 
-	userData, err := json.Marshal(outCfg)
-	if err != nil {
-		return "", err
+func (r *MetalStackFirewallReconciler) firewallFileContents(ctx context.Context, namespace string, source api.FirewallFileSource) ([]byte, error) {
+	switch {
+	case source.Secret != nil && source.ConfigMap != nil:
+		return nil, fmt.Errorf("only one of secret and configMap may be set")
+
+	case source.Secret != nil:
+		ref := source.Secret
+		optional := ref.Optional != nil && *ref.Optional
+		secret := &core.Secret{}
+		if err := r.Client.Get(ctx, client.ObjectKey{Namespace: namespace, Name: ref.Name}, secret); err != nil {
+			if apierrors.IsNotFound(err) && optional {
+				return nil, nil
+			}
+			return nil, err
+		}
+		contents, ok := secret.Data[ref.Key]
+		if !ok && !optional {
+			return nil, fmt.Errorf("key %s not found in secret %s", ref.Key, ref.Name)
+		}
+		return contents, nil
+
+	case source.ConfigMap != nil:
+		ref := source.ConfigMap
+		optional := ref.Optional != nil && *ref.Optional
+		configMap := &core.ConfigMap{}
+		if err := r.Client.Get(ctx, client.ObjectKey{Namespace: namespace, Name: ref.Name}, configMap); err != nil {
+			if apierrors.IsNotFound(err) && optional {
+				return nil, nil
+			}
+			return nil, err
+		}
+		if contents, ok := configMap.BinaryData[ref.Key]; ok {
+			return contents, nil
+		}
+		contents, ok := configMap.Data[ref.Key]
+		if !ok && !optional {
+			return nil, fmt.Errorf("key %s not found in config map %s", ref.Key, ref.Name)
+		}
+		return []byte(contents), nil
 	}
 
-	return string(userData), nil
+	return nil, fmt.Errorf("neither secret nor configMap is set")
 }
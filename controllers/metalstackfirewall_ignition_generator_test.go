@@ -0,0 +1,193 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/utils/pointer"
+
+	api "github.com/metal-stack/cluster-api-provider-metalstack/api/v1alpha4"
+)
+
+// updateGolden rewrites the golden files with the generated ignition instead of comparing them.
+var updateGolden = flag.Bool("update-golden", false, "update the golden files of the tests")
+
+var _ = Describe("Firewall ignition", func() {
+
+	type IgnitionTestCase struct {
+		Golden     string
+		Spec       api.MetalStackFirewallSpec
+		Kubeconfig []byte
+		Files      map[string][]byte
+		Error      bool
+	}
+
+	DescribeTable("Generate ignition",
+		func(tc IgnitionTestCase) {
+			userData, err := generateFirewallIgnitionConfig(&tc.Spec, tc.Kubeconfig, tc.Files)
+			if tc.Error {
+				Expect(err).To(HaveOccurred())
+				return
+			}
+			Expect(err).NotTo(HaveOccurred())
+
+			var got bytes.Buffer
+			Expect(json.Indent(&got, []byte(userData), "", "  ")).To(Succeed())
+			got.WriteString("\n")
+
+			golden := filepath.Join("testdata", "ignition", tc.Golden)
+			if *updateGolden {
+				Expect(ioutil.WriteFile(golden, got.Bytes(), 0644)).To(Succeed())
+			}
+			want, err := ioutil.ReadFile(golden)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(got.String()).To(Equal(string(want)))
+		},
+		Entry("Should only route without kubeconfig", IgnitionTestCase{
+			Golden: "routing.json",
+		}),
+		Entry("Should enable firewall-controller with kubeconfig", IgnitionTestCase{
+			Golden:     "firewall-controller.json",
+			Kubeconfig: []byte("kubeconfig"),
+		}),
+		Entry("Should download firewall-controller of the version", IgnitionTestCase{
+			Golden: "firewall-controller-version.json",
+			Spec: api.MetalStackFirewallSpec{
+				FirewallController: &api.FirewallControllerSpec{
+					Version: "v1.0.10",
+					SHA512:  "cf83e1357eefb8bdf1542850d66d8007d620e4050b5715dc83f4a921d36ce9ce47d0d13c5d85f2b0ff8318d2877eec2f63b931bd47417a81a538327af927da3e",
+				},
+			},
+			Kubeconfig: []byte("kubeconfig"),
+		}),
+		Entry("Should refuse to download firewall-controller without checksum", IgnitionTestCase{
+			Spec: api.MetalStackFirewallSpec{
+				FirewallController: &api.FirewallControllerSpec{Version: "v1.0.10"},
+			},
+			Kubeconfig: []byte("kubeconfig"),
+			Error:      true,
+		}),
+		Entry("Should download firewall-controller from the URL", IgnitionTestCase{
+			Golden: "firewall-controller-url.json",
+			Spec: api.MetalStackFirewallSpec{
+				FirewallController: &api.FirewallControllerSpec{
+					Version: "v1.0.10",
+					URL:     "https://example.com/firewall-controller",
+					SHA512:  "cf83e1357eefb8bdf1542850d66d8007d620e4050b5715dc83f4a921d36ce9ce47d0d13c5d85f2b0ff8318d2877eec2f63b931bd47417a81a538327af927da3e",
+				},
+			},
+			Kubeconfig: []byte("kubeconfig"),
+		}),
+		Entry("Should add files, systemd units, DNS, NTP and syslog", IgnitionTestCase{
+			Golden: "site.json",
+			Spec: api.MetalStackFirewallSpec{
+				Files: []api.FirewallFile{
+					{Path: "/etc/motd"},
+					{Path: "/etc/ssl/certs/site-ca.pem", Mode: pointer.Int32Ptr(0600)},
+				},
+				SystemdUnits: []api.FirewallSystemdUnit{
+					{
+						Name:     "node-exporter.service",
+						Contents: "[Service]\nExecStart=/usr/local/bin/node_exporter\n",
+					},
+					{
+						Name:    "droptailer.service",
+						Enabled: pointer.BoolPtr(false),
+						Dropins: []api.FirewallSystemdDropin{{Name: "proxy.conf", Contents: "[Service]\nEnvironment=HTTPS_PROXY=http://proxy:3128\n"}},
+					},
+				},
+				DNSServers: []string{"10.0.0.53", "10.0.1.53"},
+				NTPServers: []string{"ntp.example.com"},
+				Syslog:     &api.FirewallSyslog{Server: "syslog.example.com", Protocol: "tcp"},
+			},
+			Files: map[string][]byte{
+				"/etc/motd":                  []byte("Welcome"),
+				"/etc/ssl/certs/site-ca.pem": []byte("-----BEGIN CERTIFICATE-----"),
+			},
+		}),
+	)
+
+	type FileContentsTestCase struct {
+		Objects  []runtime.Object
+		Source   api.FirewallFileSource
+		Contents []byte
+		Error    bool
+	}
+
+	DescribeTable("Read file contents",
+		func(tc FileContentsTestCase) {
+			r := newTestMetalFirewallReconciler(nil, nil, nil, tc.Objects)
+			contents, err := r.firewallFileContents(context.TODO(), namespaceName, tc.Source)
+			if tc.Error {
+				Expect(err).To(HaveOccurred())
+				return
+			}
+			Expect(err).NotTo(HaveOccurred())
+			Expect(contents).To(Equal(tc.Contents))
+		},
+		Entry("Should read key of Secret", FileContentsTestCase{
+			Objects: []runtime.Object{newSecret("site")},
+			Source: api.FirewallFileSource{Secret: &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: "site"}, Key: "value",
+			}},
+			Contents: []byte(""),
+		}),
+		Entry("Should read key of ConfigMap", FileContentsTestCase{
+			Objects: []runtime.Object{&corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Namespace: namespaceName, Name: "site"},
+				Data:       map[string]string{"motd": "Welcome"},
+			}},
+			Source: api.FirewallFileSource{ConfigMap: &corev1.ConfigMapKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: "site"}, Key: "motd",
+			}},
+			Contents: []byte("Welcome"),
+		}),
+		Entry("Should fail if Secret doesn't exist", FileContentsTestCase{
+			Source: api.FirewallFileSource{Secret: &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: "site"}, Key: "value",
+			}},
+			Error: true,
+		}),
+		Entry("Should be empty if optional Secret doesn't exist", FileContentsTestCase{
+			Source: api.FirewallFileSource{Secret: &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: "site"}, Key: "value", Optional: pointer.BoolPtr(true),
+			}},
+		}),
+		Entry("Should fail if key doesn't exist", FileContentsTestCase{
+			Objects: []runtime.Object{newSecret("site")},
+			Source: api.FirewallFileSource{Secret: &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: "site"}, Key: "other",
+			}},
+			Error: true,
+		}),
+		Entry("Should fail if no source is set", FileContentsTestCase{
+			Error: true,
+		}),
+	)
+})
@@ -0,0 +1,107 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	metalgo "github.com/metal-stack/metal-go"
+	capi "sigs.k8s.io/cluster-api/api/v1alpha4"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	api "github.com/metal-stack/cluster-api-provider-metalstack/api/v1alpha4"
+)
+
+// placeFirewall selects a free machine for the firewall in a rack where no firewall of another replica runs,
+// so that the failure of a single rack doesn't take down all firewalls of the cluster.
+// It's empty if no other replica is deployed yet, leaving the choice of the machine to metal-API.
+func (r *MetalStackFirewallReconciler) placeFirewall(
+	ctx context.Context,
+	firewall *api.MetalStackFirewall,
+	metalCluster *api.MetalStackCluster,
+) (string, error) {
+	racks, err := r.firewallRacks(ctx, firewall, metalCluster)
+	if err != nil {
+		return "", err
+	}
+	if len(racks) == 0 {
+		return "", nil
+	}
+
+	resp, err := r.MetalStackClient.MachineFind(&metalgo.MachineFindRequest{
+		PartitionID: &metalCluster.Spec.Partition,
+		SizeID:      &firewall.Spec.MachineType,
+	})
+	if err != nil {
+		return "", fmt.Errorf("error finding machines: %w", err)
+	}
+
+	var candidates []string
+	for _, m := range resp.Machines {
+		if isFreeMachine(m) && !racks[m.Rackid] {
+			candidates = append(candidates, *m.ID)
+		}
+	}
+	if len(candidates) == 0 {
+		return "", fmt.Errorf("no free machine of size %s in partition %s in a rack without firewall", firewall.Spec.MachineType, metalCluster.Spec.Partition)
+	}
+	sort.Strings(candidates)
+
+	return candidates[0], nil
+}
+
+// firewallRacks returns the racks of the deployed firewalls of the other replicas of the cluster.
+// The firewalls replacing or being replaced by the firewall of the same replica may share its rack.
+func (r *MetalStackFirewallReconciler) firewallRacks(
+	ctx context.Context,
+	firewall *api.MetalStackFirewall,
+	metalCluster *api.MetalStackCluster,
+) (map[string]bool, error) {
+	firewalls := &api.MetalStackFirewallList{}
+	if err := r.Client.List(
+		ctx,
+		firewalls,
+		client.InNamespace(metalCluster.Namespace),
+		client.MatchingLabels{capi.ClusterLabelName: metalCluster.Name},
+	); err != nil {
+		return nil, fmt.Errorf("failed to list firewalls: %w", err)
+	}
+
+	racks := make(map[string]bool)
+	for i := range firewalls.Items {
+		other := &firewalls.Items[i]
+		if other.Name == firewall.Name || other.GetReplica() == firewall.GetReplica() {
+			continue
+		}
+
+		pid, err := other.Spec.ParsedProviderID()
+		if err != nil {
+			continue
+		}
+		resp, err := r.MetalStackClient.MachineGet(pid)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get machine of firewall %s: %w", other.Name, err)
+		}
+		if resp.Machine != nil && resp.Machine.Rackid != "" {
+			racks[resp.Machine.Rackid] = true
+		}
+	}
+
+	return racks, nil
+}
@@ -0,0 +1,71 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"time"
+
+	"github.com/metal-stack/metal-go/api/models"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	capi "sigs.k8s.io/cluster-api/api/v1alpha4"
+	"sigs.k8s.io/cluster-api/util/conditions"
+
+	api "github.com/metal-stack/cluster-api-provider-metalstack/api/v1alpha4"
+)
+
+// setFirewallMachineStatus reads addresses, liveliness, allocation and health of the firewall machine into the status.
+func setFirewallMachineStatus(firewall *api.MetalStackFirewall, machine *models.V1MachineResponse) {
+	firewall.Status.Liveliness = ""
+	if machine.Liveliness != nil {
+		firewall.Status.Liveliness = *machine.Liveliness
+	}
+
+	if reason, terminal := machineUnhealthyReason(machine); reason == "" {
+		conditions.MarkTrue(firewall, api.MachineHealthyCondition)
+	} else if terminal {
+		conditions.MarkFalse(firewall, api.MachineHealthyCondition, reason, capi.ConditionSeverityError, "Firewall machine is unhealthy: %s", reason)
+	} else {
+		conditions.MarkFalse(firewall, api.MachineHealthyCondition, reason, capi.ConditionSeverityWarning, "Liveliness of firewall machine is unknown")
+	}
+
+	allocation := machine.Allocation
+	if allocation == nil {
+		return
+	}
+
+	if allocation.Created != nil {
+		firewall.Status.AllocatedAt = &metav1.Time{Time: time.Time(*allocation.Created)}
+	}
+	if allocation.Image != nil && allocation.Image.ID != nil {
+		firewall.Status.Image = *allocation.Image.ID
+	}
+
+	firewall.Status.Addresses = nil
+	for _, n := range allocation.Networks {
+		if n == nil || n.Networkid == nil {
+			continue
+		}
+		addresses := api.FirewallAddresses{
+			NetworkID: *n.Networkid,
+			IPs:       n.Ips,
+		}
+		if n.Networktype != nil {
+			addresses.NetworkType = *n.Networktype
+		}
+		firewall.Status.Addresses = append(firewall.Status.Addresses, addresses)
+	}
+}
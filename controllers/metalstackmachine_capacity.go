@@ -0,0 +1,97 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	capiv1 "sigs.k8s.io/cluster-api/api/v1alpha4"
+	"sigs.k8s.io/cluster-api/util/conditions"
+
+	api "github.com/metal-stack/cluster-api-provider-metalstack/api/v1alpha4"
+)
+
+// capacityCheckInterval is the period in which a machine waiting for a free machine of its size checks the capacity again.
+const capacityCheckInterval = time.Minute
+
+// checkCapacity checks if the partition has a free machine of the size before allocating one.
+// A machine without free capacity keeps waiting instead of failing.
+func (r *MetalStackMachineReconciler) checkCapacity(resources *metalStackMachineResources) (ok bool, err error) {
+	partition := resources.metalCluster.Spec.Partition
+	size := resources.metalMachine.Spec.MachineType
+
+	capacity, err := partitionCapacity(r.MetalStackClient, partition)
+	if err != nil {
+		conditions.MarkUnknown(resources.metalMachine, api.MachineCapacityAvailableCondition, api.CapacityCheckFailedReason, "%v", err)
+		return false, err
+	}
+
+	if freeMachines(capacity, size) == 0 {
+		msg := fmt.Sprintf("No free machine of size %s in partition %s", size, partition)
+		resources.logger.Info(msg)
+		conditions.MarkFalse(resources.metalMachine, api.MachineCapacityAvailableCondition, api.InsufficientCapacityReason, capiv1.ConditionSeverityWarning, "%s", msg)
+		return false, nil
+	}
+
+	conditions.MarkTrue(resources.metalMachine, api.MachineCapacityAvailableCondition)
+	return true, nil
+}
+
+// partitionCapacity reads the capacity of the sizes in the partition from `metal-API`.
+func partitionCapacity(metalClient MetalStackClient, partition string) ([]api.SizeCapacity, error) {
+	resp, err := metalClient.PartitionCapacity()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get partition capacity: %w", err)
+	}
+
+	var capacity []api.SizeCapacity
+	for _, pc := range resp.Capacity {
+		if pc == nil || pc.ID == nil || *pc.ID != partition {
+			continue
+		}
+
+		for _, sc := range pc.Servers {
+			if sc == nil || sc.Size == nil {
+				continue
+			}
+
+			c := api.SizeCapacity{Size: *sc.Size}
+			if sc.Free != nil {
+				c.Free = *sc.Free
+			}
+			if sc.Total != nil {
+				c.Total = *sc.Total
+			}
+			capacity = append(capacity, c)
+		}
+	}
+	sort.Slice(capacity, func(i, j int) bool { return capacity[i].Size < capacity[j].Size })
+
+	return capacity, nil
+}
+
+// freeMachines returns the number of free machines of the size.
+func freeMachines(capacity []api.SizeCapacity, size string) int32 {
+	for _, c := range capacity {
+		if c.Size == size {
+			return c.Free
+		}
+	}
+	return 0
+}
@@ -32,7 +32,9 @@ import (
 	"sigs.k8s.io/cluster-api/util"
 	"sigs.k8s.io/cluster-api/util/annotations"
 	"sigs.k8s.io/cluster-api/util/patch"
+	"sigs.k8s.io/cluster-api/util/predicates"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
@@ -42,12 +44,18 @@ import (
 	api "github.com/metal-stack/cluster-api-provider-metalstack/api/v1alpha4"
 )
 
+// nodeReadyInterval is the period in which the Node of a machine is checked until it's ready for the provider ID.
+const nodeReadyInterval = 15 * time.Second
+
 // MetalStackMachineReconciler reconciles a MetalStackMachine object
 type MetalStackMachineReconciler struct {
 	Client           client.Client
 	Log              logr.Logger
 	ClusterTracker   *capiremote.ClusterCacheTracker
 	MetalStackClient MetalStackClient
+
+	// WatchFilterValue restricts the reconciled objects to those with the watch-filter label of this value, if set.
+	WatchFilterValue string
 }
 
 // todo: Remove the dependency on manager in this package.
@@ -76,23 +84,55 @@ func NewMetalStackMachineReconciler(metalClient MetalStackClient, mgr manager.Ma
 // +kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch
 
 func (r *MetalStackMachineReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	clusterToMetalMachines, err := util.ClusterToObjectsMapper(mgr.GetClient(), &api.MetalStackMachineList{}, mgr.GetScheme())
+	if err != nil {
+		return err
+	}
+
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&api.MetalStackMachine{}).
+		For(&api.MetalStackMachine{}, builder.WithPredicates(predicates.ResourceHasFilterLabel(r.Log, r.WatchFilterValue))).
+		WithEventFilter(predicates.ResourceNotPaused(r.Log)).
 		Watches(
 			&source.Kind{Type: &capiv1.Machine{}},
 			handler.EnqueueRequestsFromMapFunc(
 				util.MachineToInfrastructureMapFunc(api.GroupVersion.WithKind("MetalStackMachine")),
 			),
+			builder.WithPredicates(predicates.ResourceHasFilterLabel(r.Log, r.WatchFilterValue)),
 		).
+		// The paused machines and the machines waiting for the infrastructure of the cluster aren't requeued,
+		// so they're reconciled again once the cluster is unpaused and its infrastructure is ready.
+		Watches(
+			&source.Kind{Type: &capiv1.Cluster{}},
+			handler.EnqueueRequestsFromMapFunc(clusterToMetalMachines),
+			builder.WithPredicates(
+				predicates.ClusterUnpausedAndInfrastructureReady(r.Log),
+				predicates.ResourceHasFilterLabel(r.Log, r.WatchFilterValue),
+			),
+		).
+		WithOptions(controllerOptions()).
 		Complete(r)
 }
 
+// withPinnedMetalStackClient returns a copy of the reconciler which sends all requests to the current metal-API client.
+func (r *MetalStackMachineReconciler) withPinnedMetalStackClient() *MetalStackMachineReconciler {
+	pinned := *r
+	pinned.MetalStackClient = pinMetalStackClient(r.MetalStackClient)
+	return &pinned
+}
+
 // Reconcile reconciles MetalStackMachine resource
 func (r *MetalStackMachineReconciler) Reconcile(ctx context.Context, req ctrl.Request) (_ ctrl.Result, err error) {
+	r = r.withPinnedMetalStackClient()
+
 	logger := r.Log.WithValues("MetalStackMachine", req.NamespacedName)
 
 	logger.Info("Starting MetalStackMachine reconcilation")
 
+	if res, ok := requeueWhileCircuitOpen(r.MetalStackClient); ok {
+		logger.Info(fmt.Sprintf("metal-API is unavailable, requeueing after %s", res.RequeueAfter))
+		return res, nil
+	}
+
 	resources, err := newMetalStackMachineResources(ctx, logger, r.Client, req.NamespacedName)
 	if err != nil {
 		return ctrl.Result{}, err
@@ -109,7 +149,11 @@ func (r *MetalStackMachineReconciler) Reconcile(ctx context.Context, req ctrl.Re
 
 	if annotations.IsPaused(resources.cluster, resources.metalMachine) {
 		resources.logger.Info("Cluster or MetalStackMachine is paused")
-		return ctrl.Result{Requeue: true}, nil
+		return ctrl.Result{}, nil
+	}
+
+	if err := prefetchClusterMachines(r.MetalStackClient, resources.metalCluster); err != nil {
+		logger.Info(fmt.Sprintf("Failed to prefetch the machines of the cluster: %s", err))
 	}
 
 	// Persist any change to MetalStackMachine
@@ -169,15 +213,44 @@ func (r *MetalStackMachineReconciler) reconcileDelete(ctx context.Context, resou
 func (r *MetalStackMachineReconciler) reconcile(ctx context.Context, resources *metalStackMachineResources) (ctrl.Result, error) {
 	controllerutil.AddFinalizer(resources.metalMachine, api.MetalStackMachineFinalizer)
 
+	if action, ok := resources.metalMachine.RemediationRequested(); ok {
+		res, err := r.reconcileRemediation(resources, action)
+		if err == nil {
+			delete(resources.metalMachine.Annotations, api.RemediationAnnotation)
+		}
+		return res, err
+	}
+
+	if resources.metalMachine.Status.Ready {
+		return r.reconcileHealth(resources)
+	}
+
+	// The infrastructure of the cluster is ready only with the Control Plane IP, and the watch of the cluster reconciles the machine then.
 	if !resources.metalCluster.Status.ControlPlaneIPAllocated {
-		return ctrl.Result{
-			Requeue: true,
-		}, nil
+		resources.logger.Info("Waiting for the Control Plane IP")
+		return ctrl.Result{}, nil
 	}
 
-	if err := r.createRawMachineIfNotExists(ctx, resources); err != nil {
+	adopted, err := r.adoptAllocatedMachine(resources)
+	if err != nil {
 		return ctrl.Result{}, err
 	}
+	if !adopted {
+		// A machine pinned by its provider ID doesn't depend on the free capacity of its size.
+		if resources.metalMachine.Spec.ProviderID == nil {
+			ok, err := r.checkCapacity(resources)
+			if err != nil {
+				return ctrl.Result{}, err
+			}
+			if !ok {
+				return ctrl.Result{RequeueAfter: capacityCheckInterval}, nil
+			}
+		}
+
+		if err := r.createRawMachineIfNotExists(ctx, resources); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
 
 	ok, err := r.setNodeProviderID(ctx, resources)
 	if err != nil {
@@ -185,11 +258,37 @@ func (r *MetalStackMachineReconciler) reconcile(ctx context.Context, resources *
 	}
 	if !ok {
 		resources.logger.Info("Node not ready yet")
-		return ctrl.Result{Requeue: true, RequeueAfter: 15 * time.Second}, nil
+		return ctrl.Result{RequeueAfter: nodeReadyInterval}, nil
 	}
 
 	resources.metalMachine.Status.Ready = true
-	return ctrl.Result{}, nil
+	observeProvisioning(provisionedMachine, resources.metalCluster, resources.metalMachine.CreationTimestamp)
+
+	return ctrl.Result{RequeueAfter: machineHealthCheckInterval}, nil
+}
+
+// adoptAllocatedMachine sets the provider ID of a MetalStackMachine whose machine was allocated, but which lost its provider ID,
+// e.g. since it wasn't updated anymore or was moved without it. Such a machine doesn't depend on the free capacity of its size.
+func (r *MetalStackMachineReconciler) adoptAllocatedMachine(resources *metalStackMachineResources) (bool, error) {
+	if resources.metalMachine.Spec.ProviderID != nil {
+		return false, nil
+	}
+
+	found, err := r.MetalStackClient.MachineFind(&metalgo.MachineFindRequest{
+		AllocationName:    &resources.metalMachine.Name,
+		AllocationProject: &resources.metalCluster.Spec.ProjectID,
+		Tags:              []string{resources.metalCluster.GetClusterIDTag()},
+	})
+	if err != nil {
+		return false, fmt.Errorf("error finding machines: %w", err)
+	}
+	if len(found.Machines) != 1 || found.Machines[0].Allocation == nil {
+		return false, nil
+	}
+
+	resources.logger.Info(fmt.Sprintf("Machine %s is already allocated, adopting it", *found.Machines[0].ID))
+	resources.setProviderID(found.Machines[0])
+	return true, nil
 }
 
 func (r *MetalStackMachineReconciler) createRawMachineIfNotExists(ctx context.Context, resources *metalStackMachineResources) error {
@@ -213,6 +312,12 @@ func (r *MetalStackMachineReconciler) createRawMachineIfNotExists(ctx context.Co
 
 	resp, err := r.MetalStackClient.MachineCreate(req)
 	if err != nil {
+		// Transient errors are retried with the backoff of the controller.
+		if isTransientError(err) {
+			resources.logger.Info(fmt.Sprintf("Failed to create machine, retrying: %s", err))
+			return fmt.Errorf("create machine: %w", err)
+		}
+
 		// todo: When to unset?
 		resources.metalMachine.Status.SetFailure(err.Error(), capierr.CreateMachineError)
 		return err
@@ -249,6 +354,13 @@ func (r *MetalStackMachineReconciler) newRequestToCreateMachine(ctx context.Cont
 	if pid, err := resources.metalMachine.Spec.ParsedProviderID(); err == nil {
 		resources.logger.Info(fmt.Sprintf("Deploy Node on machine: %s", pid))
 		config.UUID = pid
+	} else if resources.metalMachine.Spec.HostSelector != nil {
+		uuid, err := r.selectHost(resources)
+		if err != nil {
+			return nil, fmt.Errorf("select host: %w", err)
+		}
+		resources.logger.Info(fmt.Sprintf("Deploy Node on selected machine: %s", uuid))
+		config.UUID = uuid
 	}
 
 	if resources.isControlPlane() {
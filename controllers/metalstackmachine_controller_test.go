@@ -19,8 +19,13 @@ package controllers
 import (
 	"context"
 	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
 
 	metalgo "github.com/metal-stack/metal-go"
+	metalmachine "github.com/metal-stack/metal-go/api/client/machine"
 	metalmodels "github.com/metal-stack/metal-go/api/models"
 
 	"github.com/golang/mock/gomock"
@@ -30,23 +35,37 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/utils/pointer"
+	capierr "sigs.k8s.io/cluster-api/errors"
+	"sigs.k8s.io/cluster-api/util/conditions"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
+	api "github.com/metal-stack/cluster-api-provider-metalstack/api/v1alpha4"
 	"github.com/metal-stack/cluster-api-provider-metalstack/controllers/mocks"
 )
 
 var _ = Describe("Reconcile MetalStackMachine", func() {
 
 	type MetalStackMachineTestCase struct {
-		Objects  []runtime.Object
-		Requeue  bool
-		Error    bool
-		MockFunc func()
+		Objects []runtime.Object
+		// RequeueAfter is the expected delay of the requeue, if set.
+		RequeueAfter time.Duration
+		Error        bool
+		MockFunc     func()
+		// Check checks the reconciled MetalStackMachine, if set.
+		Check func(metalMachine *api.MetalStackMachine)
 	}
 
 	ctrl := gomock.NewController(GinkgoT())
 	metalClient := mocks.NewMockMetalStackClient(ctrl)
+	expectNoMachine := func() {
+		metalClient.EXPECT().MachineFind(gomock.Any()).Return(&metalgo.MachineListResponse{}, nil)
+	}
 	metalStackMachineTestFunc := func(tc MetalStackMachineTestCase) {
+		// Each entry gets its own mock, so that expectations don't leak into the next entry and missing calls fail.
+		ctrl := gomock.NewController(GinkgoT())
+		defer ctrl.Finish()
+		metalClient = mocks.NewMockMetalStackClient(ctrl)
+
 		r := newTestMetalMachineReconciler(metalClient, tc.Objects)
 		req := reconcile.Request{
 			NamespacedName: types.NamespacedName{
@@ -65,7 +84,17 @@ var _ = Describe("Reconcile MetalStackMachine", func() {
 		} else {
 			Expect(err).NotTo(HaveOccurred())
 		}
-		Expect(res.Requeue).To(Equal(tc.Requeue))
+		// Objects are never requeued immediately, but after an interval or with the backoff of errors.
+		Expect(res.Requeue).To(BeFalse())
+		if tc.RequeueAfter != 0 {
+			Expect(res.RequeueAfter).To(Equal(tc.RequeueAfter))
+		}
+
+		if tc.Check != nil {
+			metalMachine := &api.MetalStackMachine{}
+			Expect(r.Client.Get(context.TODO(), req.NamespacedName, metalMachine)).To(Succeed())
+			tc.Check(metalMachine)
+		}
 	}
 
 	DescribeTable("Create Machine", metalStackMachineTestFunc,
@@ -85,24 +114,128 @@ var _ = Describe("Reconcile MetalStackMachine", func() {
 				newMachine(),
 				newMetalStackMachine(newMachineOwnerRef(), nil, false)},
 		}),
-		Entry("Should requeue if Control Plane IP not allocated", MetalStackMachineTestCase{
+		Entry("Should wait for the watch if Control Plane IP not allocated", MetalStackMachineTestCase{
 			Objects: []runtime.Object{
 				newCluster(false, true),
 				newMetalStackCluster(newClusterOwnerRef(), pointer.StringPtr("privateNetworkID"), false, false),
 				newMachine(),
 				newMetalStackMachine(newMachineOwnerRef(), nil, false)},
-			Requeue: true,
 		}),
-		Entry("Should fail if MachineCreate failed", MetalStackMachineTestCase{
+		Entry("Should fail terminally if MachineCreate failed without response and timeout", MetalStackMachineTestCase{
 			Objects: []runtime.Object{
 				newCluster(false, true),
 				newMetalStackCluster(newClusterOwnerRef(), pointer.StringPtr("privateNetworkID"), true, false),
 				newMachine(),
+				newSecret(dataSecretName),
 				newMetalStackMachine(newMachineOwnerRef(), nil, false)},
 			Error: true,
 			MockFunc: func() {
+				metalClient.EXPECT().PartitionCapacity().Return(newPartitionCapacityResponse(1), nil)
+				expectNoMachine()
 				metalClient.EXPECT().MachineCreate(gomock.Any()).Return(nil, fmt.Errorf("error"))
 			},
+			Check: expectCreateMachineFailure,
+		}),
+		Entry("Should fail if MachineCreate failed terminally", MetalStackMachineTestCase{
+			Objects: []runtime.Object{
+				newCluster(false, true),
+				newMetalStackCluster(newClusterOwnerRef(), pointer.StringPtr("privateNetworkID"), true, false),
+				newMachine(),
+				newSecret(dataSecretName),
+				newMetalStackMachine(newMachineOwnerRef(), nil, false)},
+			Error: true,
+			MockFunc: func() {
+				metalClient.EXPECT().PartitionCapacity().Return(newPartitionCapacityResponse(1), nil)
+				expectNoMachine()
+				metalClient.EXPECT().MachineCreate(gomock.Any()).Return(nil, metalmachine.NewAllocateMachineDefault(http.StatusUnprocessableEntity))
+			},
+			Check: expectCreateMachineFailure,
+		}),
+		Entry("Should retry without failure if MachineCreate failed by a server error", MetalStackMachineTestCase{
+			Objects: []runtime.Object{
+				newCluster(false, true),
+				newMetalStackCluster(newClusterOwnerRef(), pointer.StringPtr("privateNetworkID"), true, false),
+				newMachine(),
+				newSecret(dataSecretName),
+				newMetalStackMachine(newMachineOwnerRef(), nil, false)},
+			Error: true,
+			MockFunc: func() {
+				metalClient.EXPECT().PartitionCapacity().Return(newPartitionCapacityResponse(1), nil)
+				expectNoMachine()
+				metalClient.EXPECT().MachineCreate(gomock.Any()).Return(nil, metalmachine.NewAllocateMachineDefault(http.StatusServiceUnavailable))
+			},
+			Check: expectNoMachineFailure,
+		}),
+		Entry("Should retry without failure if MachineCreate timed out", MetalStackMachineTestCase{
+			Objects: []runtime.Object{
+				newCluster(false, true),
+				newMetalStackCluster(newClusterOwnerRef(), pointer.StringPtr("privateNetworkID"), true, false),
+				newMachine(),
+				newSecret(dataSecretName),
+				newMetalStackMachine(newMachineOwnerRef(), nil, false)},
+			Error: true,
+			MockFunc: func() {
+				metalClient.EXPECT().PartitionCapacity().Return(newPartitionCapacityResponse(1), nil)
+				expectNoMachine()
+				metalClient.EXPECT().MachineCreate(gomock.Any()).Return(nil, context.DeadlineExceeded)
+			},
+			Check: expectNoMachineFailure,
+		}),
+		Entry("Should adopt the machine allocated for the MetalStackMachine regardless of the capacity", MetalStackMachineTestCase{
+			Objects: []runtime.Object{
+				newCluster(false, true),
+				newMetalStackCluster(newClusterOwnerRef(), pointer.StringPtr("privateNetworkID"), true, false),
+				newMachine(),
+				newSecret(dataSecretName),
+				newMetalStackMachine(newMachineOwnerRef(), nil, false)},
+			RequeueAfter: nodeReadyInterval,
+			Check: func(metalMachine *api.MetalStackMachine) {
+				Expect(metalMachine.Spec.ProviderID).To(Equal(pointer.StringPtr("metalstack://test")))
+			},
+			MockFunc: func() {
+				// A moved cluster using all machines of the size adopts its machines.
+				metalClient.EXPECT().PartitionCapacity().Times(0)
+				metalClient.EXPECT().MachineFind(gomock.Any()).DoAndReturn(
+					func(mfr *metalgo.MachineFindRequest) (*metalgo.MachineListResponse, error) {
+						Expect(*mfr.AllocationName).To(Equal(metalStackMachineName))
+						return &metalgo.MachineListResponse{
+							Machines: []*metalmodels.V1MachineResponse{
+								{ID: pointer.StringPtr("test"), Allocation: &metalmodels.V1MachineAllocation{}},
+							},
+						}, nil
+					})
+			},
+		}),
+		Entry("Should fail if PartitionCapacity failed", MetalStackMachineTestCase{
+			Objects: []runtime.Object{
+				newCluster(false, true),
+				newMetalStackCluster(newClusterOwnerRef(), pointer.StringPtr("privateNetworkID"), true, false),
+				newMachine(),
+				newMetalStackMachine(newMachineOwnerRef(), nil, false)},
+			Error: true,
+			MockFunc: func() {
+				expectNoMachine()
+				metalClient.EXPECT().PartitionCapacity().Return(nil, fmt.Errorf("error"))
+			},
+		}),
+		Entry("Should wait if no free machine of the size", MetalStackMachineTestCase{
+			Objects: []runtime.Object{
+				newCluster(false, true),
+				newMetalStackCluster(newClusterOwnerRef(), pointer.StringPtr("privateNetworkID"), true, false),
+				newMachine(),
+				newMetalStackMachine(newMachineOwnerRef(), nil, false)},
+			RequeueAfter: capacityCheckInterval,
+			MockFunc: func() {
+				expectNoMachine()
+				metalClient.EXPECT().PartitionCapacity().Return(newPartitionCapacityResponse(0), nil)
+				metalClient.EXPECT().MachineCreate(gomock.Any()).Times(0)
+			},
+			Check: func(metalMachine *api.MetalStackMachine) {
+				Expect(conditions.IsFalse(metalMachine, api.MachineCapacityAvailableCondition)).To(BeTrue())
+				Expect(conditions.GetReason(metalMachine, api.MachineCapacityAvailableCondition)).To(Equal(api.InsufficientCapacityReason))
+				Expect(metalMachine.Spec.ProviderID).To(BeNil())
+				Expect(metalMachine.Status.FailureReason).To(BeNil())
+			},
 		}),
 		Entry("Should requeue if Node not ready", MetalStackMachineTestCase{
 			Objects: []runtime.Object{
@@ -110,7 +243,7 @@ var _ = Describe("Reconcile MetalStackMachine", func() {
 				newMetalStackCluster(newClusterOwnerRef(), pointer.StringPtr("privateNetworkID"), true, false),
 				newMachine(),
 				newMetalStackMachine(newMachineOwnerRef(), pointer.StringPtr(nodeID), false)},
-			Requeue: true,
+			RequeueAfter: nodeReadyInterval,
 			MockFunc: func() {
 				metalClient.EXPECT().MachineGet(gomock.Any()).Return(
 					&metalgo.MachineGetResponse{
@@ -138,6 +271,304 @@ var _ = Describe("Reconcile MetalStackMachine", func() {
 		}),
 	)
 
+	DescribeTable("Select Host", metalStackMachineTestFunc,
+		Entry("Should fail if no free machine matches", MetalStackMachineTestCase{
+			Objects: []runtime.Object{
+				newCluster(false, true),
+				newMetalStackCluster(newClusterOwnerRef(), pointer.StringPtr("privateNetworkID"), true, false),
+				newMachine(),
+				newSecret(dataSecretName),
+				newHostSelectedMetalStackMachine(newMachineOwnerRef(), &api.HostSelector{Racks: []string{"rack-1"}})},
+			Error: true,
+			MockFunc: func() {
+				metalClient.EXPECT().PartitionCapacity().Return(newPartitionCapacityResponse(1), nil)
+				expectNoMachine()
+				metalClient.EXPECT().MachineFind(gomock.Any()).Return(
+					&metalgo.MachineListResponse{
+						Machines: []*metalmodels.V1MachineResponse{
+							{ID: pointer.StringPtr("allocated"), Rackid: "rack-1", Allocation: &metalmodels.V1MachineAllocation{}},
+							{ID: pointer.StringPtr("other-rack"), Rackid: "rack-2"},
+						},
+					}, nil)
+			},
+		}),
+		Entry("Should create the selected machine", MetalStackMachineTestCase{
+			Objects: []runtime.Object{
+				newCluster(false, true),
+				newMetalStackCluster(newClusterOwnerRef(), pointer.StringPtr("privateNetworkID"), true, false),
+				newMachine(),
+				newSecret(dataSecretName),
+				newHostSelectedMetalStackMachine(newMachineOwnerRef(), &api.HostSelector{Tags: []string{"gpu"}})},
+			Error: true,
+			MockFunc: func() {
+				metalClient.EXPECT().PartitionCapacity().Return(newPartitionCapacityResponse(1), nil)
+				expectNoMachine()
+				metalClient.EXPECT().MachineFind(gomock.Any()).Return(
+					&metalgo.MachineListResponse{
+						Machines: []*metalmodels.V1MachineResponse{
+							{ID: pointer.StringPtr("free-2")},
+							{ID: pointer.StringPtr("free-1")},
+						},
+					}, nil)
+				metalClient.EXPECT().MachineCreate(gomock.Any()).DoAndReturn(
+					func(req *metalgo.MachineCreateRequest) (*metalgo.MachineCreateResponse, error) {
+						Expect(req.UUID).To(Equal("free-1"))
+						return nil, fmt.Errorf("error")
+					})
+			},
+		}),
+	)
+
+	DescribeTable("Spread selected hosts",
+		func(names []string, hosts []string) {
+			selector := &api.HostSelector{Tags: []string{"gpu"}}
+			metalClient.EXPECT().MachineFind(gomock.Any()).Return(
+				&metalgo.MachineListResponse{
+					Machines: []*metalmodels.V1MachineResponse{
+						{ID: pointer.StringPtr("free-2")},
+						{ID: pointer.StringPtr("free-1")},
+					},
+				}, nil).Times(len(names))
+
+			r := newTestMetalMachineReconciler(metalClient, nil)
+			var selected []string
+			for _, name := range names {
+				metalMachine := newHostSelectedMetalStackMachine(newMachineOwnerRef(), selector)
+				metalMachine.Name = name
+				uuid, err := r.selectHost(&metalStackMachineResources{
+					logger:       r.Log,
+					metalCluster: newMetalStackCluster(newClusterOwnerRef(), pointer.StringPtr("privateNetworkID"), true, false),
+					metalMachine: metalMachine,
+				})
+				Expect(err).NotTo(HaveOccurred())
+				selected = append(selected, uuid)
+			}
+			Expect(selected).To(Equal(hosts))
+		},
+		Entry("Should select different hosts for machines sharing a selector",
+			[]string{"md-0-abcde", "md-0-fghij"}, []string{"free-2", "free-1"}),
+		Entry("Should select the same host for the same machine again",
+			[]string{"md-0-abcde", "md-0-abcde"}, []string{"free-2", "free-2"}),
+	)
+
+	DescribeTable("Check Machine health", metalStackMachineTestFunc,
+		Entry("Should fail if MachineGet failed", MetalStackMachineTestCase{
+			Objects: []runtime.Object{
+				newCluster(false, true),
+				newMetalStackCluster(newClusterOwnerRef(), pointer.StringPtr("privateNetworkID"), true, false),
+				newMachine(),
+				newReadyMetalStackMachine(newMachineOwnerRef(), pointer.StringPtr(nodeID))},
+			Error: true,
+			MockFunc: func() {
+				metalClient.EXPECT().MachineGet(gomock.Any()).Return(nil, fmt.Errorf("error"))
+			},
+		}),
+		Entry("Should succeed if machine is alive", MetalStackMachineTestCase{
+			Objects: []runtime.Object{
+				newCluster(false, true),
+				newMetalStackCluster(newClusterOwnerRef(), pointer.StringPtr("privateNetworkID"), true, false),
+				newMachine(),
+				newReadyMetalStackMachine(newMachineOwnerRef(), pointer.StringPtr(nodeID))},
+			MockFunc: func() {
+				metalClient.EXPECT().MachineGet(gomock.Any()).Return(
+					&metalgo.MachineGetResponse{
+						Machine: &metalmodels.V1MachineResponse{
+							Allocation: &metalmodels.V1MachineAllocation{},
+							Liveliness: pointer.StringPtr(livelinessAlive),
+						},
+					}, nil)
+			},
+			RequeueAfter: machineHealthCheckInterval,
+			Check: func(metalMachine *api.MetalStackMachine) {
+				Expect(conditions.IsTrue(metalMachine, api.MachineHealthyCondition)).To(BeTrue())
+				Expect(metalMachine.Status.FailureReason).To(BeNil())
+			},
+		}),
+		Entry("Should succeed if machine is dead", MetalStackMachineTestCase{
+			Objects: []runtime.Object{
+				newCluster(false, true),
+				newMetalStackCluster(newClusterOwnerRef(), pointer.StringPtr("privateNetworkID"), true, false),
+				newMachine(),
+				newReadyMetalStackMachine(newMachineOwnerRef(), pointer.StringPtr(nodeID))},
+			MockFunc: func() {
+				metalClient.EXPECT().MachineGet(gomock.Any()).Return(
+					&metalgo.MachineGetResponse{
+						Machine: &metalmodels.V1MachineResponse{
+							Allocation: &metalmodels.V1MachineAllocation{},
+							Liveliness: pointer.StringPtr(livelinessDead),
+						},
+					}, nil)
+			},
+			Check: expectUnhealthyMachine(api.MachineDeadReason),
+		}),
+		Entry("Should succeed if machine crashed", MetalStackMachineTestCase{
+			Objects: []runtime.Object{
+				newCluster(false, true),
+				newMetalStackCluster(newClusterOwnerRef(), pointer.StringPtr("privateNetworkID"), true, false),
+				newMachine(),
+				newReadyMetalStackMachine(newMachineOwnerRef(), pointer.StringPtr(nodeID))},
+			MockFunc: func() {
+				metalClient.EXPECT().MachineGet(gomock.Any()).Return(
+					&metalgo.MachineGetResponse{
+						Machine: &metalmodels.V1MachineResponse{
+							Allocation: &metalmodels.V1MachineAllocation{},
+							Liveliness: pointer.StringPtr(livelinessAlive),
+							Events: &metalmodels.V1MachineRecentProvisioningEvents{
+								Log: []*metalmodels.V1MachineProvisioningEvent{
+									{Event: pointer.StringPtr(provisioningEventCrashed)},
+								},
+							},
+						},
+					}, nil)
+			},
+			Check: expectUnhealthyMachine(api.MachineCrashedReason),
+		}),
+		Entry("Should succeed if machine was released", MetalStackMachineTestCase{
+			Objects: []runtime.Object{
+				newCluster(false, true),
+				newMetalStackCluster(newClusterOwnerRef(), pointer.StringPtr("privateNetworkID"), true, false),
+				newMachine(),
+				newReadyMetalStackMachine(newMachineOwnerRef(), pointer.StringPtr(nodeID))},
+			MockFunc: func() {
+				metalClient.EXPECT().MachineGet(gomock.Any()).Return(
+					&metalgo.MachineGetResponse{
+						Machine: &metalmodels.V1MachineResponse{
+							Liveliness: pointer.StringPtr(livelinessAlive),
+						},
+					}, nil)
+			},
+			Check: expectUnhealthyMachine(api.MachineReleasedReason),
+		}),
+	)
+
+	DescribeTable("Remediate Machine", metalStackMachineTestFunc,
+		Entry("Should fail if MachinePowerReset failed", MetalStackMachineTestCase{
+			Objects: []runtime.Object{
+				newCluster(false, true),
+				newMetalStackCluster(newClusterOwnerRef(), pointer.StringPtr("privateNetworkID"), true, false),
+				newMachine(),
+				newRemediatedMetalStackMachine(newMachineOwnerRef(), pointer.StringPtr(nodeID), api.RemediationActionPowerReset)},
+			Error: true,
+			MockFunc: func() {
+				metalClient.EXPECT().MachinePowerReset(gomock.Any()).Return(nil, fmt.Errorf("error"))
+			},
+		}),
+		Entry("Should succeed to power cycle", MetalStackMachineTestCase{
+			Objects: []runtime.Object{
+				newCluster(false, true),
+				newMetalStackCluster(newClusterOwnerRef(), pointer.StringPtr("privateNetworkID"), true, false),
+				newMachine(),
+				newRemediatedMetalStackMachine(newMachineOwnerRef(), pointer.StringPtr(nodeID), api.RemediationActionPowerCycle)},
+			RequeueAfter: machineHealthCheckInterval,
+			MockFunc: func() {
+				metalClient.EXPECT().MachinePowerOff(gomock.Any()).Return(&metalgo.MachinePowerResponse{}, nil)
+				metalClient.EXPECT().MachinePowerOn(gomock.Any()).Return(&metalgo.MachinePowerResponse{}, nil)
+			},
+			Check: expectRemediation(api.RemediationActionPowerCycle, api.RemediationResultSucceeded, 1),
+		}),
+		Entry("Should not remediate if retry limit exceeded", MetalStackMachineTestCase{
+			Objects: []runtime.Object{
+				newCluster(false, true),
+				newMetalStackCluster(newClusterOwnerRef(), pointer.StringPtr("privateNetworkID"), true, false),
+				newMachine(),
+				func() *api.MetalStackMachine {
+					metalMachine := newRemediatedMetalStackMachine(newMachineOwnerRef(), pointer.StringPtr(nodeID), api.RemediationActionReinstall)
+					metalMachine.Status.Remediation = &api.RemediationStatus{RetryCount: api.DefaultRemediationRetryLimit}
+					return metalMachine
+				}()},
+			Check: expectRemediation(api.RemediationActionReinstall, api.RemediationResultRetryLimitExceeded, api.DefaultRemediationRetryLimit),
+		}),
+		Entry("Should remediate dead machine if configured", MetalStackMachineTestCase{
+			Objects: []runtime.Object{
+				newCluster(false, true),
+				newMetalStackCluster(newClusterOwnerRef(), pointer.StringPtr("privateNetworkID"), true, false),
+				newMachine(),
+				func() *api.MetalStackMachine {
+					metalMachine := newReadyMetalStackMachine(newMachineOwnerRef(), pointer.StringPtr(nodeID))
+					metalMachine.Spec.Remediation = &api.MetalStackMachineRemediation{Action: api.RemediationActionPowerReset}
+					return metalMachine
+				}()},
+			MockFunc: func() {
+				metalClient.EXPECT().MachineGet(gomock.Any()).Return(
+					&metalgo.MachineGetResponse{
+						Machine: &metalmodels.V1MachineResponse{
+							Allocation: &metalmodels.V1MachineAllocation{},
+							Liveliness: pointer.StringPtr(livelinessDead),
+						},
+					}, nil)
+				metalClient.EXPECT().MachinePowerReset(gomock.Any()).Return(&metalgo.MachinePowerResponse{}, nil)
+			},
+			Check: func(metalMachine *api.MetalStackMachine) {
+				expectRemediation(api.RemediationActionPowerReset, api.RemediationResultSucceeded, 1)(metalMachine)
+				Expect(metalMachine.Status.FailureReason).To(BeNil())
+				Expect(conditions.GetReason(metalMachine, api.MachineHealthyCondition)).To(Equal(api.MachineRemediatingReason))
+			},
+		}),
+		Entry("Should fail dead machine if soft remediation is disabled", MetalStackMachineTestCase{
+			Objects: []runtime.Object{
+				newCluster(false, true),
+				newMetalStackCluster(newClusterOwnerRef(), pointer.StringPtr("privateNetworkID"), true, false),
+				newMachine(),
+				func() *api.MetalStackMachine {
+					metalMachine := newReadyMetalStackMachine(newMachineOwnerRef(), pointer.StringPtr(nodeID))
+					metalMachine.Spec.Remediation = &api.MetalStackMachineRemediation{
+						Action:     api.RemediationActionPowerReset,
+						RetryLimit: pointer.Int32Ptr(0),
+					}
+					return metalMachine
+				}()},
+			MockFunc: func() {
+				metalClient.EXPECT().MachineGet(gomock.Any()).Return(
+					&metalgo.MachineGetResponse{
+						Machine: &metalmodels.V1MachineResponse{
+							Allocation: &metalmodels.V1MachineAllocation{},
+							Liveliness: pointer.StringPtr(livelinessDead),
+						},
+					}, nil)
+			},
+			Check: expectUnhealthyMachine(api.MachineDeadReason),
+		}),
+	)
+
+	It("Should persist the retry count of the remediations across reconciles", func() {
+		ctrl := gomock.NewController(GinkgoT())
+		defer ctrl.Finish()
+		metalClient := mocks.NewMockMetalStackClient(ctrl)
+		metalClient.EXPECT().MachinePowerReset(gomock.Any()).Return(&metalgo.MachinePowerResponse{}, nil).Times(2)
+
+		metalMachine := newReadyMetalStackMachine(newMachineOwnerRef(), pointer.StringPtr(nodeID))
+		metalMachine.Spec.Remediation = &api.MetalStackMachineRemediation{RetryLimit: pointer.Int32Ptr(2)}
+		r := newTestMetalMachineReconciler(metalClient, []runtime.Object{
+			newCluster(false, true),
+			newMetalStackCluster(newClusterOwnerRef(), pointer.StringPtr("privateNetworkID"), true, false),
+			newMachine(),
+			metalMachine,
+		})
+		key := types.NamespacedName{Name: metalStackMachineName, Namespace: namespaceName}
+
+		steps := []struct {
+			result     api.RemediationResult
+			retryCount int32
+		}{
+			{api.RemediationResultSucceeded, 1},
+			{api.RemediationResultSucceeded, 2},
+			{api.RemediationResultRetryLimitExceeded, 2},
+		}
+		for _, step := range steps {
+			metalMachine := &api.MetalStackMachine{}
+			Expect(r.Client.Get(context.TODO(), key, metalMachine)).To(Succeed())
+			metalMachine.Annotations = map[string]string{api.RemediationAnnotation: string(api.RemediationActionPowerReset)}
+			Expect(r.Client.Update(context.TODO(), metalMachine)).To(Succeed())
+
+			_, err := r.Reconcile(context.TODO(), reconcile.Request{NamespacedName: key})
+			Expect(err).NotTo(HaveOccurred())
+
+			remediated := &api.MetalStackMachine{}
+			Expect(r.Client.Get(context.TODO(), key, remediated)).To(Succeed())
+			expectRemediation(api.RemediationActionPowerReset, step.result, step.retryCount)(remediated)
+		}
+	})
+
 	DescribeTable("Delete Machine", metalStackMachineTestFunc,
 		Entry("Should fail if ProviderID not set", MetalStackMachineTestCase{
 			Objects: []runtime.Object{
@@ -185,4 +616,56 @@ var _ = Describe("Reconcile MetalStackMachine", func() {
 			},
 		}),
 	)
+
+	DescribeTable("Classify metal-API errors",
+		func(err error, transient bool) {
+			Expect(isTransientError(err)).To(Equal(transient))
+		},
+		Entry("Should retry on network errors", &url.Error{Op: "Post", URL: "https://metal-api", Err: &net.OpError{Op: "dial", Err: fmt.Errorf("connection refused")}}, true),
+		Entry("Should retry on timeout", fmt.Errorf("create machine: %w", context.DeadlineExceeded), true),
+		Entry("Should retry while the circuit breaker is open", errCircuitOpen, true),
+		Entry("Should fail on errors without response", fmt.Errorf("unable to decode response"), false),
+		Entry("Should retry on conflict", metalmachine.NewAllocateMachineDefault(http.StatusConflict), true),
+		Entry("Should retry on server error", metalmachine.NewAllocateMachineDefault(http.StatusServiceUnavailable), true),
+		Entry("Should retry wrapped errors", fmt.Errorf("create machine: %w", metalmachine.NewAllocateMachineDefault(http.StatusBadGateway)), true),
+		Entry("Should fail on bad request", metalmachine.NewAllocateMachineDefault(http.StatusBadRequest), false),
+		Entry("Should fail on unprocessable entity", metalmachine.NewAllocateMachineDefault(http.StatusUnprocessableEntity), false),
+	)
 })
+
+// expectCreateMachineFailure checks that a terminal error of the allocation failed the machine.
+func expectCreateMachineFailure(metalMachine *api.MetalStackMachine) {
+	Expect(metalMachine.Status.FailureReason).To(Equal(capierr.MachineStatusErrorPtr(capierr.CreateMachineError)))
+	Expect(metalMachine.Status.FailureMessage).NotTo(BeNil())
+}
+
+// expectNoMachineFailure checks that a transient error left the machine to be retried.
+func expectNoMachineFailure(metalMachine *api.MetalStackMachine) {
+	Expect(metalMachine.Status.FailureReason).To(BeNil())
+	Expect(metalMachine.Status.FailureMessage).To(BeNil())
+}
+
+// expectRemediation checks the recorded remediation and that the requested remediation was consumed.
+func expectRemediation(action api.RemediationAction, result api.RemediationResult, retryCount int32) func(metalMachine *api.MetalStackMachine) {
+	return func(metalMachine *api.MetalStackMachine) {
+		Expect(metalMachine.Annotations).NotTo(HaveKey(api.RemediationAnnotation))
+		Expect(metalMachine.Status.Remediation).NotTo(BeNil())
+		Expect(metalMachine.Status.Remediation.Action).To(Equal(action))
+		Expect(metalMachine.Status.Remediation.Result).To(Equal(result))
+		Expect(metalMachine.Status.Remediation.RetryCount).To(Equal(retryCount))
+		if result == api.RemediationResultSucceeded {
+			Expect(metalMachine.Status.Remediation.LastRemediated).NotTo(BeNil())
+		}
+	}
+}
+
+// expectUnhealthyMachine checks that the machine failed for the reason, so that a MachineHealthCheck remediates it.
+func expectUnhealthyMachine(reason string) func(metalMachine *api.MetalStackMachine) {
+	return func(metalMachine *api.MetalStackMachine) {
+		Expect(metalMachine.Status.FailureReason).To(Equal(capierr.MachineStatusErrorPtr(capierr.UpdateMachineError)))
+		Expect(metalMachine.Status.FailureMessage).NotTo(BeNil())
+		Expect(*metalMachine.Status.FailureMessage).To(ContainSubstring(reason))
+		Expect(conditions.GetReason(metalMachine, api.MachineHealthyCondition)).To(Equal(reason))
+		Expect(conditions.IsFalse(metalMachine, api.MachineHealthyCondition)).To(BeTrue())
+	}
+}
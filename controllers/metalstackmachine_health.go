@@ -0,0 +1,119 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/metal-stack/metal-go/api/models"
+	capiv1 "sigs.k8s.io/cluster-api/api/v1alpha4"
+	capierr "sigs.k8s.io/cluster-api/errors"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	api "github.com/metal-stack/cluster-api-provider-metalstack/api/v1alpha4"
+)
+
+const (
+	// machineHealthCheckInterval is the period in which ready machines are resynced with `metal-API`.
+	machineHealthCheckInterval = time.Minute
+
+	livelinessAlive = "Alive"
+	livelinessDead  = "Dead"
+
+	provisioningEventCrashed = "Crashed"
+)
+
+// reconcileHealth reads liveliness and provisioning events of a ready machine from `metal-API`.
+// Terminal states are soft remediated if configured. Otherwise they set the failure reason,
+// so that a MachineHealthCheck can remediate the Machine.
+func (r *MetalStackMachineReconciler) reconcileHealth(resources *metalStackMachineResources) (ctrl.Result, error) {
+	pid, err := resources.metalMachine.Spec.ParsedProviderID()
+	if err != nil {
+		return ctrl.Result{}, fmt.Errorf("parse provider ID: %w", err)
+	}
+
+	resp, err := r.MetalStackClient.MachineGet(pid)
+	if err != nil {
+		conditions.MarkUnknown(resources.metalMachine, api.MachineHealthyCondition, api.MachineHealthCheckFailedReason, "%v", err)
+		return ctrl.Result{}, fmt.Errorf("failed to get machine with ID %s: %w", pid, err)
+	}
+
+	reason, terminal := machineUnhealthyReason(resp.Machine)
+	switch {
+	case reason == "":
+		conditions.MarkTrue(resources.metalMachine, api.MachineHealthyCondition)
+		resetRemediationRetries(resources)
+	case terminal:
+		// A released machine can't be remediated on the same hardware.
+		action := resources.metalMachine.Spec.Remediation.GetAction()
+		if action != "" && reason != api.MachineReleasedReason && remediationRetriesLeft(resources.metalMachine) {
+			return r.reconcileRemediation(resources, action)
+		}
+
+		msg := fmt.Sprintf("Machine %s is unhealthy: %s", pid, reason)
+		resources.logger.Info(msg)
+		conditions.MarkFalse(resources.metalMachine, api.MachineHealthyCondition, reason, capiv1.ConditionSeverityError, "%s", msg)
+		resources.metalMachine.Status.SetFailure(msg, capierr.UpdateMachineError)
+		return ctrl.Result{}, nil
+	default:
+		conditions.MarkFalse(resources.metalMachine, api.MachineHealthyCondition, reason, capiv1.ConditionSeverityWarning, "Liveliness of machine %s is unknown", pid)
+	}
+
+	return ctrl.Result{RequeueAfter: machineHealthCheckInterval}, nil
+}
+
+// machineUnhealthyReason returns the reason why the machine isn't healthy and whether this state is terminal.
+// An empty reason means the machine is healthy.
+func machineUnhealthyReason(machine *models.V1MachineResponse) (reason string, terminal bool) {
+	if machine.Allocation == nil {
+		return api.MachineReleasedReason, true
+	}
+
+	if machine.Liveliness != nil && *machine.Liveliness == livelinessDead {
+		return api.MachineDeadReason, true
+	}
+
+	if event := lastProvisioningEvent(machine); event != nil && event.Event != nil && *event.Event == provisioningEventCrashed {
+		return api.MachineCrashedReason, true
+	}
+
+	if machine.Liveliness == nil || *machine.Liveliness != livelinessAlive {
+		return api.MachineLivelinessUnknownReason, false
+	}
+
+	return "", false
+}
+
+// lastProvisioningEvent returns the most recent provisioning event of the machine.
+func lastProvisioningEvent(machine *models.V1MachineResponse) (last *models.V1MachineProvisioningEvent) {
+	if machine.Events == nil {
+		return nil
+	}
+
+	for _, event := range machine.Events.Log {
+		if event == nil {
+			continue
+		}
+		if last == nil || time.Time(event.Time).After(time.Time(last.Time)) {
+			last = event
+		}
+	}
+
+	return last
+}
@@ -0,0 +1,116 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sort"
+
+	metalgo "github.com/metal-stack/metal-go"
+	"github.com/metal-stack/metal-go/api/models"
+
+	api "github.com/metal-stack/cluster-api-provider-metalstack/api/v1alpha4"
+)
+
+// selectHost resolves the HostSelector of the machine to a free machine of its size and partition.
+// All free machines matching the selector are recorded as candidates in the status.
+func (r *MetalStackMachineReconciler) selectHost(resources *metalStackMachineResources) (string, error) {
+	selector := resources.metalMachine.Spec.HostSelector
+
+	resp, err := r.MetalStackClient.MachineFind(newHostSelectorFindRequest(
+		resources.metalCluster.Spec.Partition,
+		resources.metalMachine.Spec.MachineType,
+		selector,
+	))
+	if err != nil {
+		return "", fmt.Errorf("error finding machines: %w", err)
+	}
+
+	candidates := hostCandidates(resp.Machines, selector.Racks)
+	resources.metalMachine.Status.HostCandidates = candidates
+	if len(candidates) == 0 {
+		return "", fmt.Errorf("no free machine of size %s in partition %s matches the host selector", resources.metalMachine.Spec.MachineType, resources.metalCluster.Spec.Partition)
+	}
+
+	// The machines of a MachineDeployment share the selector, so they pick their candidate by their name
+	// instead of all of them racing for the first one.
+	return candidates[hostIndex(resources.metalMachine.Name, len(candidates))], nil
+}
+
+// hostIndex spreads the machines evenly across n candidates.
+func hostIndex(name string, n int) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(name))
+	return int(h.Sum32() % uint32(n))
+}
+
+// newHostSelectorFindRequest queries the machines of the size in the partition matching the tags and hardware of the selector.
+func newHostSelectorFindRequest(partition, size string, selector *api.HostSelector) *metalgo.MachineFindRequest {
+	req := &metalgo.MachineFindRequest{
+		PartitionID: &partition,
+		SizeID:      &size,
+		Tags:        selector.Tags,
+	}
+
+	// The rack is matched by hostCandidates, since the request only takes a single one.
+	if hw := selector.Hardware; hw != nil {
+		req.HardwareCPUCores = hw.CPUCores
+		if hw.Memory != nil {
+			memory := hw.Memory.Value()
+			req.HardwareMemory = &memory
+		}
+		req.FruProductManufacturer = hw.ProductManufacturer
+		req.FruProductPartNumber = hw.ProductPartNumber
+	}
+
+	return req
+}
+
+// hostCandidates returns the sorted IDs of the machines which are neither allocated nor locked and placed in one of the racks.
+func hostCandidates(machines []*models.V1MachineResponse, racks []string) []string {
+	var candidates []string
+	for _, m := range machines {
+		if !isFreeMachine(m) {
+			continue
+		}
+		if len(racks) > 0 && !containsString(racks, m.Rackid) {
+			continue
+		}
+		candidates = append(candidates, *m.ID)
+	}
+	sort.Strings(candidates)
+
+	return candidates
+}
+
+// isFreeMachine tells whether the machine is neither allocated nor locked.
+func isFreeMachine(m *models.V1MachineResponse) bool {
+	if m == nil || m.ID == nil || m.Allocation != nil {
+		return false
+	}
+	return m.State == nil || m.State.Value == nil || *m.State.Value == ""
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,129 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	capiv1 "sigs.k8s.io/cluster-api/api/v1alpha4"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	api "github.com/metal-stack/cluster-api-provider-metalstack/api/v1alpha4"
+)
+
+// remediationRetryResetPeriod is the time a machine has to be healthy after its last remediation
+// before the retry count gets reset.
+const remediationRetryResetPeriod = time.Hour
+
+// reconcileRemediation applies a soft remediation to the hardware of the machine,
+// unless the retry limit of the machine is exceeded.
+func (r *MetalStackMachineReconciler) reconcileRemediation(resources *metalStackMachineResources, action api.RemediationAction) (ctrl.Result, error) {
+	metalMachine := resources.metalMachine
+	if metalMachine.Status.Remediation == nil {
+		metalMachine.Status.Remediation = &api.RemediationStatus{}
+	}
+	status := metalMachine.Status.Remediation
+	status.Action = action
+
+	if !action.IsValid() {
+		status.Result = api.RemediationResultFailed
+		status.Message = fmt.Sprintf("Unknown remediation action %q", action)
+		return ctrl.Result{}, nil
+	}
+
+	if !remediationRetriesLeft(metalMachine) {
+		status.Result = api.RemediationResultRetryLimitExceeded
+		status.Message = fmt.Sprintf("Retry limit of %d remediations exceeded", metalMachine.Spec.Remediation.GetRetryLimit())
+		resources.logger.Info(status.Message)
+		return ctrl.Result{}, nil
+	}
+
+	pid, err := metalMachine.Spec.ParsedProviderID()
+	if err != nil {
+		status.Result = api.RemediationResultFailed
+		status.Message = fmt.Sprintf("Failed to parse provider ID: %s", err)
+		return ctrl.Result{}, nil
+	}
+
+	now := metav1.Now()
+	status.RetryCount++
+	status.LastRemediated = &now
+
+	resources.logger.Info(fmt.Sprintf("Remediating machine %s by %s", pid, action))
+	if err := r.remediate(resources, pid, action); err != nil {
+		status.Result = api.RemediationResultFailed
+		status.Message = err.Error()
+		return ctrl.Result{}, fmt.Errorf("failed to remediate machine %s: %w", pid, err)
+	}
+
+	status.Result = api.RemediationResultSucceeded
+	status.Message = ""
+
+	metalMachine.Status.ClearFailure()
+	conditions.MarkFalse(metalMachine, api.MachineHealthyCondition, api.MachineRemediatingReason, capiv1.ConditionSeverityWarning, "Machine %s is remediated by %s", pid, action)
+
+	// The reinstalled machine boots as a new node which needs its provider ID.
+	if action == api.RemediationActionReinstall {
+		metalMachine.Status.Ready = false
+	}
+
+	return ctrl.Result{RequeueAfter: machineHealthCheckInterval}, nil
+}
+
+func (r *MetalStackMachineReconciler) remediate(resources *metalStackMachineResources, pid string, action api.RemediationAction) error {
+	switch action {
+	case api.RemediationActionPowerReset:
+		_, err := r.MetalStackClient.MachinePowerReset(pid)
+		return err
+	case api.RemediationActionPowerCycle:
+		if _, err := r.MetalStackClient.MachinePowerOff(pid); err != nil {
+			return err
+		}
+		_, err := r.MetalStackClient.MachinePowerOn(pid)
+		return err
+	case api.RemediationActionReinstall:
+		description := fmt.Sprintf("%s reinstalled by Cluster API provider MetalStack", resources.metalMachine.Name)
+		_, err := r.MetalStackClient.MachineReinstall(pid, resources.metalMachine.Spec.Image, description)
+		return err
+	default:
+		return fmt.Errorf("unknown remediation action %q", action)
+	}
+}
+
+// remediationRetriesLeft checks if the retry limit of the machine allows another remediation.
+func remediationRetriesLeft(metalMachine *api.MetalStackMachine) bool {
+	var retries int32
+	if status := metalMachine.Status.Remediation; status != nil {
+		retries = status.RetryCount
+	}
+	return retries < metalMachine.Spec.Remediation.GetRetryLimit()
+}
+
+// resetRemediationRetries resets the retry count once the machine is healthy long enough after its last remediation.
+func resetRemediationRetries(resources *metalStackMachineResources) {
+	status := resources.metalMachine.Status.Remediation
+	if status == nil || status.LastRemediated == nil {
+		return
+	}
+
+	if time.Since(status.LastRemediated.Time) > remediationRetryResetPeriod {
+		status.RetryCount = 0
+	}
+}
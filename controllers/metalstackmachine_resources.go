@@ -61,7 +61,9 @@ func newMetalStackMachineResources(
 		return nil, nil
 	}
 
-	if metalMachine.Status.Failed() {
+	// A failed MetalStackMachine still needs to be reconciled for deletion and requested soft remediation.
+	_, remediationRequested := metalMachine.RemediationRequested()
+	if metalMachine.Status.Failed() && metalMachine.DeletionTimestamp.IsZero() && !remediationRequested {
 		logger.Info("MetalStackMachine is failing")
 		return nil, nil
 	}
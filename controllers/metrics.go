@@ -0,0 +1,194 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	api "github.com/metal-stack/cluster-api-provider-metalstack/api/v1alpha4"
+)
+
+const metricsNamespace = "capms"
+
+// Resources whose provisioning duration is observed.
+const (
+	provisionedNetwork  = "network"
+	provisionedIP       = "ip"
+	provisionedFirewall = "firewall"
+	provisionedMachine  = "machine"
+)
+
+// States of the MetalStackMachines counted per cluster.
+const (
+	machineStatePending  = "pending"
+	machineStateReady    = "ready"
+	machineStateFailed   = "failed"
+	machineStateDeleting = "deleting"
+)
+
+var machineStates = []string{machineStatePending, machineStateReady, machineStateFailed, machineStateDeleting}
+
+var (
+	metalAPIRequests = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "metal_api_requests_total",
+			Help:      "Number of requests to metal-API per client method.",
+		},
+		[]string{"method"},
+	)
+
+	metalAPIRequestErrors = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "metal_api_request_errors_total",
+			Help:      "Number of failed requests to metal-API per client method.",
+		},
+		[]string{"method"},
+	)
+
+	metalAPIRequestDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "metal_api_request_duration_seconds",
+			Help:      "Latency of the requests to metal-API per client method.",
+			Buckets:   prometheus.DefBuckets,
+		},
+		[]string{"method"},
+	)
+
+	metalAPICacheHits = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "metal_api_cache_hits_total",
+			Help:      "Number of lookups served by the cache of the metal-API client per client method.",
+		},
+		[]string{"method"},
+	)
+
+	metalAPICacheMisses = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "metal_api_cache_misses_total",
+			Help:      "Number of lookups missing the cache of the metal-API client per client method.",
+		},
+		[]string{"method"},
+	)
+
+	metalAPICircuitOpen = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "metal_api_circuit_open",
+			Help:      "Whether the circuit breaker stops the requests to metal-API.",
+		},
+	)
+
+	provisioningDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "provisioning_duration_seconds",
+			Help:      "Time from the creation of a resource until its network, IP, firewall or machine is provisioned.",
+			Buckets:   prometheus.ExponentialBuckets(1, 2, 12),
+		},
+		[]string{"resource", "namespace", "cluster", "partition"},
+	)
+
+	lastProvisioningDuration = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "last_provisioning_duration_seconds",
+			Help:      "Duration of the last provisioning of a network, IP, firewall or machine.",
+		},
+		[]string{"resource", "namespace", "cluster", "partition"},
+	)
+
+	machines = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "machines",
+			Help:      "Number of MetalStackMachines per state.",
+		},
+		[]string{"namespace", "cluster", "partition", "state"},
+	)
+)
+
+func init() {
+	metrics.Registry.MustRegister(
+		metalAPIRequests,
+		metalAPIRequestErrors,
+		metalAPIRequestDuration,
+		metalAPICacheHits,
+		metalAPICacheMisses,
+		metalAPICircuitOpen,
+		provisioningDuration,
+		lastProvisioningDuration,
+		machines,
+	)
+}
+
+// observeMetalAPIRequest records a request to `metal-API` which started at the given time.
+func observeMetalAPIRequest(method string, start time.Time, err *error) {
+	metalAPIRequests.WithLabelValues(method).Inc()
+	metalAPIRequestDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+	if *err != nil {
+		metalAPIRequestErrors.WithLabelValues(method).Inc()
+	}
+}
+
+// observeProvisioning records the time from the creation of an object until the resource is provisioned.
+func observeProvisioning(resource string, metalCluster *api.MetalStackCluster, created metav1.Time) {
+	labels := []string{resource, metalCluster.Namespace, metalCluster.Name, metalCluster.Spec.Partition}
+	d := time.Since(created.Time).Seconds()
+	provisioningDuration.WithLabelValues(labels...).Observe(d)
+	lastProvisioningDuration.WithLabelValues(labels...).Set(d)
+}
+
+// setMachineStates sets the number of MetalStackMachines of the cluster per state.
+func setMachineStates(metalCluster *api.MetalStackCluster, metalMachines []api.MetalStackMachine) {
+	counts := make(map[string]int, len(machineStates))
+	for i := range metalMachines {
+		counts[machineState(&metalMachines[i])]++
+	}
+
+	for _, state := range machineStates {
+		machines.WithLabelValues(metalCluster.Namespace, metalCluster.Name, metalCluster.Spec.Partition, state).Set(float64(counts[state]))
+	}
+}
+
+// deleteMachineStates removes the machine counts of a deleted cluster.
+func deleteMachineStates(metalCluster *api.MetalStackCluster) {
+	for _, state := range machineStates {
+		machines.DeleteLabelValues(metalCluster.Namespace, metalCluster.Name, metalCluster.Spec.Partition, state)
+	}
+}
+
+func machineState(metalMachine *api.MetalStackMachine) string {
+	switch {
+	case !metalMachine.DeletionTimestamp.IsZero():
+		return machineStateDeleting
+	case metalMachine.Status.Failed():
+		return machineStateFailed
+	case metalMachine.Status.Ready:
+		return machineStateReady
+	default:
+		return machineStatePending
+	}
+}
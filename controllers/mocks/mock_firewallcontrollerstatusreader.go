@@ -0,0 +1,52 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: github.com/metal-stack/cluster-api-provider-metalstack/controllers (interfaces: FirewallControllerStatusReader)
+
+// Package mocks is a generated GoMock package.
+package mocks
+
+import (
+	context "context"
+	reflect "reflect"
+
+	gomock "github.com/golang/mock/gomock"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// MockFirewallControllerStatusReader is a mock of FirewallControllerStatusReader interface.
+type MockFirewallControllerStatusReader struct {
+	ctrl     *gomock.Controller
+	recorder *MockFirewallControllerStatusReaderMockRecorder
+}
+
+// MockFirewallControllerStatusReaderMockRecorder is the mock recorder for MockFirewallControllerStatusReader.
+type MockFirewallControllerStatusReaderMockRecorder struct {
+	mock *MockFirewallControllerStatusReader
+}
+
+// NewMockFirewallControllerStatusReader creates a new mock instance.
+func NewMockFirewallControllerStatusReader(ctrl *gomock.Controller) *MockFirewallControllerStatusReader {
+	mock := &MockFirewallControllerStatusReader{ctrl: ctrl}
+	mock.recorder = &MockFirewallControllerStatusReaderMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockFirewallControllerStatusReader) EXPECT() *MockFirewallControllerStatusReaderMockRecorder {
+	return m.recorder
+}
+
+// Read mocks base method.
+func (m *MockFirewallControllerStatusReader) Read(arg0 context.Context, arg1 []byte, arg2 string) (string, *v1.Time, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Read", arg0, arg1, arg2)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(*v1.Time)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// Read indicates an expected call of Read.
+func (mr *MockFirewallControllerStatusReaderMockRecorder) Read(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Read", reflect.TypeOf((*MockFirewallControllerStatusReader)(nil).Read), arg0, arg1, arg2)
+}
@@ -0,0 +1,52 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: github.com/metal-stack/cluster-api-provider-metalstack/controllers (interfaces: FirewallCredentialsIssuer)
+
+// Package mocks is a generated GoMock package.
+package mocks
+
+import (
+	context "context"
+	reflect "reflect"
+	time "time"
+
+	gomock "github.com/golang/mock/gomock"
+)
+
+// MockFirewallCredentialsIssuer is a mock of FirewallCredentialsIssuer interface.
+type MockFirewallCredentialsIssuer struct {
+	ctrl     *gomock.Controller
+	recorder *MockFirewallCredentialsIssuerMockRecorder
+}
+
+// MockFirewallCredentialsIssuerMockRecorder is the mock recorder for MockFirewallCredentialsIssuer.
+type MockFirewallCredentialsIssuerMockRecorder struct {
+	mock *MockFirewallCredentialsIssuer
+}
+
+// NewMockFirewallCredentialsIssuer creates a new mock instance.
+func NewMockFirewallCredentialsIssuer(ctrl *gomock.Controller) *MockFirewallCredentialsIssuer {
+	mock := &MockFirewallCredentialsIssuer{ctrl: ctrl}
+	mock.recorder = &MockFirewallCredentialsIssuerMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockFirewallCredentialsIssuer) EXPECT() *MockFirewallCredentialsIssuerMockRecorder {
+	return m.recorder
+}
+
+// Issue mocks base method.
+func (m *MockFirewallCredentialsIssuer) Issue(arg0 context.Context, arg1 []byte, arg2 time.Duration) ([]byte, time.Time, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Issue", arg0, arg1, arg2)
+	ret0, _ := ret[0].([]byte)
+	ret1, _ := ret[1].(time.Time)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// Issue indicates an expected call of Issue.
+func (mr *MockFirewallCredentialsIssuerMockRecorder) Issue(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Issue", reflect.TypeOf((*MockFirewallCredentialsIssuer)(nil).Issue), arg0, arg1, arg2)
+}
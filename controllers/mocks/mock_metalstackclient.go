@@ -1,39 +1,40 @@
 // Code generated by MockGen. DO NOT EDIT.
 // Source: github.com/metal-stack/cluster-api-provider-metalstack/controllers (interfaces: MetalStackClient)
 
-// Package mock_controllers is a generated GoMock package.
+// Package mocks is a generated GoMock package.
 package mocks
 
 import (
+	reflect "reflect"
+
 	gomock "github.com/golang/mock/gomock"
 	metalgo "github.com/metal-stack/metal-go"
-	reflect "reflect"
 )
 
-// MockMetalStackClient is a mock of MetalStackClient interface
+// MockMetalStackClient is a mock of MetalStackClient interface.
 type MockMetalStackClient struct {
 	ctrl     *gomock.Controller
 	recorder *MockMetalStackClientMockRecorder
 }
 
-// MockMetalStackClientMockRecorder is the mock recorder for MockMetalStackClient
+// MockMetalStackClientMockRecorder is the mock recorder for MockMetalStackClient.
 type MockMetalStackClientMockRecorder struct {
 	mock *MockMetalStackClient
 }
 
-// NewMockMetalStackClient creates a new mock instance
+// NewMockMetalStackClient creates a new mock instance.
 func NewMockMetalStackClient(ctrl *gomock.Controller) *MockMetalStackClient {
 	mock := &MockMetalStackClient{ctrl: ctrl}
 	mock.recorder = &MockMetalStackClientMockRecorder{mock}
 	return mock
 }
 
-// EXPECT returns an object that allows the caller to indicate expected use
+// EXPECT returns an object that allows the caller to indicate expected use.
 func (m *MockMetalStackClient) EXPECT() *MockMetalStackClientMockRecorder {
 	return m.recorder
 }
 
-// FirewallCreate mocks base method
+// FirewallCreate mocks base method.
 func (m *MockMetalStackClient) FirewallCreate(arg0 *metalgo.FirewallCreateRequest) (*metalgo.FirewallCreateResponse, error) {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "FirewallCreate", arg0)
@@ -42,13 +43,13 @@ func (m *MockMetalStackClient) FirewallCreate(arg0 *metalgo.FirewallCreateReques
 	return ret0, ret1
 }
 
-// FirewallCreate indicates an expected call of FirewallCreate
+// FirewallCreate indicates an expected call of FirewallCreate.
 func (mr *MockMetalStackClientMockRecorder) FirewallCreate(arg0 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FirewallCreate", reflect.TypeOf((*MockMetalStackClient)(nil).FirewallCreate), arg0)
 }
 
-// FirewallFind mocks base method
+// FirewallFind mocks base method.
 func (m *MockMetalStackClient) FirewallFind(arg0 *metalgo.FirewallFindRequest) (*metalgo.FirewallListResponse, error) {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "FirewallFind", arg0)
@@ -57,13 +58,13 @@ func (m *MockMetalStackClient) FirewallFind(arg0 *metalgo.FirewallFindRequest) (
 	return ret0, ret1
 }
 
-// FirewallFind indicates an expected call of FirewallFind
+// FirewallFind indicates an expected call of FirewallFind.
 func (mr *MockMetalStackClientMockRecorder) FirewallFind(arg0 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FirewallFind", reflect.TypeOf((*MockMetalStackClient)(nil).FirewallFind), arg0)
 }
 
-// FirewallGet mocks base method
+// FirewallGet mocks base method.
 func (m *MockMetalStackClient) FirewallGet(arg0 string) (*metalgo.FirewallGetResponse, error) {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "FirewallGet", arg0)
@@ -72,13 +73,13 @@ func (m *MockMetalStackClient) FirewallGet(arg0 string) (*metalgo.FirewallGetRes
 	return ret0, ret1
 }
 
-// FirewallGet indicates an expected call of FirewallGet
+// FirewallGet indicates an expected call of FirewallGet.
 func (mr *MockMetalStackClientMockRecorder) FirewallGet(arg0 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FirewallGet", reflect.TypeOf((*MockMetalStackClient)(nil).FirewallGet), arg0)
 }
 
-// IPAllocate mocks base method
+// IPAllocate mocks base method.
 func (m *MockMetalStackClient) IPAllocate(arg0 *metalgo.IPAllocateRequest) (*metalgo.IPDetailResponse, error) {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "IPAllocate", arg0)
@@ -87,13 +88,58 @@ func (m *MockMetalStackClient) IPAllocate(arg0 *metalgo.IPAllocateRequest) (*met
 	return ret0, ret1
 }
 
-// IPAllocate indicates an expected call of IPAllocate
+// IPAllocate indicates an expected call of IPAllocate.
 func (mr *MockMetalStackClientMockRecorder) IPAllocate(arg0 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IPAllocate", reflect.TypeOf((*MockMetalStackClient)(nil).IPAllocate), arg0)
 }
 
-// MachineCreate mocks base method
+// IPFind mocks base method.
+func (m *MockMetalStackClient) IPFind(arg0 *metalgo.IPFindRequest) (*metalgo.IPListResponse, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "IPFind", arg0)
+	ret0, _ := ret[0].(*metalgo.IPListResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// IPFind indicates an expected call of IPFind.
+func (mr *MockMetalStackClientMockRecorder) IPFind(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IPFind", reflect.TypeOf((*MockMetalStackClient)(nil).IPFind), arg0)
+}
+
+// IPFree mocks base method.
+func (m *MockMetalStackClient) IPFree(arg0 string) (*metalgo.IPDetailResponse, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "IPFree", arg0)
+	ret0, _ := ret[0].(*metalgo.IPDetailResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// IPFree indicates an expected call of IPFree.
+func (mr *MockMetalStackClientMockRecorder) IPFree(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IPFree", reflect.TypeOf((*MockMetalStackClient)(nil).IPFree), arg0)
+}
+
+// IPGet mocks base method.
+func (m *MockMetalStackClient) IPGet(arg0 string) (*metalgo.IPDetailResponse, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "IPGet", arg0)
+	ret0, _ := ret[0].(*metalgo.IPDetailResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// IPGet indicates an expected call of IPGet.
+func (mr *MockMetalStackClientMockRecorder) IPGet(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IPGet", reflect.TypeOf((*MockMetalStackClient)(nil).IPGet), arg0)
+}
+
+// MachineCreate mocks base method.
 func (m *MockMetalStackClient) MachineCreate(arg0 *metalgo.MachineCreateRequest) (*metalgo.MachineCreateResponse, error) {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "MachineCreate", arg0)
@@ -102,13 +148,13 @@ func (m *MockMetalStackClient) MachineCreate(arg0 *metalgo.MachineCreateRequest)
 	return ret0, ret1
 }
 
-// MachineCreate indicates an expected call of MachineCreate
+// MachineCreate indicates an expected call of MachineCreate.
 func (mr *MockMetalStackClientMockRecorder) MachineCreate(arg0 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MachineCreate", reflect.TypeOf((*MockMetalStackClient)(nil).MachineCreate), arg0)
 }
 
-// MachineDelete mocks base method
+// MachineDelete mocks base method.
 func (m *MockMetalStackClient) MachineDelete(arg0 string) (*metalgo.MachineDeleteResponse, error) {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "MachineDelete", arg0)
@@ -117,13 +163,13 @@ func (m *MockMetalStackClient) MachineDelete(arg0 string) (*metalgo.MachineDelet
 	return ret0, ret1
 }
 
-// MachineDelete indicates an expected call of MachineDelete
+// MachineDelete indicates an expected call of MachineDelete.
 func (mr *MockMetalStackClientMockRecorder) MachineDelete(arg0 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MachineDelete", reflect.TypeOf((*MockMetalStackClient)(nil).MachineDelete), arg0)
 }
 
-// MachineFind mocks base method
+// MachineFind mocks base method.
 func (m *MockMetalStackClient) MachineFind(arg0 *metalgo.MachineFindRequest) (*metalgo.MachineListResponse, error) {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "MachineFind", arg0)
@@ -132,13 +178,13 @@ func (m *MockMetalStackClient) MachineFind(arg0 *metalgo.MachineFindRequest) (*m
 	return ret0, ret1
 }
 
-// MachineFind indicates an expected call of MachineFind
+// MachineFind indicates an expected call of MachineFind.
 func (mr *MockMetalStackClientMockRecorder) MachineFind(arg0 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MachineFind", reflect.TypeOf((*MockMetalStackClient)(nil).MachineFind), arg0)
 }
 
-// MachineGet mocks base method
+// MachineGet mocks base method.
 func (m *MockMetalStackClient) MachineGet(arg0 string) (*metalgo.MachineGetResponse, error) {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "MachineGet", arg0)
@@ -147,13 +193,73 @@ func (m *MockMetalStackClient) MachineGet(arg0 string) (*metalgo.MachineGetRespo
 	return ret0, ret1
 }
 
-// MachineGet indicates an expected call of MachineGet
+// MachineGet indicates an expected call of MachineGet.
 func (mr *MockMetalStackClientMockRecorder) MachineGet(arg0 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MachineGet", reflect.TypeOf((*MockMetalStackClient)(nil).MachineGet), arg0)
 }
 
-// NetworkAllocate mocks base method
+// MachinePowerOff mocks base method.
+func (m *MockMetalStackClient) MachinePowerOff(arg0 string) (*metalgo.MachinePowerResponse, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MachinePowerOff", arg0)
+	ret0, _ := ret[0].(*metalgo.MachinePowerResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// MachinePowerOff indicates an expected call of MachinePowerOff.
+func (mr *MockMetalStackClientMockRecorder) MachinePowerOff(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MachinePowerOff", reflect.TypeOf((*MockMetalStackClient)(nil).MachinePowerOff), arg0)
+}
+
+// MachinePowerOn mocks base method.
+func (m *MockMetalStackClient) MachinePowerOn(arg0 string) (*metalgo.MachinePowerResponse, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MachinePowerOn", arg0)
+	ret0, _ := ret[0].(*metalgo.MachinePowerResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// MachinePowerOn indicates an expected call of MachinePowerOn.
+func (mr *MockMetalStackClientMockRecorder) MachinePowerOn(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MachinePowerOn", reflect.TypeOf((*MockMetalStackClient)(nil).MachinePowerOn), arg0)
+}
+
+// MachinePowerReset mocks base method.
+func (m *MockMetalStackClient) MachinePowerReset(arg0 string) (*metalgo.MachinePowerResponse, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MachinePowerReset", arg0)
+	ret0, _ := ret[0].(*metalgo.MachinePowerResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// MachinePowerReset indicates an expected call of MachinePowerReset.
+func (mr *MockMetalStackClientMockRecorder) MachinePowerReset(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MachinePowerReset", reflect.TypeOf((*MockMetalStackClient)(nil).MachinePowerReset), arg0)
+}
+
+// MachineReinstall mocks base method.
+func (m *MockMetalStackClient) MachineReinstall(arg0, arg1, arg2 string) (*metalgo.MachineGetResponse, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MachineReinstall", arg0, arg1, arg2)
+	ret0, _ := ret[0].(*metalgo.MachineGetResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// MachineReinstall indicates an expected call of MachineReinstall.
+func (mr *MockMetalStackClientMockRecorder) MachineReinstall(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MachineReinstall", reflect.TypeOf((*MockMetalStackClient)(nil).MachineReinstall), arg0, arg1, arg2)
+}
+
+// NetworkAllocate mocks base method.
 func (m *MockMetalStackClient) NetworkAllocate(arg0 *metalgo.NetworkAllocateRequest) (*metalgo.NetworkDetailResponse, error) {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "NetworkAllocate", arg0)
@@ -162,13 +268,13 @@ func (m *MockMetalStackClient) NetworkAllocate(arg0 *metalgo.NetworkAllocateRequ
 	return ret0, ret1
 }
 
-// NetworkAllocate indicates an expected call of NetworkAllocate
+// NetworkAllocate indicates an expected call of NetworkAllocate.
 func (mr *MockMetalStackClientMockRecorder) NetworkAllocate(arg0 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "NetworkAllocate", reflect.TypeOf((*MockMetalStackClient)(nil).NetworkAllocate), arg0)
 }
 
-// NetworkFind mocks base method
+// NetworkFind mocks base method.
 func (m *MockMetalStackClient) NetworkFind(arg0 *metalgo.NetworkFindRequest) (*metalgo.NetworkListResponse, error) {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "NetworkFind", arg0)
@@ -177,13 +283,13 @@ func (m *MockMetalStackClient) NetworkFind(arg0 *metalgo.NetworkFindRequest) (*m
 	return ret0, ret1
 }
 
-// NetworkFind indicates an expected call of NetworkFind
+// NetworkFind indicates an expected call of NetworkFind.
 func (mr *MockMetalStackClientMockRecorder) NetworkFind(arg0 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "NetworkFind", reflect.TypeOf((*MockMetalStackClient)(nil).NetworkFind), arg0)
 }
 
-// NetworkFree mocks base method
+// NetworkFree mocks base method.
 func (m *MockMetalStackClient) NetworkFree(arg0 string) (*metalgo.NetworkDetailResponse, error) {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "NetworkFree", arg0)
@@ -192,8 +298,38 @@ func (m *MockMetalStackClient) NetworkFree(arg0 string) (*metalgo.NetworkDetailR
 	return ret0, ret1
 }
 
-// NetworkFree indicates an expected call of NetworkFree
+// NetworkFree indicates an expected call of NetworkFree.
 func (mr *MockMetalStackClientMockRecorder) NetworkFree(arg0 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "NetworkFree", reflect.TypeOf((*MockMetalStackClient)(nil).NetworkFree), arg0)
 }
+
+// PartitionCapacity mocks base method.
+func (m *MockMetalStackClient) PartitionCapacity() (*metalgo.PartitionCapacityResponse, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PartitionCapacity")
+	ret0, _ := ret[0].(*metalgo.PartitionCapacityResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// PartitionCapacity indicates an expected call of PartitionCapacity.
+func (mr *MockMetalStackClientMockRecorder) PartitionCapacity() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PartitionCapacity", reflect.TypeOf((*MockMetalStackClient)(nil).PartitionCapacity))
+}
+
+// PartitionList mocks base method.
+func (m *MockMetalStackClient) PartitionList() (*metalgo.PartitionListResponse, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PartitionList")
+	ret0, _ := ret[0].(*metalgo.PartitionListResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// PartitionList indicates an expected call of PartitionList.
+func (mr *MockMetalStackClientMockRecorder) PartitionList() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PartitionList", reflect.TypeOf((*MockMetalStackClient)(nil).PartitionList))
+}
@@ -0,0 +1,50 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"time"
+
+	"golang.org/x/time/rate"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/ratelimiter"
+)
+
+// The reconcilers return an error if a request to metal-API failed, so that the object is requeued with exponential backoff.
+// They wait for a reason with an explicit RequeueAfter, and for objects of the management cluster by watches.
+const (
+	// failureBackoffBase is the delay of the first retry of an object after an error.
+	failureBackoffBase = 2 * time.Second
+	// failureBackoffMax limits the delay of the retries of an object.
+	failureBackoffMax = 5 * time.Minute
+)
+
+// newRateLimiter returns the rate limiter of the requeues after errors. The delay doubles per consecutive error of an object
+// and is reset once it's reconciled successfully. The overall rate limits the retries of many objects at once.
+func newRateLimiter() ratelimiter.RateLimiter {
+	return workqueue.NewMaxOfRateLimiter(
+		workqueue.NewItemExponentialFailureRateLimiter(failureBackoffBase, failureBackoffMax),
+		&workqueue.BucketRateLimiter{Limiter: rate.NewLimiter(rate.Limit(10), 100)},
+	)
+}
+
+// controllerOptions returns the options of the controllers.
+// The concurrency is left to the manager, which configures it per kind.
+func controllerOptions() controller.Options {
+	return controller.Options{RateLimiter: newRateLimiter()}
+}
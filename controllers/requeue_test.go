@@ -0,0 +1,46 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+var _ = Describe("Requeue backoff", func() {
+	DescribeTable("Delay the retries after errors",
+		func(failures int, forget bool, delay time.Duration) {
+			limiter := newRateLimiter()
+			req := ctrl.Request{}
+			for i := 0; i < failures; i++ {
+				limiter.When(req)
+			}
+			if forget {
+				limiter.Forget(req)
+			}
+			Expect(limiter.When(req)).To(Equal(delay))
+		},
+		Entry("Should retry after the base delay", 0, false, failureBackoffBase),
+		Entry("Should double the delay per error", 3, false, 8*failureBackoffBase),
+		Entry("Should limit the delay", 20, false, failureBackoffMax),
+		Entry("Should reset the delay after success", 5, true, failureBackoffBase),
+	)
+})
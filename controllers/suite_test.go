@@ -17,10 +17,16 @@ limitations under the License.
 package controllers
 
 import (
+	"fmt"
+	"os/exec"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	api "github.com/metal-stack/cluster-api-provider-metalstack/api/v1alpha4"
+	metalgo "github.com/metal-stack/metal-go"
+	metalmodels "github.com/metal-stack/metal-go/api/models"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	corev1 "k8s.io/api/core/v1"
@@ -69,6 +75,13 @@ func init() {
 	logf.SetLogger(klogr.New())
 }
 
+// moduleDir returns the directory of a module dependency, wherever the module cache is.
+func moduleDir(path string) string {
+	out, err := exec.Command("go", "list", "-m", "-f", "{{.Dir}}", path).Output()
+	Expect(err).NotTo(HaveOccurred())
+	return strings.TrimSpace(string(out))
+}
+
 func TestAPIs(t *testing.T) {
 	RegisterFailHandler(Fail)
 
@@ -82,7 +95,12 @@ var _ = BeforeSuite(func(done Done) {
 
 	By("bootstrapping test environment")
 	testEnv = &envtest.Environment{
-		CRDDirectoryPaths: []string{filepath.Join("..", "config", "crd", "bases")},
+		CRDDirectoryPaths: []string{
+			filepath.Join("..", "config", "resources", "crd", "bases"),
+			// The Cluster API types are installed from the module of the version in go.mod.
+			filepath.Join(moduleDir("sigs.k8s.io/cluster-api"), "config", "crd", "bases"),
+		},
+		ErrorIfCRDPathMissing: true,
 	}
 
 	var err error
@@ -118,10 +136,13 @@ func setupScheme() *apimachineryruntime.Scheme {
 }
 
 func newTestMetalClusterReconciler(metalClient MetalStackClient, objects []runtime.Object) *MetalStackClusterReconciler {
+	scheme := setupScheme()
+
 	return &MetalStackClusterReconciler{
-		Client:           fake.NewFakeClientWithScheme(setupScheme(), objects...),
+		Client:           fake.NewFakeClientWithScheme(scheme, objects...),
 		Log:              zap.New(zap.UseDevMode(true)),
 		MetalStackClient: metalClient,
+		Scheme:           scheme,
 	}
 }
 
@@ -146,11 +167,21 @@ func newTestMetalMachineReconciler(metalClient MetalStackClient, objects []runti
 	}
 }
 
-func newTestMetalFirewallReconciler(metalClient MetalStackClient, objects []runtime.Object) *MetalStackFirewallReconciler {
+func newTestMetalFirewallReconciler(
+	metalClient MetalStackClient,
+	credentialsIssuer FirewallCredentialsIssuer,
+	statusReader FirewallControllerStatusReader,
+	objects []runtime.Object,
+) *MetalStackFirewallReconciler {
+	scheme := setupScheme()
+
 	return &MetalStackFirewallReconciler{
-		Client:           fake.NewFakeClientWithScheme(setupScheme(), objects...),
-		Log:              zap.New(zap.UseDevMode(true)),
-		MetalStackClient: metalClient,
+		Client:                 fake.NewFakeClientWithScheme(scheme, objects...),
+		ControllerStatusReader: statusReader,
+		CredentialsIssuer:      credentialsIssuer,
+		Log:                    zap.New(zap.UseDevMode(true)),
+		MetalStackClient:       metalClient,
+		Scheme:                 scheme,
 	}
 }
 
@@ -295,6 +326,40 @@ func newMetalStackMachine(ownerRef *metav1.OwnerReference, providerID *string, d
 	}
 }
 
+func newReadyMetalStackMachine(ownerRef *metav1.OwnerReference, providerID *string) *api.MetalStackMachine {
+	metalMachine := newMetalStackMachine(ownerRef, providerID, false)
+	metalMachine.Status.Ready = true
+
+	return metalMachine
+}
+
+func newRemediatedMetalStackMachine(ownerRef *metav1.OwnerReference, providerID *string, action api.RemediationAction) *api.MetalStackMachine {
+	metalMachine := newReadyMetalStackMachine(ownerRef, providerID)
+	metalMachine.Annotations = map[string]string{api.RemediationAnnotation: string(action)}
+
+	return metalMachine
+}
+
+func newHostSelectedMetalStackMachine(ownerRef *metav1.OwnerReference, selector *api.HostSelector) *api.MetalStackMachine {
+	metalMachine := newMetalStackMachine(ownerRef, nil, false)
+	metalMachine.Spec.HostSelector = selector
+
+	return metalMachine
+}
+
+func newPartitionCapacityResponse(free int32) *metalgo.PartitionCapacityResponse {
+	return &metalgo.PartitionCapacityResponse{
+		Capacity: []*metalmodels.V1PartitionCapacity{{
+			ID: pointer.StringPtr(""),
+			Servers: []*metalmodels.V1ServerCapacity{{
+				Size:  pointer.StringPtr(""),
+				Free:  pointer.Int32Ptr(free),
+				Total: pointer.Int32Ptr(2),
+			}},
+		}},
+	}
+}
+
 func newMetalStackFirewall(providerID *string, deleted bool) *api.MetalStackFirewall {
 	spec := api.MetalStackFirewallSpec{
 		ProviderID: providerID,
@@ -322,6 +387,14 @@ func newMetalStackFirewall(providerID *string, deleted bool) *api.MetalStackFire
 	}
 }
 
+func newClusterFirewall(ready bool) *api.MetalStackFirewall {
+	firewall := newMetalStackFirewall(pointer.StringPtr(nodeID), false)
+	firewall.Name = metalStackClusterName
+	firewall.Status.Ready = ready
+
+	return firewall
+}
+
 func newSecret(name string) *corev1.Secret {
 	typeMeta := metav1.TypeMeta{
 		Kind:       "Secret",
@@ -339,6 +412,13 @@ func newSecret(name string) *corev1.Secret {
 	}
 }
 
+func newFirewallControllerSecret(expireAt time.Time) *corev1.Secret {
+	secret := newSecret(fmt.Sprintf(firewallControllerKubeconfigSecretNameTemplate, metalStackClusterName))
+	secret.Annotations = map[string]string{credentialsExpireAtAnnotation: expireAt.UTC().Format(time.RFC3339)}
+
+	return secret
+}
+
 func newNode() *corev1.Node {
 	status := corev1.NodeStatus{
 		NodeInfo: corev1.NodeSystemInfo{
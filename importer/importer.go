@@ -0,0 +1,358 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package importer discovers a cluster built on metal-stack without Cluster API
+// and generates the objects which let the controllers take it over without reprovisioning.
+package importer
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+
+	metalgo "github.com/metal-stack/metal-go"
+	metalmodels "github.com/metal-stack/metal-go/api/models"
+	"github.com/metal-stack/metal-lib/pkg/tag"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/pointer"
+	capi "sigs.k8s.io/cluster-api/api/v1alpha4"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+
+	api "github.com/metal-stack/cluster-api-provider-metalstack/api/v1alpha4"
+	"github.com/metal-stack/cluster-api-provider-metalstack/controllers"
+)
+
+// Options selects the cluster to import and names the generated objects.
+type Options struct {
+	// Name of the generated Cluster and MetalStackCluster.
+	Name string
+
+	// Namespace of the generated objects.
+	Namespace string
+
+	// ProjectID is the project the machines and firewalls of the cluster are allocated in.
+	ProjectID string
+
+	// ClusterID is the value of the tag the metal-stack resources of the cluster are tagged with.
+	ClusterID string
+
+	// PublicNetworkID is the network the control plane IP is allocated in.
+	PublicNetworkID string
+
+	// ControlPlaneHost is the IP of the control plane endpoint.
+	// It's looked up by the name the controller gives it if empty.
+	ControlPlaneHost string
+
+	// ControlPlanePort is the port of the control plane endpoint.
+	ControlPlanePort int32
+
+	// ControlPlaneMachines are the IDs or names of the machines running the control plane.
+	ControlPlaneMachines []string
+
+	// KubernetesVersion is the version of the generated Machines, unset if empty.
+	KubernetesVersion string
+
+	// WatchFilterValue is the value of the watch-filter label of the generated objects, unset if empty.
+	WatchFilterValue string
+}
+
+// Import discovers the machines, firewalls, network and control plane IP of the cluster in metal-API
+// and returns the objects describing it.
+// All of them have their provider IDs set, so that the controllers take over the existing resources.
+func Import(metalClient controllers.MetalStackClient, opts Options) ([]client.Object, error) {
+	clusterIDTag := fmt.Sprintf("%s=%s", tag.ClusterID, opts.ClusterID)
+
+	firewalls, err := metalClient.FirewallFind(&metalgo.FirewallFindRequest{
+		MachineFindRequest: metalgo.MachineFindRequest{
+			AllocationProject: &opts.ProjectID,
+			Tags:              []string{clusterIDTag},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find firewalls: %w", err)
+	}
+	fws := make([]*metalmodels.V1MachineResponse, 0, len(firewalls.Firewalls))
+	isFirewall := make(map[string]bool)
+	for _, fw := range firewalls.Firewalls {
+		m := &metalmodels.V1MachineResponse{ID: fw.ID, Allocation: fw.Allocation, Partition: fw.Partition, Size: fw.Size}
+		if err := validateAllocated(m); err != nil {
+			return nil, err
+		}
+		fws = append(fws, m)
+		isFirewall[*fw.ID] = true
+	}
+	sortByName(fws)
+
+	machines, err := metalClient.MachineFind(&metalgo.MachineFindRequest{
+		AllocationProject: &opts.ProjectID,
+		Tags:              []string{clusterIDTag},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find machines: %w", err)
+	}
+	ms := make([]*metalmodels.V1MachineResponse, 0, len(machines.Machines))
+	for _, m := range machines.Machines {
+		if isFirewall[*m.ID] {
+			continue
+		}
+		if err := validateAllocated(m); err != nil {
+			return nil, err
+		}
+		ms = append(ms, m)
+	}
+	if len(ms) == 0 {
+		return nil, fmt.Errorf("no machines of cluster %s found in project %s", opts.ClusterID, opts.ProjectID)
+	}
+	sortByName(ms)
+
+	partition, privateNetworkID, err := clusterNetwork(append(ms, fws...))
+	if err != nil {
+		return nil, err
+	}
+
+	host := opts.ControlPlaneHost
+	if host == "" {
+		host, err = findControlPlaneIP(metalClient, opts, clusterIDTag)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	metalCluster := &api.MetalStackCluster{
+		TypeMeta: metav1.TypeMeta{APIVersion: api.GroupVersion.String(), Kind: "MetalStackCluster"},
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   opts.Namespace,
+			Name:        opts.Name,
+			Labels:      watchFilterLabels(opts),
+			Annotations: map[string]string{api.ClusterIDAnnotation: opts.ClusterID},
+		},
+		Spec: api.MetalStackClusterSpec{
+			ControlPlaneEndpoint: capi.APIEndpoint{Host: host, Port: opts.ControlPlanePort},
+			ProjectID:            opts.ProjectID,
+			Partition:            partition,
+			PublicNetworkID:      opts.PublicNetworkID,
+			PrivateNetworkID:     &privateNetworkID,
+		},
+	}
+	objects := []client.Object{newCluster(opts), metalCluster}
+
+	switch {
+	case len(fws) == 0:
+		metalCluster.Spec.DisableFirewall = true
+	case len(fws) > 1:
+		metalCluster.Spec.FirewallReplicas = pointer.Int32Ptr(int32(len(fws)))
+	}
+	for i, fw := range fws {
+		spec := newMachineSpec(fw)
+		// The controller replaces firewalls whose spec differs from the one of the cluster.
+		if i == 0 {
+			metalCluster.Spec.FirewallSpec = api.MetalStackFirewallSpec{Image: spec.Image, MachineType: spec.MachineType, SSHKeys: spec.SSHKeys}
+		} else if spec.Image != metalCluster.Spec.FirewallSpec.Image || spec.MachineType != metalCluster.Spec.FirewallSpec.MachineType {
+			return nil, fmt.Errorf("firewalls %s and %s differ in image or size", *fws[0].ID, *fw.ID)
+		}
+		objects = append(objects, newFirewall(metalCluster, int32(i), fw))
+	}
+
+	controlPlane := make(map[string]bool)
+	for _, m := range opts.ControlPlaneMachines {
+		controlPlane[m] = true
+	}
+	for _, m := range ms {
+		isControlPlane := controlPlane[*m.ID] || controlPlane[*m.Allocation.Name]
+		delete(controlPlane, *m.ID)
+		delete(controlPlane, *m.Allocation.Name)
+		objects = append(objects, newMachines(opts, m, isControlPlane)...)
+	}
+	for m := range controlPlane {
+		return nil, fmt.Errorf("control plane machine %s isn't a machine of the cluster", m)
+	}
+
+	return objects, nil
+}
+
+// Write writes the objects as YAML documents.
+func Write(w io.Writer, objects []client.Object) error {
+	for _, o := range objects {
+		data, err := yaml.Marshal(o)
+		if err != nil {
+			return fmt.Errorf("marshal %s: %w", o.GetName(), err)
+		}
+		if _, err := fmt.Fprintf(w, "---\n%s", data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateAllocated checks that the machine is allocated with all the fields the generated objects are made of.
+func validateAllocated(m *metalmodels.V1MachineResponse) error {
+	a := m.Allocation
+	if a == nil || a.Name == nil || a.Image == nil || a.Image.ID == nil || m.Size == nil || m.Size.ID == nil || m.Partition == nil || m.Partition.ID == nil {
+		return fmt.Errorf("machine %s isn't allocated", *m.ID)
+	}
+	return nil
+}
+
+// sortByName orders the machines by their allocation names, so that the generated objects are stable.
+func sortByName(ms []*metalmodels.V1MachineResponse) {
+	sort.Slice(ms, func(i, j int) bool {
+		return *ms[i].Allocation.Name < *ms[j].Allocation.Name
+	})
+}
+
+// clusterNetwork returns the partition and the private network all the machines share.
+func clusterNetwork(ms []*metalmodels.V1MachineResponse) (partition, privateNetworkID string, err error) {
+	for _, m := range ms {
+		network := ""
+		for _, n := range m.Allocation.Networks {
+			if n.Networkid != nil && pointer.BoolPtrDerefOr(n.Private, false) && !pointer.BoolPtrDerefOr(n.Underlay, false) {
+				network = *n.Networkid
+				break
+			}
+		}
+		if network == "" {
+			return "", "", fmt.Errorf("machine %s isn't in a private network", *m.ID)
+		}
+
+		if partition == "" {
+			partition, privateNetworkID = *m.Partition.ID, network
+			continue
+		}
+		if *m.Partition.ID != partition {
+			return "", "", fmt.Errorf("machine %s is in partition %s instead of %s", *m.ID, *m.Partition.ID, partition)
+		}
+		if network != privateNetworkID {
+			return "", "", fmt.Errorf("machine %s is in private network %s instead of %s", *m.ID, network, privateNetworkID)
+		}
+	}
+	return partition, privateNetworkID, nil
+}
+
+// findControlPlaneIP looks up the control plane IP by the name the controller allocates it with.
+func findControlPlaneIP(metalClient controllers.MetalStackClient, opts Options, clusterIDTag string) (string, error) {
+	resp, err := metalClient.IPFind(&metalgo.IPFindRequest{
+		ProjectID: &opts.ProjectID,
+		NetworkID: &opts.PublicNetworkID,
+		Tags:      []string{clusterIDTag},
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to find IPs: %w", err)
+	}
+	name := opts.Name + "-api-server-IP"
+	for _, ip := range resp.IPs {
+		if ip.Name == name && ip.Ipaddress != nil {
+			return *ip.Ipaddress, nil
+		}
+	}
+	return "", fmt.Errorf("control plane IP %s not found, it has to be passed", name)
+}
+
+func newCluster(opts Options) *capi.Cluster {
+	return &capi.Cluster{
+		TypeMeta:   metav1.TypeMeta{APIVersion: capi.GroupVersion.String(), Kind: "Cluster"},
+		ObjectMeta: metav1.ObjectMeta{Namespace: opts.Namespace, Name: opts.Name, Labels: watchFilterLabels(opts)},
+		Spec: capi.ClusterSpec{
+			InfrastructureRef: &corev1.ObjectReference{
+				APIVersion: api.GroupVersion.String(),
+				Kind:       "MetalStackCluster",
+				Name:       opts.Name,
+			},
+		},
+	}
+}
+
+// newFirewall returns the firewall of the replica. It's named like the controller names the firewalls it creates.
+func newFirewall(metalCluster *api.MetalStackCluster, replica int32, fw *metalmodels.V1MachineResponse) *api.MetalStackFirewall {
+	spec := metalCluster.Spec.FirewallSpec.DeepCopy()
+	spec.SetProviderID(*fw.ID)
+
+	labels := map[string]string{
+		capi.ClusterLabelName:    metalCluster.Name,
+		api.FirewallReplicaLabel: strconv.Itoa(int(replica)),
+	}
+	if value, ok := metalCluster.Labels[capi.WatchLabel]; ok {
+		labels[capi.WatchLabel] = value
+	}
+
+	return &api.MetalStackFirewall{
+		TypeMeta: metav1.TypeMeta{APIVersion: api.GroupVersion.String(), Kind: "MetalStackFirewall"},
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   metalCluster.Namespace,
+			Name:        metalCluster.GetFirewallNamespacedName(replica).Name,
+			Labels:      labels,
+			Annotations: map[string]string{api.FirewallImportedAnnotation: "true"},
+		},
+		Spec: *spec,
+	}
+}
+
+// watchFilterLabels returns the watch-filter label of the generated objects, nil if it's unset.
+func watchFilterLabels(opts Options) map[string]string {
+	if opts.WatchFilterValue == "" {
+		return nil
+	}
+	return map[string]string{capi.WatchLabel: opts.WatchFilterValue}
+}
+
+// newMachines returns the Machine and the MetalStackMachine of the machine.
+func newMachines(opts Options, m *metalmodels.V1MachineResponse, isControlPlane bool) []client.Object {
+	name := *m.Allocation.Name
+	labels := map[string]string{capi.ClusterLabelName: opts.Name}
+	if opts.WatchFilterValue != "" {
+		labels[capi.WatchLabel] = opts.WatchFilterValue
+	}
+	if isControlPlane {
+		labels[capi.MachineControlPlaneLabelName] = ""
+	}
+
+	metalMachine := &api.MetalStackMachine{
+		TypeMeta:   metav1.TypeMeta{APIVersion: api.GroupVersion.String(), Kind: "MetalStackMachine"},
+		ObjectMeta: metav1.ObjectMeta{Namespace: opts.Namespace, Name: name, Labels: labels},
+		Spec:       newMachineSpec(m),
+	}
+	metalMachine.Spec.SetProviderID(*m.ID)
+
+	machine := &capi.Machine{
+		TypeMeta:   metav1.TypeMeta{APIVersion: capi.GroupVersion.String(), Kind: "Machine"},
+		ObjectMeta: metav1.ObjectMeta{Namespace: opts.Namespace, Name: name, Labels: labels},
+		Spec: capi.MachineSpec{
+			ClusterName: opts.Name,
+			// The bootstrap data of an allocated machine isn't read, the secret only marks the machine as bootstrapped.
+			Bootstrap: capi.Bootstrap{DataSecretName: pointer.StringPtr(opts.Name + "-imported")},
+			InfrastructureRef: corev1.ObjectReference{
+				APIVersion: api.GroupVersion.String(),
+				Kind:       "MetalStackMachine",
+				Name:       name,
+			},
+		},
+	}
+	if opts.KubernetesVersion != "" {
+		machine.Spec.Version = &opts.KubernetesVersion
+	}
+
+	return []client.Object{machine, metalMachine}
+}
+
+func newMachineSpec(m *metalmodels.V1MachineResponse) api.MetalStackMachineSpec {
+	return api.MetalStackMachineSpec{
+		Image:       *m.Allocation.Image.ID,
+		MachineType: *m.Size.ID,
+		SSHKeys:     m.Allocation.SSHPubKeys,
+	}
+}
@@ -0,0 +1,250 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package importer
+
+import (
+	"bytes"
+	"errors"
+
+	"github.com/golang/mock/gomock"
+	metalgo "github.com/metal-stack/metal-go"
+	metalmodels "github.com/metal-stack/metal-go/api/models"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+	"k8s.io/utils/pointer"
+	capi "sigs.k8s.io/cluster-api/api/v1alpha4"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	api "github.com/metal-stack/cluster-api-provider-metalstack/api/v1alpha4"
+	"github.com/metal-stack/cluster-api-provider-metalstack/controllers/mocks"
+)
+
+const (
+	clusterName = "imported"
+	clusterID   = "d3b5f2a0-5c1e-4a6b-9f1e-0c8e4f3a2b1d"
+	projectID   = "project"
+	host        = "100.255.254.1"
+)
+
+var _ = Describe("Import cluster", func() {
+
+	type ImportTestCase struct {
+		Options  func(opts *Options)
+		Error    bool
+		MockFunc func(metalClient *mocks.MockMetalStackClient)
+		// Check checks the imported objects, if set.
+		Check func(objects []client.Object)
+	}
+
+	DescribeTable("Import",
+		func(tc ImportTestCase) {
+			ctrl := gomock.NewController(GinkgoT())
+			defer ctrl.Finish()
+			metalClient := mocks.NewMockMetalStackClient(ctrl)
+			tc.MockFunc(metalClient)
+
+			opts := Options{
+				Name:                 clusterName,
+				Namespace:            "default",
+				ProjectID:            projectID,
+				ClusterID:            clusterID,
+				PublicNetworkID:      "internet",
+				ControlPlanePort:     6443,
+				ControlPlaneMachines: []string{"control-plane"},
+			}
+			if tc.Options != nil {
+				tc.Options(&opts)
+			}
+
+			objects, err := Import(metalClient, opts)
+			if tc.Error {
+				Expect(err).To(HaveOccurred())
+				return
+			}
+			Expect(err).NotTo(HaveOccurred())
+			Expect(Write(&bytes.Buffer{}, objects)).To(Succeed())
+			if tc.Check != nil {
+				tc.Check(objects)
+			}
+		},
+		Entry("Should import the cluster", ImportTestCase{
+			MockFunc: func(metalClient *mocks.MockMetalStackClient) {
+				expectFirewalls(metalClient, newMachine("fw-1", clusterName))
+				expectMachines(metalClient, newMachine("fw-1", clusterName), newMachine("m-2", "worker"), newMachine("m-1", "control-plane"))
+				metalClient.EXPECT().IPFind(gomock.Any()).DoAndReturn(func(ifr *metalgo.IPFindRequest) (*metalgo.IPListResponse, error) {
+					Expect(ifr.Tags).To(ConsistOf("cluster.metal-stack.io/id=" + clusterID))
+					return &metalgo.IPListResponse{IPs: []*metalmodels.V1IPResponse{
+						{Name: clusterName + "-egress-partner", Ipaddress: pointer.StringPtr("212.34.83.10")},
+						{Name: clusterName + "-api-server-IP", Ipaddress: pointer.StringPtr(host)},
+					}}, nil
+				})
+			},
+			Check: func(objects []client.Object) {
+				Expect(objects).To(HaveLen(7))
+
+				metalCluster := objects[1].(*api.MetalStackCluster)
+				Expect(metalCluster.GetClusterID()).To(Equal(clusterID))
+				Expect(metalCluster.Spec.ControlPlaneEndpoint).To(Equal(capi.APIEndpoint{Host: host, Port: 6443}))
+				Expect(metalCluster.Spec.Partition).To(Equal("partition"))
+				Expect(metalCluster.Spec.PrivateNetworkID).To(Equal(pointer.StringPtr("private")))
+				Expect(metalCluster.Spec.FirewallSpec).To(Equal(api.MetalStackFirewallSpec{Image: "ubuntu-20.04", MachineType: "c1-xlarge-x86"}))
+				Expect(metalCluster.Spec.FirewallReplicas).To(BeNil())
+				Expect(metalCluster.Spec.DisableFirewall).To(BeFalse())
+
+				firewall := objects[2].(*api.MetalStackFirewall)
+				Expect(firewall.Name).To(Equal(clusterName))
+				Expect(firewall.Spec.ProviderID).To(Equal(pointer.StringPtr("metalstack://fw-1")))
+				Expect(firewall.Annotations).To(HaveKey(api.FirewallImportedAnnotation))
+
+				controlPlane := objects[3].(*capi.Machine)
+				Expect(controlPlane.Name).To(Equal("control-plane"))
+				Expect(controlPlane.Labels).To(HaveKey(capi.MachineControlPlaneLabelName))
+				Expect(controlPlane.Spec.Bootstrap.DataSecretName).NotTo(BeNil())
+				Expect(objects[4].(*api.MetalStackMachine).Spec.ProviderID).To(Equal(pointer.StringPtr("metalstack://m-1")))
+
+				Expect(objects[5].GetLabels()).NotTo(HaveKey(capi.MachineControlPlaneLabelName))
+				Expect(objects[6].(*api.MetalStackMachine).Spec.ProviderID).To(Equal(pointer.StringPtr("metalstack://m-2")))
+			},
+		}),
+		Entry("Should import the firewall replicas", ImportTestCase{
+			Options: func(opts *Options) {
+				opts.ControlPlaneHost = host
+			},
+			MockFunc: func(metalClient *mocks.MockMetalStackClient) {
+				expectFirewalls(metalClient, newMachine("fw-2", "fw-b"), newMachine("fw-1", "fw-a"))
+				expectMachines(metalClient, newMachine("m-1", "control-plane"))
+			},
+			Check: func(objects []client.Object) {
+				metalCluster := objects[1].(*api.MetalStackCluster)
+				Expect(metalCluster.Spec.FirewallReplicas).To(Equal(pointer.Int32Ptr(2)))
+
+				Expect(objects[2].GetName()).To(Equal(clusterName))
+				Expect(objects[2].(*api.MetalStackFirewall).GetReplica()).To(BeEquivalentTo(0))
+				Expect(objects[3].GetName()).To(Equal(clusterName + "-1"))
+				Expect(objects[3].(*api.MetalStackFirewall).GetReplica()).To(BeEquivalentTo(1))
+				Expect(objects[3].(*api.MetalStackFirewall).Spec.ProviderID).To(Equal(pointer.StringPtr("metalstack://fw-2")))
+			},
+		}),
+		Entry("Should label the objects with the watch filter", ImportTestCase{
+			Options: func(opts *Options) {
+				opts.ControlPlaneHost = host
+				opts.WatchFilterValue = "filter"
+			},
+			MockFunc: func(metalClient *mocks.MockMetalStackClient) {
+				expectFirewalls(metalClient, newMachine("fw-1", clusterName))
+				expectMachines(metalClient, newMachine("m-1", "control-plane"))
+			},
+			Check: func(objects []client.Object) {
+				Expect(objects).To(HaveLen(5))
+				for _, obj := range objects {
+					Expect(obj.GetLabels()).To(HaveKeyWithValue(capi.WatchLabel, "filter"))
+				}
+			},
+		}),
+		Entry("Should disable the firewall of a cluster without one", ImportTestCase{
+			Options: func(opts *Options) {
+				opts.ControlPlaneHost = host
+			},
+			MockFunc: func(metalClient *mocks.MockMetalStackClient) {
+				expectFirewalls(metalClient)
+				expectMachines(metalClient, newMachine("m-1", "control-plane"))
+			},
+			Check: func(objects []client.Object) {
+				Expect(objects).To(HaveLen(4))
+				Expect(objects[1].(*api.MetalStackCluster).Spec.DisableFirewall).To(BeTrue())
+			},
+		}),
+		Entry("Should fail if the control plane IP isn't found", ImportTestCase{
+			Error: true,
+			MockFunc: func(metalClient *mocks.MockMetalStackClient) {
+				expectFirewalls(metalClient)
+				expectMachines(metalClient, newMachine("m-1", "control-plane"))
+				metalClient.EXPECT().IPFind(gomock.Any()).Return(&metalgo.IPListResponse{}, nil)
+			},
+		}),
+		Entry("Should fail if the machines are in different private networks", ImportTestCase{
+			Error: true,
+			MockFunc: func(metalClient *mocks.MockMetalStackClient) {
+				other := newMachine("m-2", "worker")
+				other.Allocation.Networks[0].Networkid = pointer.StringPtr("other")
+				expectFirewalls(metalClient)
+				expectMachines(metalClient, newMachine("m-1", "control-plane"), other)
+			},
+		}),
+		Entry("Should fail if a control plane machine isn't found", ImportTestCase{
+			Error: true,
+			Options: func(opts *Options) {
+				opts.ControlPlaneHost = host
+				opts.ControlPlaneMachines = []string{"m-3"}
+			},
+			MockFunc: func(metalClient *mocks.MockMetalStackClient) {
+				expectFirewalls(metalClient)
+				expectMachines(metalClient, newMachine("m-1", "control-plane"))
+			},
+		}),
+		Entry("Should fail if no machine is found", ImportTestCase{
+			Error: true,
+			MockFunc: func(metalClient *mocks.MockMetalStackClient) {
+				expectFirewalls(metalClient)
+				expectMachines(metalClient)
+			},
+		}),
+		Entry("Should fail if FirewallFind returned error", ImportTestCase{
+			Error: true,
+			MockFunc: func(metalClient *mocks.MockMetalStackClient) {
+				metalClient.EXPECT().FirewallFind(gomock.Any()).Return(nil, errors.New("error"))
+			},
+		}),
+	)
+})
+
+func newMachine(id, name string) *metalmodels.V1MachineResponse {
+	return &metalmodels.V1MachineResponse{
+		ID:        pointer.StringPtr(id),
+		Partition: &metalmodels.V1PartitionResponse{ID: pointer.StringPtr("partition")},
+		Size:      &metalmodels.V1SizeResponse{ID: pointer.StringPtr("c1-xlarge-x86")},
+		Allocation: &metalmodels.V1MachineAllocation{
+			Name:  pointer.StringPtr(name),
+			Image: &metalmodels.V1ImageResponse{ID: pointer.StringPtr("ubuntu-20.04")},
+			Networks: []*metalmodels.V1MachineNetwork{
+				{Networkid: pointer.StringPtr("private"), Private: pointer.BoolPtr(true), Underlay: pointer.BoolPtr(false)},
+				{Networkid: pointer.StringPtr("internet"), Private: pointer.BoolPtr(false), Underlay: pointer.BoolPtr(false)},
+			},
+		},
+	}
+}
+
+func expectFirewalls(metalClient *mocks.MockMetalStackClient, firewalls ...*metalmodels.V1MachineResponse) {
+	resp := &metalgo.FirewallListResponse{}
+	for _, fw := range firewalls {
+		resp.Firewalls = append(resp.Firewalls, &metalmodels.V1FirewallResponse{
+			ID:         fw.ID,
+			Allocation: fw.Allocation,
+			Partition:  fw.Partition,
+			Size:       fw.Size,
+		})
+	}
+	metalClient.EXPECT().FirewallFind(gomock.Any()).DoAndReturn(func(ffr *metalgo.FirewallFindRequest) (*metalgo.FirewallListResponse, error) {
+		Expect(ffr.AllocationProject).To(Equal(pointer.StringPtr(projectID)))
+		return resp, nil
+	})
+}
+
+func expectMachines(metalClient *mocks.MockMetalStackClient, machines ...*metalmodels.V1MachineResponse) {
+	metalClient.EXPECT().MachineFind(gomock.Any()).Return(&metalgo.MachineListResponse{Machines: machines}, nil)
+}
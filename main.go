@@ -25,12 +25,15 @@ import (
 	_ "k8s.io/client-go/plugin/pkg/client/auth/oidc"
 
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 
+	openapiclient "github.com/go-openapi/runtime/client"
 	metalgo "github.com/metal-stack/metal-go"
 
 	clusterapi "sigs.k8s.io/cluster-api/api/v1alpha4"
 
+	configv1 "github.com/metal-stack/cluster-api-provider-metalstack/api/config/v1alpha1"
 	infra "github.com/metal-stack/cluster-api-provider-metalstack/api/v1alpha4"
 	"github.com/metal-stack/cluster-api-provider-metalstack/controllers"
 	// +kubebuilder:scaffold:imports
@@ -39,48 +42,104 @@ import (
 var setupLog = ctrl.Log.WithName("setup")
 
 func main() {
-	var metricsAddr string
-	var enableLeaderElection bool
-	flag.StringVar(&metricsAddr, "metrics-addr", ":8081", "The address the metric endpoint binds to.")
-	flag.BoolVar(
-		&enableLeaderElection,
-		"enable-leader-election",
-		false,
-		"Enable leader election for controller manager. Enabling this will ensure there is only one active controller manager.")
+	var flags managerFlags
+	flags.bindFlags(flag.CommandLine)
 	flag.Parse()
 
-	ctrl.SetLogger(zap.New(zap.UseDevMode(true)))
+	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&flags.zap)))
+
+	options, config, err := flags.load(flag.CommandLine, newAndReadyScheme())
+	if err != nil {
+		setupLog.Error(err, "unable to load config")
+		os.Exit(1)
+	}
 
 	// Create the `metal-API` client.
-	metalClient, err := metalgo.NewDriver(os.Getenv("METALCTL_URL"), "", os.Getenv("METALCTL_HMAC"))
+	// The requests of metal-go take the default timeout of go-openapi.
+	openapiclient.DefaultTimeout = config.MetalAPI.Timeout.Duration
+	metalClient, err := controllers.NewReloadingMetalStackClient(
+		func() (controllers.MetalAPICredentials, error) {
+			return controllers.LoadMetalAPICredentials(config.MetalAPI)
+		},
+		func(credentials controllers.MetalAPICredentials) (controllers.MetalStackClient, error) {
+			return metalgo.NewDriver(credentials.URL, credentials.Token, credentials.HMAC)
+		},
+		config.MetalAPI.CredentialsReloadInterval.Duration,
+		ctrl.Log.WithName("metal-api"),
+	)
 	if err != nil {
 		setupLog.Error(err, "unable to get `metal-stack/metal-go`client")
 		os.Exit(1)
 	}
+	if err := controllers.VerifyMetalAPICredentials(metalClient); err != nil {
+		setupLog.Error(err, "unable to connect to metal-API")
+		os.Exit(1)
+	}
 	setupLog.Info("metalstack client connected")
 
-	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), *newManagerOptions(metricsAddr, enableLeaderElection))
+	limiterOpts := controllers.LimiterOptions{
+		QPS:              *config.MetalAPI.QPS,
+		Burst:            *config.MetalAPI.Burst,
+		FailureThreshold: *config.MetalAPI.BreakerFailures,
+		OpenDuration:     config.MetalAPI.BreakerOpenDuration.Duration,
+	}
+	cacheOpts := controllers.CacheOptions{
+		TTL:      config.MetalAPI.CacheTTL.Duration,
+		BulkList: *config.MetalAPI.CacheBulkList,
+	}
+
+	// The limiter wraps the instrumented client, so that requests stopped by the circuit breaker don't count as requests to `metal-API`.
+	// The cache wraps the limiter, so that cached lookups are neither throttled nor stopped.
+	metalStackClient := controllers.NewLimitedMetalStackClient(controllers.NewInstrumentedMetalStackClient(metalClient), limiterOpts)
+	metalStackClient = controllers.NewCachedMetalStackClient(metalStackClient, cacheOpts)
+	// Responses cached from the former metal-API don't apply to another one.
+	metalClient.OnURLChange(func() {
+		controllers.FlushMetalStackClientCache(metalStackClient)
+	})
+
+	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), options)
 	if err != nil {
 		setupLog.Error(err, "unable to start manager")
 		os.Exit(1)
 	}
 
-	if err = controllers.NewMetalStackClusterReconciler(metalClient, mgr).SetupWithManager(mgr); err != nil {
+	if err := mgr.Add(metalClient); err != nil {
+		setupLog.Error(err, "unable to reload metal-API credentials")
+		os.Exit(1)
+	}
+
+	// The liveness doesn't depend on metal-API, so that the manager isn't restarted while metal-API is unavailable.
+	if err := mgr.AddHealthzCheck("ping", healthz.Ping); err != nil {
+		setupLog.Error(err, "unable to add health check")
+		os.Exit(1)
+	}
+	metalAPIChecker := controllers.NewMetalAPIChecker(metalStackClient, config.MetalAPI.HealthCheckInterval.Duration)
+	if err := mgr.AddReadyzCheck("metal-api", metalAPIChecker.Check); err != nil {
+		setupLog.Error(err, "unable to add readiness check")
+		os.Exit(1)
+	}
+
+	metalStackClusterReconciler := controllers.NewMetalStackClusterReconciler(metalStackClient, mgr)
+	metalStackClusterReconciler.WatchFilterValue = config.WatchFilterValue
+	if err = metalStackClusterReconciler.SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "MetalStackCluster")
 		os.Exit(1)
 	}
 
-	metalStackMachineReconciler, err := controllers.NewMetalStackMachineReconciler(metalClient, mgr)
+	metalStackMachineReconciler, err := controllers.NewMetalStackMachineReconciler(metalStackClient, mgr)
 	if err != nil {
 		setupLog.Error(err, "unable to init controller", "controller", "MetalStackMachine")
 		os.Exit(1)
 	}
+	metalStackMachineReconciler.WatchFilterValue = config.WatchFilterValue
 	if err := metalStackMachineReconciler.SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to setup controller", "controller", "MetalStackMachine")
 		os.Exit(1)
 	}
 
-	if err = controllers.NewMetalStackFirewallReconciler(metalClient, mgr).SetupWithManager(mgr); err != nil {
+	metalStackFirewallReconciler := controllers.NewMetalStackFirewallReconciler(metalStackClient, mgr)
+	metalStackFirewallReconciler.WatchFilterValue = config.WatchFilterValue
+	if err = metalStackFirewallReconciler.SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "MetalStackFirewall")
 		os.Exit(1)
 	}
@@ -98,21 +157,6 @@ func newAndReadyScheme() *runtime.Scheme {
 	_ = clientgoscheme.AddToScheme(scheme)
 	_ = clusterapi.AddToScheme(scheme)
 	_ = infra.AddToScheme(scheme)
+	_ = configv1.AddToScheme(scheme)
 	return scheme
 }
-
-func newManagerOptions(metricsAddr string, enableLeaderElection bool) *ctrl.Options {
-	// Machine and cluster operations can create enough events to trigger the event recorder spam filter
-	// Setting the burst size higher ensures all events will be recorded and submitted to the API
-	// broadcaster := record.NewBroadcasterWithCorrelatorOptions(record.CorrelatorOptions{
-	// 	BurstSize: 100,
-	// })
-	return &ctrl.Options{
-		Scheme:             newAndReadyScheme(),
-		MetricsBindAddress: metricsAddr,
-		Port:               9443,
-		// EventBroadcaster:   broadcaster,
-		LeaderElection:   enableLeaderElection,
-		LeaderElectionID: "capi-metal-stack-le",
-	}
-}
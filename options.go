@@ -0,0 +1,311 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	componentconfig "k8s.io/component-base/config/v1alpha1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+
+	clusterapi "sigs.k8s.io/cluster-api/api/v1alpha4"
+
+	configv1 "github.com/metal-stack/cluster-api-provider-metalstack/api/config/v1alpha1"
+	infra "github.com/metal-stack/cluster-api-provider-metalstack/api/v1alpha4"
+)
+
+// managerFlags are the command-line flags of the manager.
+// Flags given explicitly take precedence over the config file, the defaults of the others apply to what the file leaves unset.
+type managerFlags struct {
+	configFile string
+
+	metricsAddr          string
+	healthAddr           string
+	enableLeaderElection bool
+	leaderElectionID     string
+	webhookPort          int
+	syncPeriod           time.Duration
+	watchNamespace       string
+	watchFilterValue     string
+	concurrency          map[string]*int
+
+	metalAPIURL                 string
+	metalAPIURLFile             string
+	metalAPIHMACFile            string
+	metalAPITokenFile           string
+	metalAPIReloadInterval      time.Duration
+	metalAPITimeout             time.Duration
+	metalAPIHealthInterval      time.Duration
+	metalAPIQPS                 float64
+	metalAPIBurst               int
+	metalAPIBreakerFailures     int
+	metalAPIBreakerOpenDuration time.Duration
+	metalAPICacheTTL            time.Duration
+	metalAPICacheBulkList       bool
+
+	zap zap.Options
+}
+
+// bindFlags defines the flags of the manager.
+func (f *managerFlags) bindFlags(fs *flag.FlagSet) {
+	fs.StringVar(&f.configFile, "config", "", "The MetalStackProviderConfig file of the manager. Flags given explicitly take precedence over it.")
+
+	fs.StringVar(&f.metricsAddr, "metrics-addr", ":8081", "The address the metric endpoint binds to.")
+	fs.StringVar(&f.healthAddr, "health-addr", ":9440", "The address the health and readiness probes bind to.")
+	fs.BoolVar(
+		&f.enableLeaderElection,
+		"enable-leader-election",
+		false,
+		"Enable leader election for controller manager. Enabling this will ensure there is only one active controller manager.")
+	fs.StringVar(&f.leaderElectionID, "leader-election-id", "capi-metal-stack-le", "The name of the leader election lock.")
+	fs.IntVar(&f.webhookPort, "webhook-port", 9443, "The port the webhook server binds to.")
+	fs.DurationVar(&f.syncPeriod, "sync-period", 10*time.Hour, "The minimum interval at which watched objects are reconciled.")
+	fs.StringVar(
+		&f.watchNamespace,
+		"watch-namespace",
+		"",
+		"The comma separated namespaces the controllers watch, all namespaces if empty.")
+	fs.StringVar(
+		&f.watchFilterValue,
+		"watch-filter",
+		"",
+		fmt.Sprintf("Reconcile only objects labeled with %s and this value, all objects if empty.", clusterapi.WatchLabel))
+
+	f.concurrency = make(map[string]*int)
+	for _, kind := range []string{"MetalStackCluster", "MetalStackMachine", "MetalStackFirewall"} {
+		f.concurrency[kind] = fs.Int(
+			strings.ToLower(kind)+"-concurrency",
+			1,
+			fmt.Sprintf("The number of %s objects reconciled concurrently.", kind))
+	}
+
+	fs.StringVar(&f.metalAPIURL, "metal-api-url", os.Getenv("METALCTL_URL"), "The URL of metal-API. Defaults to the environment variable METALCTL_URL.")
+	fs.StringVar(&f.metalAPIURLFile, "metal-api-url-file", "", "The file with the URL of metal-API, taking precedence over --metal-api-url.")
+	fs.StringVar(
+		&f.metalAPIHMACFile,
+		"metal-api-hmac-file",
+		"",
+		"The file with the HMAC key for metal-API. Defaults to the key in the environment variable METALCTL_HMAC.")
+	fs.StringVar(&f.metalAPITokenFile, "metal-api-token-file", "", "The file with the bearer token for metal-API, exclusive with the HMAC key.")
+	fs.DurationVar(
+		&f.metalAPIReloadInterval,
+		"metal-api-credentials-reload-interval",
+		time.Minute,
+		"The interval the credentials of metal-API are read again, so that rotated ones are used without a restart. Must be positive.")
+	fs.DurationVar(&f.metalAPITimeout, "metal-api-timeout", 30*time.Second, "The timeout of the requests to metal-API.")
+	fs.DurationVar(
+		&f.metalAPIHealthInterval,
+		"metal-api-health-interval",
+		30*time.Second,
+		"The time the result of the readiness check of metal-API is cached. Must be positive.")
+	fs.Float64Var(&f.metalAPIQPS, "metal-api-qps", 10, "The number of requests per second to metal-API, unlimited if not positive.")
+	fs.IntVar(&f.metalAPIBurst, "metal-api-burst", 20, "The number of requests to metal-API which may exceed the QPS at once, at least 1.")
+	fs.IntVar(
+		&f.metalAPIBreakerFailures,
+		"metal-api-breaker-failures",
+		5,
+		"The number of consecutive failed requests which stop the requests to metal-API, disabled if not positive.")
+	fs.DurationVar(
+		&f.metalAPIBreakerOpenDuration,
+		"metal-api-breaker-open-duration",
+		30*time.Second,
+		"The time the requests to metal-API are stopped until a single request probes it again.")
+	fs.DurationVar(&f.metalAPICacheTTL, "metal-api-cache-ttl", 10*time.Second, "The time lookups of metal-API are cached, disabled if not positive.")
+	fs.BoolVar(&f.metalAPICacheBulkList, "metal-api-cache-bulk-list", false, "List the machines of a cluster by a single request to fill the cache.")
+
+	// The log level and format are set by --zap-log-level and --zap-encoder.
+	f.zap.Development = true
+	f.zap.BindFlags(fs)
+}
+
+// load resolves the options of the manager and the configuration of the provider from the parsed flags and the config file.
+func (f *managerFlags) load(fs *flag.FlagSet, scheme *runtime.Scheme) (ctrl.Options, *configv1.MetalStackProviderConfig, error) {
+	set := make(map[string]bool)
+	fs.Visit(func(fl *flag.Flag) {
+		set[fl.Name] = true
+	})
+
+	// The options set here aren't overridden by the config file.
+	// Secrets are read from the API server instead of caching all Secrets of the watched namespaces.
+	options := ctrl.Options{Scheme: scheme, ClientDisableCacheFor: []client.Object{&core.Secret{}}}
+	if set["metrics-addr"] {
+		options.MetricsBindAddress = f.metricsAddr
+	}
+	if set["health-addr"] {
+		options.HealthProbeBindAddress = f.healthAddr
+	}
+	if set["enable-leader-election"] {
+		options.LeaderElection = f.enableLeaderElection
+	}
+	if set["leader-election-id"] {
+		options.LeaderElectionID = f.leaderElectionID
+	}
+	if set["webhook-port"] {
+		options.Port = f.webhookPort
+	}
+	if set["sync-period"] {
+		options.SyncPeriod = &f.syncPeriod
+	}
+
+	config := &configv1.MetalStackProviderConfig{}
+	if f.configFile != "" {
+		loader := ctrl.ConfigFile().AtPath(f.configFile).OfKind(config)
+		if err := loader.InjectScheme(scheme); err != nil {
+			return options, nil, err
+		}
+		if _, err := loader.Complete(); err != nil {
+			return options, nil, fmt.Errorf("failed to load config file %s: %w", f.configFile, err)
+		}
+		// AndFrom panics on a config file without leaderElection.
+		if config.LeaderElection == nil {
+			config.LeaderElection = &componentconfig.LeaderElectionConfiguration{}
+		}
+
+		var err error
+		options, err = options.AndFrom(config)
+		if err != nil {
+			return options, nil, fmt.Errorf("failed to load config file %s: %w", f.configFile, err)
+		}
+	}
+
+	// The defaults of the flags apply to what neither the flags nor the config file set.
+	if options.MetricsBindAddress == "" {
+		options.MetricsBindAddress = f.metricsAddr
+	}
+	if options.HealthProbeBindAddress == "" {
+		options.HealthProbeBindAddress = f.healthAddr
+	}
+	if !options.LeaderElection {
+		options.LeaderElection = f.enableLeaderElection
+	}
+	if options.LeaderElectionID == "" {
+		options.LeaderElectionID = f.leaderElectionID
+	}
+	if options.Port == 0 {
+		options.Port = f.webhookPort
+	}
+	if options.SyncPeriod == nil {
+		options.SyncPeriod = &f.syncPeriod
+	}
+
+	// The namespaces of the config file take precedence over its cacheNamespace.
+	namespaces := config.WatchNamespaces
+	switch {
+	case set["watch-namespace"]:
+		namespaces = splitNamespaces(f.watchNamespace)
+	case len(namespaces) == 0 && options.Namespace != "":
+		namespaces = []string{options.Namespace}
+	case len(namespaces) == 0:
+		namespaces = splitNamespaces(f.watchNamespace)
+	}
+	config.WatchNamespaces = namespaces
+	options.Namespace = ""
+	if len(namespaces) == 1 {
+		options.Namespace = namespaces[0]
+	} else if len(namespaces) > 1 {
+		options.NewCache = cache.MultiNamespacedCacheBuilder(namespaces)
+	}
+
+	concurrency := make(map[string]int)
+	for key, n := range options.Controller.GroupKindConcurrency {
+		concurrency[key] = n
+	}
+	for kind, n := range f.concurrency {
+		key := kind + "." + infra.GroupVersion.Group
+		if _, ok := concurrency[key]; !ok || set[strings.ToLower(kind)+"-concurrency"] {
+			concurrency[key] = *n
+		}
+	}
+	options.Controller.GroupKindConcurrency = concurrency
+
+	if set["watch-filter"] || config.WatchFilterValue == "" {
+		config.WatchFilterValue = f.watchFilterValue
+	}
+
+	m := &config.MetalAPI
+	if set["metal-api-url"] || m.URL == "" {
+		m.URL = f.metalAPIURL
+	}
+	if set["metal-api-url-file"] || m.URLFile == "" {
+		m.URLFile = f.metalAPIURLFile
+	}
+	if set["metal-api-hmac-file"] || m.HMACFile == "" {
+		m.HMACFile = f.metalAPIHMACFile
+	}
+	if set["metal-api-token-file"] || m.TokenFile == "" {
+		m.TokenFile = f.metalAPITokenFile
+	}
+	if m.TokenFile != "" && m.HMACFile != "" {
+		return options, nil, fmt.Errorf("metal-API token file and HMAC file are exclusive")
+	}
+	if set["metal-api-credentials-reload-interval"] || m.CredentialsReloadInterval == nil {
+		m.CredentialsReloadInterval = &metav1.Duration{Duration: f.metalAPIReloadInterval}
+	}
+	if set["metal-api-timeout"] || m.Timeout == nil {
+		m.Timeout = &metav1.Duration{Duration: f.metalAPITimeout}
+	}
+	if set["metal-api-health-interval"] || m.HealthCheckInterval == nil {
+		m.HealthCheckInterval = &metav1.Duration{Duration: f.metalAPIHealthInterval}
+	}
+	// The credentials are reloaded and the readiness is checked in a loop of this period.
+	if m.CredentialsReloadInterval.Duration <= 0 {
+		return options, nil, fmt.Errorf("metal-API credentials reload interval must be positive")
+	}
+	if m.HealthCheckInterval.Duration <= 0 {
+		return options, nil, fmt.Errorf("metal-API health interval must be positive")
+	}
+	if set["metal-api-qps"] || m.QPS == nil {
+		m.QPS = &f.metalAPIQPS
+	}
+	if set["metal-api-burst"] || m.Burst == nil {
+		m.Burst = &f.metalAPIBurst
+	}
+	if set["metal-api-breaker-failures"] || m.BreakerFailures == nil {
+		m.BreakerFailures = &f.metalAPIBreakerFailures
+	}
+	if set["metal-api-breaker-open-duration"] || m.BreakerOpenDuration == nil {
+		m.BreakerOpenDuration = &metav1.Duration{Duration: f.metalAPIBreakerOpenDuration}
+	}
+	if set["metal-api-cache-ttl"] || m.CacheTTL == nil {
+		m.CacheTTL = &metav1.Duration{Duration: f.metalAPICacheTTL}
+	}
+	if set["metal-api-cache-bulk-list"] || m.CacheBulkList == nil {
+		m.CacheBulkList = &f.metalAPICacheBulkList
+	}
+
+	return options, config, nil
+}
+
+func splitNamespaces(namespaces string) []string {
+	var split []string
+	for _, namespace := range strings.Split(namespaces, ",") {
+		if namespace = strings.TrimSpace(namespace); namespace != "" {
+			split = append(split, namespace)
+		}
+	}
+	return split
+}
@@ -0,0 +1,163 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+	core "k8s.io/api/core/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	configv1 "github.com/metal-stack/cluster-api-provider-metalstack/api/config/v1alpha1"
+)
+
+var _ = Describe("Manager options", func() {
+
+	type OptionsTestCase struct {
+		Args []string
+		// Config is the content of the config file, if set.
+		Config string
+		Error  bool
+		Check  func(options ctrl.Options, config *configv1.MetalStackProviderConfig)
+	}
+
+	DescribeTable("Load options",
+		func(tc OptionsTestCase) {
+			args := tc.Args
+			if tc.Config != "" {
+				dir, err := ioutil.TempDir("", "config")
+				Expect(err).NotTo(HaveOccurred())
+				defer os.RemoveAll(dir)
+
+				file := filepath.Join(dir, "config.yaml")
+				Expect(ioutil.WriteFile(file, []byte(tc.Config), 0600)).To(Succeed())
+				args = append(args, "--config", file)
+			}
+
+			var flags managerFlags
+			fs := flag.NewFlagSet("manager", flag.ContinueOnError)
+			flags.bindFlags(fs)
+			Expect(fs.Parse(args)).To(Succeed())
+
+			options, config, err := flags.load(fs, newAndReadyScheme())
+			if tc.Error {
+				Expect(err).To(HaveOccurred())
+				return
+			}
+			Expect(err).NotTo(HaveOccurred())
+			tc.Check(options, config)
+		},
+		Entry("Should apply the defaults of the flags", OptionsTestCase{
+			Check: func(options ctrl.Options, config *configv1.MetalStackProviderConfig) {
+				Expect(options.HealthProbeBindAddress).To(Equal(":9440"))
+				Expect(options.LeaderElectionID).To(Equal("capi-metal-stack-le"))
+				Expect(options.Namespace).To(BeEmpty())
+				Expect(config.WatchFilterValue).To(BeEmpty())
+				Expect(*config.MetalAPI.Burst).To(Equal(20))
+				Expect(options.ClientDisableCacheFor).To(ConsistOf(&core.Secret{}))
+			},
+		}),
+		Entry("Should load a config file without leaderElection", OptionsTestCase{
+			Config: `apiVersion: config.infrastructure.cluster.x-k8s.io/v1alpha1
+kind: MetalStackProviderConfig
+cacheNamespace: tenant-a
+watchFilterValue: tenant-a
+`,
+			Check: func(options ctrl.Options, config *configv1.MetalStackProviderConfig) {
+				Expect(options.Namespace).To(Equal("tenant-a"))
+				Expect(options.LeaderElectionID).To(Equal("capi-metal-stack-le"))
+				Expect(config.WatchFilterValue).To(Equal("tenant-a"))
+			},
+		}),
+		Entry("Should prefer the flags to the config file", OptionsTestCase{
+			Args: []string{"--watch-namespace", "tenant-b", "--watch-filter", "tenant-b", "--leader-election-id", "tenant-b"},
+			Config: `apiVersion: config.infrastructure.cluster.x-k8s.io/v1alpha1
+kind: MetalStackProviderConfig
+leaderElection:
+  resourceName: tenant-a
+cacheNamespace: tenant-a
+watchFilterValue: tenant-a
+metalAPI:
+  burst: 5
+`,
+			Check: func(options ctrl.Options, config *configv1.MetalStackProviderConfig) {
+				Expect(options.Namespace).To(Equal("tenant-b"))
+				Expect(options.LeaderElectionID).To(Equal("tenant-b"))
+				Expect(config.WatchFilterValue).To(Equal("tenant-b"))
+				Expect(*config.MetalAPI.Burst).To(Equal(5))
+			},
+		}),
+		Entry("Should watch a single namespace", OptionsTestCase{
+			Args: []string{"--watch-namespace", "tenant-a"},
+			Check: func(options ctrl.Options, config *configv1.MetalStackProviderConfig) {
+				Expect(options.Namespace).To(Equal("tenant-a"))
+				Expect(options.NewCache).To(BeNil())
+			},
+		}),
+		Entry("Should watch several namespaces", OptionsTestCase{
+			Args: []string{"--watch-namespace", "tenant-a, tenant-b"},
+			Check: func(options ctrl.Options, config *configv1.MetalStackProviderConfig) {
+				Expect(options.Namespace).To(BeEmpty())
+				Expect(options.NewCache).NotTo(BeNil())
+				Expect(config.WatchNamespaces).To(Equal([]string{"tenant-a", "tenant-b"}))
+			},
+		}),
+		Entry("Should take the namespaces and the watch filter from the config file", OptionsTestCase{
+			Config: `apiVersion: config.infrastructure.cluster.x-k8s.io/v1alpha1
+kind: MetalStackProviderConfig
+cacheNamespace: other
+watchNamespaces: [tenant-a, tenant-b]
+watchFilterValue: tenant-a
+`,
+			Check: func(options ctrl.Options, config *configv1.MetalStackProviderConfig) {
+				Expect(options.NewCache).NotTo(BeNil())
+				Expect(config.WatchNamespaces).To(Equal([]string{"tenant-a", "tenant-b"}))
+				Expect(config.WatchFilterValue).To(Equal("tenant-a"))
+			},
+		}),
+		Entry("Should fail if both token and HMAC file are set", OptionsTestCase{
+			Args:  []string{"--metal-api-token-file", "token", "--metal-api-hmac-file", "hmac"},
+			Error: true,
+		}),
+		Entry("Should fail if the credentials reload interval isn't positive", OptionsTestCase{
+			Args:  []string{"--metal-api-credentials-reload-interval", "0"},
+			Error: true,
+		}),
+		Entry("Should fail if the credentials reload interval of the config file isn't positive", OptionsTestCase{
+			Config: `apiVersion: config.infrastructure.cluster.x-k8s.io/v1alpha1
+kind: MetalStackProviderConfig
+metalAPI:
+  credentialsReloadInterval: 0s
+`,
+			Error: true,
+		}),
+		Entry("Should fail if the health interval isn't positive", OptionsTestCase{
+			Args:  []string{"--metal-api-health-interval", "-1s"},
+			Error: true,
+		}),
+		Entry("Should fail if the config file doesn't exist", OptionsTestCase{
+			Args:  []string{"--config", "/nonexistent/config.yaml"},
+			Error: true,
+		}),
+	)
+})